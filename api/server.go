@@ -398,6 +398,11 @@ func (s *Server) handlePerformance(c *gin.Context) {
 		return
 	}
 
+	// format=report 返回扁平化的展示报告
+	if c.Query("format") == "report" {
+		c.JSON(http.StatusOK, performance.Report())
+		return
+	}
 	c.JSON(http.StatusOK, performance)
 }
 
@@ -415,7 +420,7 @@ func (s *Server) Start() error {
 	log.Printf("  • GET  /api/decisions/latest?trader_id=xxx - 指定trader的最新决策")
 	log.Printf("  • GET  /api/statistics?trader_id=xxx - 指定trader的统计信息")
 	log.Printf("  • GET  /api/equity-history?trader_id=xxx - 指定trader的收益率历史数据")
-	log.Printf("  • GET  /api/performance?trader_id=xxx - 指定trader的AI学习表现分析")
+	log.Printf("  • GET  /api/performance?trader_id=xxx - 指定trader的AI学习表现分析（&format=report返回展示报告）")
 	log.Printf("  • GET  /health               - 健康检查")
 	log.Println()
 
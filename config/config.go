@@ -42,12 +42,99 @@ type TraderConfig struct {
 
 	InitialBalance      float64 `json:"initial_balance"`
 	ScanIntervalMinutes int     `json:"scan_interval_minutes"`
+
+	MinCycleIntervalSeconds int `json:"min_cycle_interval_seconds,omitempty"` // 两次AI决策的最小间隔秒数（0表示不限制）
+
+	// 决策引擎配置（可选）
+	IncludeLiquidationDistance bool     `json:"include_liquidation_distance,omitempty"` // 在prompt中展示持仓距强平百分比
+	IncludeMarketDataAge       bool     `json:"include_market_data_age,omitempty"`      // 在prompt中展示各币种市场数据的获取时长（秒）
+	MaxPortfolioHeatPct        float64  `json:"max_portfolio_heat_pct,omitempty"`       // 组合热度上限（占净值百分比，0表示不限制）
+	MaxSymbolConcentrationPct  float64  `json:"max_symbol_concentration_pct,omitempty"` // 单币种名义价值占全部持仓的上限（百分比，0表示不限制）
+	SymbolConcentrationPolicy  string   `json:"symbol_concentration_policy,omitempty"`  // 超过单币种集中度上限时: "block"(默认) 或 "warn"
+	UnheldHoldPolicy           string   `json:"unheld_hold_policy,omitempty"`           // 未持仓币种的hold处理: "wait"(默认) 或 "drop"
+	EmptyReasoningPolicy       string   `json:"empty_reasoning_policy,omitempty"`       // 开仓缺少理由时: "allow"(默认)、"flag" 或 "reject"
+	SizeRiskTolerancePct       float64  `json:"size_risk_tolerance_pct,omitempty"`      // 仓位推算风险与risk_usd允许的偏差（%，0表示不检查）
+	SizeRiskPolicy             string   `json:"size_risk_policy,omitempty"`             // 仓位与风险不一致时: "flag"(默认) 或 "reject"
+	EnforceRiskUSD             bool     `json:"enforce_risk_usd,omitempty"`             // 要求止损触发时的实际风险不超过声明的risk_usd
+	RiskUSDTolerancePct        float64  `json:"risk_usd_tolerance_pct,omitempty"`       // 实际风险允许超出risk_usd的百分比（默认0）
+	ValidationConcurrency      int      `json:"validation_concurrency,omitempty"`       // 交叉验证最大并发数（默认3）
+	IncludeSymbolStats         bool     `json:"include_symbol_stats,omitempty"`         // 在prompt中展示各币种历史表现
+	MaxFetchCandidates         int      `json:"max_fetch_candidates,omitempty"`         // 获取市场数据的候选币种上限（0表示全部）
+	MaxPromptCandidates        int      `json:"max_prompt_candidates,omitempty"`        // prompt中展示的候选币种上限（0表示与获取数量相同）
+	RequiredIndicators         []string `json:"required_indicators,omitempty"`          // 候选币种必须具备的指标（"vwap"/"rsi"/"macd"）
+	MaxMarginUsedPct           float64  `json:"max_margin_used_pct,omitempty"`          // 保证金使用率上限（%），超过时禁止新开仓
+	MaxDailyReentries          int      `json:"max_daily_reentries,omitempty"`          // 同一币种每天最多开仓次数（0表示不限制）
+	MinSharpeRatio             float64  `json:"min_sharpe_ratio,omitempty"`             // 夏普比率下限（负数，如-1.0），低于时禁止新开仓
+	FeeRatePct                 float64  `json:"fee_rate_pct,omitempty"`                 // 单边手续费率（%，如0.04）
+	MinTPFeeMultiple           float64  `json:"min_tp_fee_multiple,omitempty"`          // 止盈幅度须超过往返手续费的倍数（默认1）
+	MinRiskReward              float64  `json:"min_risk_reward,omitempty"`              // 开仓最低风险回报比（默认3.0）
+	RequireMACDMomentum        bool     `json:"require_macd_momentum,omitempty"`        // 开仓要求MACD动能方向一致（做多上行/做空下行）
+	IncludeValidationRules     bool     `json:"include_validation_rules,omitempty"`     // 在主模型system prompt中附加验证模型的否决规则
+
+	MinRiskRewardBySymbol map[string]float64 `json:"min_risk_reward_by_symbol,omitempty"` // 按币种覆盖的最低风险回报比（如 {"DOGEUSDT": 4}）
+	MinRewardR            float64            `json:"min_reward_r,omitempty"`              // 以当前价入场，止盈距离须≥N倍止损距离（0表示不检查）
+	SymbolAliases         map[string]string  `json:"symbol_aliases,omitempty"`            // 币种别名映射（如 {"XBTUSDT": "BTCUSDT"}）
+	MaxPositions          int                `json:"max_positions,omitempty"`             // 最多同时持有的币种数量（默认3）
+
+	HardMaxNotionalUSD float64 `json:"hard_max_notional_usd,omitempty"` // 单仓名义价值的绝对上限（USDT，如50000，0表示不限制）
+
+	PreserveDecisionOrder bool `json:"preserve_decision_order,omitempty"` // 保留模型给出的决策顺序（默认平仓→hold/wait→开仓按信心度排序）
+
+	MinOITopDeltaPct float64 `json:"min_oi_top_delta_pct,omitempty"` // OI Top持仓量1小时变化低于该百分比时，prompt中不标注OI_Top信号（0表示不过滤）
+
+	// AI调用重试配置（可选，主模型与验证模型分开配置）
+	PrimaryMaxRetries             int    `json:"primary_max_retries,omitempty"`              // 主模型最大尝试次数（默认3）
+	PrimaryRetryBackoffSeconds    int    `json:"primary_retry_backoff_seconds,omitempty"`    // 主模型重试退避秒数（默认2）
+	RetryUnparseableOutput        bool   `json:"retry_unparseable_output,omitempty"`         // 主模型输出无法解析出决策JSON时，要求只返回JSON重试一次
+	ValidationMaxRetries          int    `json:"validation_max_retries,omitempty"`           // 验证模型最大尝试次数（默认3）
+	ValidationRetryBackoffSeconds int    `json:"validation_retry_backoff_seconds,omitempty"` // 验证模型重试退避秒数（默认2）
+	ValidationFailurePolicy       string `json:"validation_failure_policy,omitempty"`        // 验证模型调用失败时: "reject"(默认) 或 "accept"
+	MaxConfidenceGap              int    `json:"max_confidence_gap,omitempty"`               // 验证模型评分与主模型信心度的最大差值（0表示不检查）
+	RequireValidationConfidence   bool   `json:"require_validation_confidence,omitempty"`    // 要求验证模型回答 "AGREE <0-100>" / "DISAGREE <0-100>"
+	ValidationConfidenceFloor     int    `json:"validation_confidence_floor,omitempty"`      // AGREE的最低信心度（默认60）
+
+	ValidatorWeights map[string]float64 `json:"validator_weights,omitempty"` // 验证模型投票权重（如 {"qwen": 1.5}，未设置时按历史准确率）
+	ValidationSuffix string             `json:"validation_suffix,omitempty"` // 验证通过后追加到决策理由的标注（默认" (Qwen验证通过)"）
+
+	// 历史表现分析配置（可选）
+	SharpeResampleMinutes int     `json:"sharpe_resample_minutes,omitempty"` // 夏普比率重采样窗口（分钟，0表示按周期计算）
+	BaseCurrency          string  `json:"base_currency,omitempty"`           // 账户计价货币（默认USDT）
+	ScratchBandPct        float64 `json:"scratch_band_pct,omitempty"`        // 打平区间（盈亏百分比，0表示关闭）
+	ScratchAsLoss         bool    `json:"scratch_as_loss,omitempty"`         // 盈亏比将打平交易按微小亏损计入
+	RoundDecimals         int     `json:"round_decimals,omitempty"`          // 日志金额类数值保留的小数位（0表示不取整）
+	MarkToMarketEquity    bool    `json:"mark_to_market_equity,omitempty"`   // 净值曲线按行情快照对持仓盯市
+	PeriodsPerYear        float64 `json:"periods_per_year,omitempty"`        // 每年的收益周期数（年化波动率用，0表示按重采样窗口推算）
+	ClassifyCloseReasons  bool    `json:"classify_close_reasons,omitempty"`  // 将"Strategy"平仓细分为 vwap_reversal / time_stop / manual
+	TimeStopMinutes       int     `json:"time_stop_minutes,omitempty"`       // 持仓达到该分钟数的平仓归为time_stop（0表示不判断）
+
+	RecordCandidateDetails bool   `json:"record_candidate_details,omitempty"` // 决策日志中记录候选币种的来源和评分
+	DecisionStore          string `json:"decision_store,omitempty"`           // 决策日志存储: "file"(默认，每周期一个JSON文件) 或 "sqlite"(单个.db文件)
+
+	HoldStreakInsightCycles int `json:"hold_streak_insight_cycles,omitempty"` // 平仓前连续hold达到该周期数时生成复盘洞察（0表示不分析）
+
+	DecisionWebhookURL string `json:"decision_webhook_url,omitempty"` // 每条决策记录保存后POST摘要到该URL（如Telegram/Discord转发服务，为空表示不通知）
+
+	MaxCoTChars   int  `json:"max_cot_chars,omitempty"`   // 决策日志中思维链的最大字符数（超出时保留首尾摘录，0表示不截断）
+	KeepFailedCoT bool `json:"keep_failed_cot,omitempty"` // 失败周期保留完整思维链
 }
 
 // LeverageConfig 杠杆配置
 type LeverageConfig struct {
 	BTCETHLeverage  int `json:"btc_eth_leverage"` // BTC和ETH的杠杆倍数（主账户建议5-50，子账户≤5）
 	AltcoinLeverage int `json:"altcoin_leverage"` // 山寨币的杠杆倍数（主账户建议5-20，子账户≤5）
+
+	// AI未给出杠杆时使用的默认值（可选，0表示不补全，超过上限时按上限）
+	DefaultBTCETHLeverage  int `json:"default_btc_eth_leverage,omitempty"`
+	DefaultAltcoinLeverage int `json:"default_altcoin_leverage,omitempty"`
+
+	// 各币种交易所允许的杠杆档位（可选，如 {"DOGEUSDT": [5, 10, 20]}），超出档位时向下取整
+	AllowedLeverage map[string][]int `json:"allowed_leverage,omitempty"`
+
+	// 按币种覆盖的杠杆上限（可选，如 {"SOLUSDT": 15}），未配置的币种按BTC/ETH与山寨币两档
+	MaxLeverageBySymbol map[string]int `json:"max_leverage_by_symbol,omitempty"`
+
+	// 回撤降杠杆（可选，%）：当前回撤达到该值时杠杆上限减半，回撤越深上限按比例越低，0表示不降杠杆
+	DeRiskDrawdownPct float64 `json:"de_risk_drawdown_pct,omitempty"`
 }
 
 // Config 总配置
@@ -191,6 +278,12 @@ func (c *Config) Validate() error {
 	if c.Leverage.AltcoinLeverage > 5 {
 		fmt.Printf("⚠️  警告: 山寨币杠杆设置为%dx，如果使用子账户可能会失败（子账户限制≤5x）\n", c.Leverage.AltcoinLeverage)
 	}
+	if c.Leverage.DefaultBTCETHLeverage > c.Leverage.BTCETHLeverage {
+		c.Leverage.DefaultBTCETHLeverage = c.Leverage.BTCETHLeverage
+	}
+	if c.Leverage.DefaultAltcoinLeverage > c.Leverage.AltcoinLeverage {
+		c.Leverage.DefaultAltcoinLeverage = c.Leverage.AltcoinLeverage
+	}
 
 	return nil
 }
@@ -0,0 +1,314 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"nofx/logger"
+	"nofx/market"
+	"nofx/mcp"
+	"os"
+	"sort"
+	"time"
+)
+
+// defaultBacktestBarInterval K线没有时间戳时相邻两根之间的默认间隔（与日内序列一致的3分钟）
+const defaultBacktestBarInterval = 3 * time.Minute
+
+// BacktestConfig 回测配置
+type BacktestConfig struct {
+	Client          *mcp.Client   // 回放时调用的主模型（离线评估时可使用桩模型）
+	InitialBalance  float64       // 初始资金（默认1000）
+	BTCETHLeverage  int           // BTC/ETH杠杆上限（默认5）
+	AltcoinLeverage int           // 山寨币杠杆上限（默认5）
+	BarInterval     time.Duration // K线没有FetchedAt时按该间隔推算时间（默认3分钟）
+	LogDir          string        // 回测决策日志目录（为空时使用临时目录，结束后删除）
+
+	// 其余决策参数（风险回报比、持仓数量等）沿用实盘的Context字段，为nil时使用默认值
+	Context *Context
+}
+
+// backtestPosition 回测中的模拟持仓
+type backtestPosition struct {
+	side       string
+	quantity   float64
+	entryPrice float64
+	leverage   int
+	margin     float64
+	stopLoss   float64
+	takeProfit float64
+	openedAt   time.Time
+}
+
+// RunBacktest 用历史行情回放决策流程：每根K线构建Context，调用cfg.Client获取决策，
+// 经normalizeDecisions/validateDecisions等同实盘的解析和验证后按该K线价格模拟成交，最后复用历史表现分析输出结果
+// 回测不做交叉验证和组合风控；持仓的止损/止盈在每根K线开始时按该K线价格检查
+func RunBacktest(candles map[string][]market.Data, cfg BacktestConfig) (*logger.PerformanceAnalysis, error) {
+	if cfg.Client == nil {
+		return nil, fmt.Errorf("回测需要提供模型客户端")
+	}
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("回测行情为空")
+	}
+	if cfg.InitialBalance <= 0 {
+		cfg.InitialBalance = 1000
+	}
+	if cfg.BTCETHLeverage <= 0 {
+		cfg.BTCETHLeverage = 5
+	}
+	if cfg.AltcoinLeverage <= 0 {
+		cfg.AltcoinLeverage = 5
+	}
+	if cfg.BarInterval <= 0 {
+		cfg.BarInterval = defaultBacktestBarInterval
+	}
+
+	logDir := cfg.LogDir
+	if logDir == "" {
+		dir, err := os.MkdirTemp("", "nofx_backtest_*")
+		if err != nil {
+			return nil, fmt.Errorf("创建回测日志目录失败: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		logDir = dir
+	}
+	decisionLogger := logger.NewDecisionLogger(logDir)
+
+	symbols := make([]string, 0, len(candles))
+	bars := 0
+	for symbol, series := range candles {
+		symbols = append(symbols, symbol)
+		if len(series) > bars {
+			bars = len(series)
+		}
+	}
+	sort.Strings(symbols)
+	start := time.Now().Add(-time.Duration(bars) * cfg.BarInterval)
+
+	balance := cfg.InitialBalance // 未占用为保证金的资金（含已实现盈亏）
+	positions := make(map[string]*backtestPosition)
+
+	for i := 0; i < bars; i++ {
+		// 1. 本根K线的行情（序列较短的币种到头后不再参与）
+		barTime := start.Add(time.Duration(i) * cfg.BarInterval)
+		marketDataMap := make(map[string]*market.Data)
+		for _, symbol := range symbols {
+			if i >= len(candles[symbol]) {
+				continue
+			}
+			data := candles[symbol][i]
+			data.Symbol = symbol
+			if !data.FetchedAt.IsZero() {
+				barTime = data.FetchedAt
+			}
+			marketDataMap[symbol] = &data
+		}
+
+		record := &logger.DecisionRecord{
+			Timestamp:  barTime,
+			MarketData: make(map[string]logger.MarketDataSnapshot),
+		}
+		for symbol, data := range marketDataMap {
+			record.MarketData[symbol] = logger.MarketDataSnapshot{
+				CurrentPrice: data.CurrentPrice,
+				CurrentVWAP:  data.CurrentVWAP,
+				CurrentRSI7:  data.CurrentRSI7,
+				CurrentMACD:  data.CurrentMACD,
+				FundingRate:  data.FundingRate,
+			}
+		}
+
+		// 2. 先按本根K线价格检查止损/止盈
+		for _, symbol := range symbols {
+			pos, ok := positions[symbol]
+			data := marketDataMap[symbol]
+			if !ok || data == nil {
+				continue
+			}
+			price := data.CurrentPrice
+			hitStop := pos.stopLoss > 0 && ((pos.side == "long" && price <= pos.stopLoss) || (pos.side == "short" && price >= pos.stopLoss))
+			hitTarget := pos.takeProfit > 0 && ((pos.side == "long" && price >= pos.takeProfit) || (pos.side == "short" && price <= pos.takeProfit))
+			if hitStop || hitTarget {
+				balance += closeBacktestPosition(pos, price)
+				delete(positions, symbol)
+				record.Decisions = append(record.Decisions, logger.DecisionAction{
+					Action: "close_" + pos.side, Symbol: symbol, Quantity: pos.quantity, Price: price, Timestamp: barTime, Success: true,
+				})
+			}
+		}
+
+		// 3. 构建Context并调用模型
+		ctx := newBacktestContext(cfg, i, start, barTime, marketDataMap, positions, balance, symbols)
+		record.AccountState = backtestAccountSnapshot(ctx.Account)
+		for _, pos := range ctx.Positions {
+			record.Positions = append(record.Positions, logger.PositionSnapshot{
+				Symbol: pos.Symbol, Side: pos.Side, PositionAmt: pos.Quantity, EntryPrice: pos.EntryPrice,
+				MarkPrice: pos.MarkPrice, UnrealizedProfit: pos.UnrealizedPnL, Leverage: float64(pos.Leverage),
+			})
+		}
+
+		response, err := cfg.Client.CallWithMessages(buildPrimarySystemPrompt(ctx), buildUserPrompt(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("回测第%d根K线调用模型失败: %w", i+1, err)
+		}
+		record.CoTTrace = extractCoTTrace(response)
+
+		fullDecision, err := parseFullDecisionResponse(response, ctx, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+		if err != nil {
+			// 决策未通过验证时本根K线不执行任何动作（与实盘一致）
+			record.ErrorMessage = err.Error()
+		} else {
+			decisions := orderDecisions(ctx, fullDecision.Decisions)
+			decisionJSON, _ := json.Marshal(decisions)
+			record.DecisionJSON = string(decisionJSON)
+			record.Success = true
+
+			// 4. 按本根K线价格模拟成交
+			for _, d := range decisions {
+				data := marketDataMap[d.Symbol]
+				if data == nil || data.CurrentPrice <= 0 {
+					continue
+				}
+				action := logger.DecisionAction{Action: d.Action, Symbol: d.Symbol, Leverage: d.Leverage, Price: data.CurrentPrice, Timestamp: barTime}
+
+				switch d.Action {
+				case "open_long", "open_short":
+					margin := d.PositionSizeUSD / float64(d.Leverage)
+					if _, held := positions[d.Symbol]; held {
+						action.Error = "已有持仓"
+					} else if margin > balance {
+						action.Error = fmt.Sprintf("可用资金不足: 需要保证金%.2f，可用%.2f", margin, balance)
+					} else {
+						pos := &backtestPosition{
+							side: sideOfAction(d.Action), quantity: d.PositionSizeUSD / data.CurrentPrice, entryPrice: data.CurrentPrice,
+							leverage: d.Leverage, margin: margin, stopLoss: d.StopLoss, takeProfit: d.TakeProfit, openedAt: barTime,
+						}
+						positions[d.Symbol] = pos
+						balance -= margin
+						action.Quantity = pos.quantity
+						action.Success = true
+					}
+				case "close_long", "close_short":
+					pos, held := positions[d.Symbol]
+					if !held || pos.side != sideOfAction(d.Action) {
+						action.Error = "没有对应持仓"
+						break
+					}
+					if d.ClosePercent > 0 && d.ClosePercent < 100 {
+						partial := *pos
+						partial.quantity = pos.quantity * d.ClosePercent / 100
+						partial.margin = pos.margin * d.ClosePercent / 100
+						balance += closeBacktestPosition(&partial, data.CurrentPrice)
+						pos.quantity -= partial.quantity
+						pos.margin -= partial.margin
+						action.ClosePercent = d.ClosePercent
+						action.Quantity = partial.quantity
+					} else {
+						balance += closeBacktestPosition(pos, data.CurrentPrice)
+						delete(positions, d.Symbol)
+						action.Quantity = pos.quantity
+					}
+					action.Success = true
+				default:
+					continue
+				}
+				record.Decisions = append(record.Decisions, action)
+			}
+		}
+
+		if err := decisionLogger.LogDecision(record); err != nil {
+			return nil, fmt.Errorf("记录回测决策失败: %w", err)
+		}
+	}
+
+	return decisionLogger.AnalyzePerformance(bars)
+}
+
+// newBacktestContext 按回测状态构建第step根K线的决策上下文
+func newBacktestContext(cfg BacktestConfig, step int, start, barTime time.Time, marketDataMap map[string]*market.Data,
+	positions map[string]*backtestPosition, balance float64, symbols []string) *Context {
+	ctx := &Context{}
+	if cfg.Context != nil {
+		copied := *cfg.Context
+		ctx = &copied
+	}
+	ctx.CurrentTime = barTime.Format("2006-01-02 15:04:05")
+	ctx.RuntimeMinutes = int(barTime.Sub(start).Minutes())
+	ctx.CallCount = step + 1
+	ctx.BTCETHLeverage = cfg.BTCETHLeverage
+	ctx.AltcoinLeverage = cfg.AltcoinLeverage
+	ctx.MarketDataMap = marketDataMap
+	ctx.OITopDataMap = make(map[string]*OITopData)
+	ctx.Positions = nil
+	ctx.CandidateCoins = []CandidateCoin{}
+
+	marginUsed, unrealized := 0.0, 0.0
+	for _, symbol := range symbols {
+		pos, ok := positions[symbol]
+		if !ok {
+			continue
+		}
+		markPrice := pos.entryPrice
+		if data := marketDataMap[symbol]; data != nil && data.CurrentPrice > 0 {
+			markPrice = data.CurrentPrice
+		}
+		pnl := backtestPnL(pos, markPrice)
+		marginUsed += pos.margin
+		unrealized += pnl
+		ctx.Positions = append(ctx.Positions, PositionInfo{
+			Symbol: symbol, Side: pos.side, EntryPrice: pos.entryPrice, MarkPrice: markPrice, Quantity: pos.quantity,
+			Leverage: pos.leverage, UnrealizedPnL: pnl, UnrealizedPnLPct: pnl / pos.margin * 100, MarginUsed: pos.margin,
+			UpdateTime: pos.openedAt.UnixMilli(), StopLoss: pos.stopLoss,
+		})
+	}
+	for _, symbol := range symbols {
+		if _, ok := marketDataMap[symbol]; ok {
+			ctx.CandidateCoins = append(ctx.CandidateCoins, CandidateCoin{Symbol: symbol, Sources: []string{"backtest"}})
+		}
+	}
+
+	equity := balance + marginUsed + unrealized
+	ctx.Account = AccountInfo{
+		TotalEquity:      equity,
+		AvailableBalance: balance,
+		TotalPnL:         equity - cfg.InitialBalance,
+		TotalPnLPct:      (equity - cfg.InitialBalance) / cfg.InitialBalance * 100,
+		MarginUsed:       marginUsed,
+		PositionCount:    len(ctx.Positions),
+	}
+	if equity > 0 {
+		ctx.Account.MarginUsedPct = marginUsed / equity * 100
+	}
+	return ctx
+}
+
+// backtestAccountSnapshot 将回测账户状态转换为日志快照
+func backtestAccountSnapshot(account AccountInfo) logger.AccountSnapshot {
+	return logger.AccountSnapshot{
+		TotalBalance:          account.TotalEquity,
+		AvailableBalance:      account.AvailableBalance,
+		TotalUnrealizedProfit: account.TotalEquity - account.AvailableBalance - account.MarginUsed,
+		PositionCount:         account.PositionCount,
+		MarginUsedPct:         account.MarginUsedPct,
+	}
+}
+
+// backtestPnL 按标记价格计算持仓盈亏
+func backtestPnL(pos *backtestPosition, price float64) float64 {
+	if pos.side == "short" {
+		return pos.quantity * (pos.entryPrice - price)
+	}
+	return pos.quantity * (price - pos.entryPrice)
+}
+
+// closeBacktestPosition 按价格平仓，返回释放回可用资金的金额（保证金+盈亏）
+func closeBacktestPosition(pos *backtestPosition, price float64) float64 {
+	return pos.margin + backtestPnL(pos, price)
+}
+
+// sideOfAction 返回开平仓动作的方向（long/short）
+func sideOfAction(action string) string {
+	if action == "open_short" || action == "close_short" {
+		return "short"
+	}
+	return "long"
+}
@@ -0,0 +1,70 @@
+package decision
+
+import (
+	"math"
+	"net/http"
+	"nofx/market"
+	"strings"
+	"testing"
+)
+
+func TestRunBacktestReplaysTwoSymbols(t *testing.T) {
+	// BTC climbs from 100 to 109, ETH falls from 200 to 191
+	candles := map[string][]market.Data{}
+	for i := 0; i < 10; i++ {
+		candles["BTCUSDT"] = append(candles["BTCUSDT"], market.Data{CurrentPrice: 100 + float64(i), CurrentVWAP: 99 + float64(i)})
+		candles["ETHUSDT"] = append(candles["ETHUSDT"], market.Data{CurrentPrice: 200 - float64(i), CurrentVWAP: 201 - float64(i)})
+	}
+
+	// Deterministic stub: open both on the first bar, close BTC on bar 5 and ETH on bar 8, wait otherwise
+	calls := 0
+	var prompts []string
+	client := newFakeClient(t, func(_, userPrompt string) (string, int) {
+		calls++
+		prompts = append(prompts, userPrompt)
+		switch calls {
+		case 1:
+			return `[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":500,"stop_loss":95,"take_profit":120,"reasoning":"above VWAP"},
+				{"symbol":"ETHUSDT","action":"open_short","leverage":5,"position_size_usd":500,"stop_loss":205,"take_profit":180,"reasoning":"below VWAP"}]`, http.StatusOK
+		case 5:
+			return `[{"symbol":"BTCUSDT","action":"close_long","reasoning":"take profit"}]`, http.StatusOK
+		case 8:
+			return `[{"symbol":"ETHUSDT","action":"close","reasoning":"take profit"}]`, http.StatusOK
+		}
+		return `[{"symbol":"BTCUSDT","action":"wait","reasoning":"no signal"}]`, http.StatusOK
+	})
+
+	analysis, err := RunBacktest(candles, BacktestConfig{Client: client, InitialBalance: 1000})
+	if err != nil {
+		t.Fatalf("RunBacktest failed: %v", err)
+	}
+	if calls != 10 {
+		t.Errorf("Expected one model call per bar, but got %d", calls)
+	}
+	if !strings.Contains(prompts[4], "BTCUSDT") || !strings.Contains(prompts[4], "104") {
+		t.Errorf("Expected the fifth prompt to carry the replayed BTC price, but got %s", prompts[4])
+	}
+
+	// BTC: 5 units bought at 100, sold at 104 => +20; ETH: 2.5 units shorted at 200, covered at 193 => +17.5
+	if analysis.TotalTrades != 2 || analysis.WinRate != 100 {
+		t.Fatalf("Expected 2 winning trades, but got %d trades at %.2f%%", analysis.TotalTrades, analysis.WinRate)
+	}
+	if btc := analysis.SymbolStats["BTCUSDT"]; btc == nil || math.Abs(btc.TotalPnL-20) > 1e-9 {
+		t.Errorf("Expected BTC PnL 20, but got %+v", btc)
+	}
+	if eth := analysis.SymbolStats["ETHUSDT"]; eth == nil || math.Abs(eth.TotalPnL-17.5) > 1e-9 {
+		t.Errorf("Expected ETH PnL 17.5, but got %+v", eth)
+	}
+	if len(analysis.UnclosedPositions) != 0 {
+		t.Errorf("Expected every position to be closed, but got %v", analysis.UnclosedPositions)
+	}
+
+	// Records carry the simulated bar times (3 minutes apart): BTC held 12 minutes, ETH 21 minutes,
+	// so positions were open for 21 of the 27 replayed minutes
+	if math.Abs(analysis.AvgHoldingMinutes-16.5) > 1e-9 {
+		t.Errorf("Expected an average holding time of 16.5 simulated minutes, but got %.4f", analysis.AvgHoldingMinutes)
+	}
+	if math.Abs(analysis.TimeInMarketPct-100*21.0/27) > 1e-9 {
+		t.Errorf("Expected %.4f%% time in market over the simulated span, but got %.4f", 100*21.0/27, analysis.TimeInMarketPct)
+	}
+}
@@ -2,12 +2,19 @@ package decision
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"nofx/market"
 	"nofx/mcp"
 	"nofx/pool"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,7 +30,8 @@ type PositionInfo struct {
 	UnrealizedPnLPct float64 `json:"unrealized_pnl_pct"`
 	LiquidationPrice float64 `json:"liquidation_price"`
 	MarginUsed       float64 `json:"margin_used"`
-	UpdateTime       int64   `json:"update_time"` // 持仓更新时间戳（毫秒）
+	UpdateTime       int64   `json:"update_time"`         // 持仓更新时间戳（毫秒）
+	StopLoss         float64 `json:"stop_loss,omitempty"` // 本地记录的止损价（如有）
 }
 
 // AccountInfo 账户信息
@@ -40,7 +48,8 @@ type AccountInfo struct {
 // CandidateCoin 候选币种（来自币种池）
 type CandidateCoin struct {
 	Symbol  string   `json:"symbol"`
-	Sources []string `json:"sources"` // 来源: "ai500" 和/或 "oi_top"
+	Sources []string `json:"sources"`         // 来源: "ai500" 和/或 "oi_top"
+	Score   float64  `json:"score,omitempty"` // AI500评分（仅来自ai500的币种有值）
 }
 
 // OITopData 持仓量增长Top数据（用于AI决策参考）
@@ -67,6 +76,117 @@ type Context struct {
 	BTCETHLeverage  int                     `json:"-"` // BTC/ETH杠杆倍数（从配置读取）
 	AltcoinLeverage int                     `json:"-"` // 山寨币杠杆倍数（从配置读取）
 	TradingInsights string                  `json:"-"` // 交易复盘洞察
+
+	IncludeLiquidationDistance bool    `json:"-"` // 是否在prompt中展示持仓距强平价的百分比（从配置读取）
+	IncludeMarketDataAge       bool    `json:"-"` // 是否在prompt中展示各币种市场数据距获取时的秒数（让模型对略旧的数据打折扣）
+	MaxPortfolioHeatPct        float64 `json:"-"` // 组合热度上限（止损全部触发时的总风险占净值百分比，0表示不限制）
+	MaxSymbolConcentrationPct  float64 `json:"-"` // 单币种名义价值占全部持仓的上限（百分比，0表示不限制）
+	SymbolConcentrationPolicy  string  `json:"-"` // 超过单币种集中度上限时: "block"(默认，拒绝开仓) 或 "warn"(仅记录trace)
+	UnheldHoldPolicy           string  `json:"-"` // 对未持仓币种的hold决策处理方式: "wait"(默认，转为wait) 或 "drop"(丢弃)
+	EmptyReasoningPolicy       string  `json:"-"` // 开仓缺少理由时的处理方式: "allow"(默认，不处理)、"flag"(记录trace) 或 "reject"(拒绝该开仓)
+	SizeRiskTolerancePct       float64 `json:"-"` // 按仓位和止损距离推算的风险与risk_usd允许的偏差（%，0表示不检查）
+	SizeRiskPolicy             string  `json:"-"` // 仓位与风险不一致时的处理方式: "flag"(默认，记录trace) 或 "reject"(拒绝该开仓)
+	EnforceRiskUSD             bool    `json:"-"` // 是否要求止损触发时的实际风险不超过AI声明的risk_usd
+	RiskUSDTolerancePct        float64 `json:"-"` // 实际风险允许超出risk_usd的百分比（0表示不允许超出）
+	ValidationConcurrency      int     `json:"-"` // 交叉验证的最大并发数（0表示使用默认值3）
+	IncludeSymbolStats         bool    `json:"-"` // 是否在prompt中展示各币种历史表现（最好/最差）
+	MaxFetchCandidates         int     `json:"-"` // 获取市场数据的候选币种上限（0表示全部）
+	MaxPromptCandidates        int     `json:"-"` // prompt中展示的候选币种上限（0表示与获取数量相同）
+
+	DefaultBTCETHLeverage  int `json:"-"` // AI未给出杠杆时BTC/ETH使用的默认杠杆（0表示不补全）
+	DefaultAltcoinLeverage int `json:"-"` // AI未给出杠杆时山寨币使用的默认杠杆（0表示不补全）
+
+	AllowedLeverage     map[string][]int `json:"-"` // 各币种交易所允许的杠杆档位（未配置的币种不限制）
+	MaxLeverageBySymbol map[string]int   `json:"-"` // 按币种覆盖的杠杆上限（未配置的币种按BTC/ETH与山寨币两档）
+	DeRiskDrawdownPct   float64          `json:"-"` // 回撤降杠杆：当前回撤达到该值时杠杆上限减半，按回撤比例线性下调（0表示不降杠杆）
+	CurrentDrawdownPct  float64          `json:"-"` // 当前净值相对峰值的回撤（%）
+
+	RequiredIndicators []string `json:"-"` // 候选币种必须具备的指标（"vwap"/"rsi"/"macd"，为空表示不检查）
+
+	MaxMarginUsedPct float64 `json:"-"` // 保证金使用率上限（%），超过时禁止新开仓（0表示不限制）
+
+	HardMaxNotionalUSD float64 `json:"-"` // 单仓名义价值的绝对上限（USDT，不随净值增长，0表示不限制）
+
+	MinSharpeRatio float64 `json:"-"` // 夏普比率下限（负数），历史夏普低于该值时禁止新开仓（0表示不启用）
+
+	MaxDailyReentries int            `json:"-"` // 同一币种每天最多开仓次数（0表示不限制）
+	OpensToday        map[string]int `json:"-"` // 今天各币种已开仓次数（从决策日志统计）
+
+	FeeRatePct       float64 `json:"-"` // 单边手续费率（%，如0.04），0表示不检查止盈是否覆盖手续费
+	MinTPFeeMultiple float64 `json:"-"` // 止盈幅度须超过往返手续费的倍数（0表示1倍）
+
+	DryRun bool `json:"-"` // 试运行：只调用主模型，跳过验证模型的交叉验证（回测和调试prompt时节省API调用）
+
+	PreserveDecisionOrder bool `json:"-"` // 保留模型给出的决策顺序（默认按平仓→hold/wait→开仓（信心度从高到低）排序）
+
+	MinOITopDeltaPct float64 `json:"-"` // OI Top持仓量1小时变化（绝对值，%）低于该值时不视为OI_Top信号，prompt中不标注（0表示不过滤）
+
+	PrimaryMaxRetries       int           `json:"-"` // 主模型调用的最大尝试次数（0表示默认3次）
+	PrimaryRetryBackoff     time.Duration `json:"-"` // 主模型重试的基础退避间隔，按次数指数增长并加随机抖动（0表示默认2秒）
+	RetryUnparseableOutput  bool          `json:"-"` // 主模型输出无法解析出决策JSON时，追加"只返回JSON数组"的指令重新请求一次（与网络重试无关）
+	ValidationMaxRetries    int           `json:"-"` // 验证模型调用的最大尝试次数（0表示默认3次）
+	ValidationRetryBackoff  time.Duration `json:"-"` // 验证模型重试的基础退避间隔（指数增长，0表示默认2秒）
+	ValidationFailurePolicy string        `json:"-"` // 验证模型调用失败时的处理: "reject"(默认，拒绝决策) 或 "accept"(采纳原决策)
+
+	MaxConfidenceGap int `json:"-"` // 验证模型信心度（"AGREE <0-100>"）与主模型信心度的最大允许差值（0表示不检查）
+
+	RequireValidationConfidence bool `json:"-"` // 要求验证模型回答 "AGREE <0-100>" 或 "DISAGREE <0-100>"，无法解析的回答视为DISAGREE
+	ValidationConfidenceFloor   int  `json:"-"` // AGREE的最低信心度，低于该值时拒绝决策（0表示默认60）
+
+	ValidatorWeights  map[string]float64 `json:"-"` // 验证模型投票权重（手动设置，优先于历史准确率）
+	ValidatorAccuracy map[string]float64 `json:"-"` // 各验证模型的历史准确率（0-1，未手动设置权重时用作权重）
+	ValidationQuorum  int                `json:"-"` // 开仓至少需要N个验证模型同意（0表示按加权多数）；调用失败按反对计
+	ValidationSuffix  string             `json:"-"` // 验证通过后追加到Reasoning的标注（空表示默认" (Qwen验证通过)"）
+
+	RequireMACDMomentum bool `json:"-"` // 开仓是否要求MACD动能方向一致（做多MACD上行，做空MACD下行）
+
+	IncludeValidationRules bool `json:"-"` // 是否在主模型system prompt中附加验证模型的否决规则
+
+	MaxPositions          int                `json:"-"` // 最多同时持有的币种数量（0表示默认3）
+	MinRiskReward         float64            `json:"-"` // 开仓最低风险回报比（0表示默认3.0）
+	MinRiskRewardBySymbol map[string]float64 `json:"-"` // 按币种覆盖的最低风险回报比（未配置的币种使用MinRiskReward）
+	MinRewardR            float64            `json:"-"` // 以当前价为入场价，止盈距离须≥N倍止损距离（0表示不检查）
+
+	CycleGuard *CycleGuard `json:"-"` // 决策周期最小间隔守卫（为nil表示不限制）
+
+	Strategy StrategyPrompt `json:"-"` // 交易策略的prompt模板（为nil表示默认的VWAP策略）
+
+	SymbolAliases map[string]string `json:"-"` // 币种别名 -> 标准名（如 "XBTUSDT" -> "BTCUSDT"），统一不同数据源的命名
+
+	CandidateCoverage CandidateCoverage `json:"-"` // 本周期候选币种各筛选阶段的数量（由fetchMarketDataForContext填充）
+}
+
+// CandidateCoverage 候选币种漏斗统计（不含仅因持仓而获取数据的币种）
+type CandidateCoverage struct {
+	Total           int `json:"total"`            // 候选币种总数
+	FromAI500       int `json:"from_ai500"`       // 来自AI500的数量
+	FromOITop       int `json:"from_oi_top"`      // 来自OI Top的数量（双重信号的币种两边都计入）
+	Considered      int `json:"considered"`       // 在获取上限内的数量
+	Fetched         int `json:"fetched"`          // 成功获取市场数据的数量
+	PassedLiquidity int `json:"passed_liquidity"` // 通过流动性过滤的数量
+	CompleteData    int `json:"complete_data"`    // 指标完整、最终可供决策的数量
+}
+
+// String 返回单行的漏斗摘要（用于日志）
+func (c CandidateCoverage) String() string {
+	return fmt.Sprintf("候选%d (AI500:%d OI_Top:%d) → 获取%d → 成功%d → 流动性通过%d → 数据完整%d",
+		c.Total, c.FromAI500, c.FromOITop, c.Considered, c.Fetched, c.PassedLiquidity, c.CompleteData)
+}
+
+// PredictCandidateCount 用最近window个周期（window<=0表示全部）数据完整的候选币种数的简单移动平均，
+// 预估下个周期可供决策的候选数量，供调度方预算token和耗时（没有历史时返回0）
+func PredictCandidateCount(history []CandidateCoverage, window int) float64 {
+	if window > 0 && len(history) > window {
+		history = history[len(history)-window:]
+	}
+	if len(history) == 0 {
+		return 0
+	}
+	total := 0
+	for _, coverage := range history {
+		total += coverage.CompleteData
+	}
+	return float64(total) / float64(len(history))
 }
 
 // Decision AI的交易决策
@@ -77,9 +197,12 @@ type Decision struct {
 	PositionSizeUSD float64 `json:"position_size_usd,omitempty"`
 	StopLoss        float64 `json:"stop_loss,omitempty"`
 	TakeProfit      float64 `json:"take_profit,omitempty"`
-	Confidence      int     `json:"confidence,omitempty"` // 信心度 (0-100)
-	RiskUSD         float64 `json:"risk_usd,omitempty"`   // 最大美元风险
+	Confidence      int     `json:"confidence,omitempty"`  // 信心度 (0-100)
+	RiskUSD         float64 `json:"risk_usd,omitempty"`    // 最大美元风险
+	EntryPrice      float64 `json:"entry_price,omitempty"` // 参考入场价（开仓时的当前市价，由系统根据行情填入；模型给出的值会被替换）
 	Reasoning       string  `json:"reasoning"`
+
+	ClosePercent float64 `json:"close_percent,omitempty"` // 平仓比例（仅平仓决策，1-100，0表示默认100即全部平仓）
 }
 
 // FullDecision AI的完整决策（包含思维链）
@@ -89,27 +212,222 @@ type FullDecision struct {
 	Decisions       []Decision `json:"decisions"`   // 具体决策列表
 	ValidationTrace []string   `json:"validation_trace"` // 交叉验证记录
 	Timestamp       time.Time  `json:"timestamp"`
+
+	MarketRegime string `json:"market_regime,omitempty"` // 决策时BTC所处的市场状态（up/down/range）
+
+	Rejected       []RejectedDecision `json:"rejected,omitempty"`        // 被验证/风控/交叉验证过滤掉的决策
+	ValidatorVotes []ValidatorVote    `json:"validator_votes,omitempty"` // 各验证模型对开仓决策的投票
+}
+
+// Validator 交叉验证模型（多个验证模型按权重投票）
+type Validator struct {
+	Name   string      // 模型名称（用于查找权重和历史准确率）
+	Client *mcp.Client // 模型客户端
+}
+
+// ValidatorVote 单个验证模型对一个开仓决策的投票（调用失败时不记录）
+type ValidatorVote struct {
+	Validator string `json:"validator"`
+	Symbol    string `json:"symbol"`
+	Action    string `json:"action"`
+	Agree     bool   `json:"agree"`
+}
+
+// RejectedDecision 被过滤掉的决策及原因（用于统计模型提出无效交易的频率）
+type RejectedDecision struct {
+	Decision Decision `json:"decision"`
+	Stage    string   `json:"stage"`  // 过滤阶段: "validation" / "risk" / "cross_validation"
+	Reason   string   `json:"reason"` // 原因分类（用于按原因统计）
+	Detail   string   `json:"detail"` // 详细说明（对应的trace或错误信息）
+}
+
+// rejectedBetween 对比某个过滤阶段前后的决策，返回被移除的决策；detail取该决策对应的trace
+func rejectedBetween(before, after []Decision, trace []string, stage, reason string) []RejectedDecision {
+	remaining := make(map[string]int)
+	for _, d := range after {
+		remaining[d.Symbol+" "+d.Action]++
+	}
+
+	var rejected []RejectedDecision
+	for _, d := range before {
+		key := d.Symbol + " " + d.Action
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		detail := ""
+		for _, t := range trace {
+			if strings.Contains(t, key+":") {
+				detail = t
+			}
+		}
+		rejected = append(rejected, RejectedDecision{Decision: d, Stage: stage, Reason: reason, Detail: detail})
+	}
+	return rejected
+}
+
+// ErrNonPositiveEquity 账户净值≤0（账户已爆仓或尚未入金），此时无法计算仓位上限和余额占比
+var ErrNonPositiveEquity = errors.New("账户净值必须大于0（账户已爆仓或未入金）")
+
+// ErrCycleTooSoon 距上次决策的时间短于配置的最小周期间隔
+var ErrCycleTooSoon = errors.New("距上次决策时间过短")
+
+// CycleGuard 记录上次决策时间，拒绝间隔过短的决策调用（防止交易循环误触发导致过度交易）
+type CycleGuard struct {
+	MinInterval time.Duration
+
+	mu           sync.Mutex
+	lastDecision time.Time
+	previous     time.Time // 本次放行前的上次决策时间（Release时恢复）
+}
+
+// NewCycleGuard 创建决策周期守卫，minInterval<=0时不限制
+func NewCycleGuard(minInterval time.Duration) *CycleGuard {
+	return &CycleGuard{MinInterval: minInterval}
+}
+
+// Allow 检查now距上次放行是否已超过最小间隔，放行时预占本次时间（并发调用不会同时放行）
+// 本次决策在调用模型前失败时应调用Release撤销，避免一次失败阻塞整个间隔
+func (g *CycleGuard) Allow(now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.MinInterval > 0 && !g.lastDecision.IsZero() {
+		if elapsed := now.Sub(g.lastDecision); elapsed < g.MinInterval {
+			return fmt.Errorf("%w: 距上次决策%v，最小间隔%v", ErrCycleTooSoon, elapsed.Round(time.Second), g.MinInterval)
+		}
+	}
+	g.previous = g.lastDecision
+	g.lastDecision = now
+	return nil
+}
+
+// Release 撤销now对应的放行，恢复上次决策时间（now已被后续放行覆盖时不处理；g为nil时不处理）
+func (g *CycleGuard) Release(now time.Time) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.lastDecision.Equal(now) {
+		g.lastDecision = g.previous
+	}
+}
+
+// Validate 校验交易上下文的结构完整性，返回发现的第一个问题
+func (ctx *Context) Validate() error {
+	if ctx.Account.TotalEquity <= 0 {
+		return fmt.Errorf("%w: %.2f", ErrNonPositiveEquity, ctx.Account.TotalEquity)
+	}
+	if ctx.BTCETHLeverage <= 0 || ctx.AltcoinLeverage <= 0 {
+		return fmt.Errorf("杠杆配置必须大于0: BTC/ETH=%d 山寨币=%d", ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	}
+
+	seen := make(map[string]bool)
+	for i, pos := range ctx.Positions {
+		if pos.Symbol == "" {
+			return fmt.Errorf("持仓 #%d 缺少币种", i+1)
+		}
+		if pos.Side != "long" && pos.Side != "short" {
+			return fmt.Errorf("持仓 #%d (%s) 方向无效: %q", i+1, pos.Symbol, pos.Side)
+		}
+		if seen[pos.Symbol] {
+			return fmt.Errorf("持仓 #%d 币种重复: %s", i+1, pos.Symbol)
+		}
+		seen[pos.Symbol] = true
+	}
+
+	if ctx.CandidateCoins == nil {
+		return fmt.Errorf("候选币种列表未初始化")
+	}
+	return nil
 }
 
 // GetFullDecision 获取AI的完整交易决策（包含双模型交叉验证）
 func GetFullDecision(ctx *Context, primaryClient *mcp.Client, secondaryClient *mcp.Client) (*FullDecision, error) {
+	return GetFullDecisionWithTieBreaker(ctx, primaryClient, secondaryClient, nil)
+}
+
+// GetFullDecisionWithTieBreaker 获取AI的完整交易决策，验证模型反对时由仲裁模型做最终判断（tieBreakerClient为nil表示不仲裁）
+func GetFullDecisionWithTieBreaker(ctx *Context, primaryClient, secondaryClient, tieBreakerClient *mcp.Client) (*FullDecision, error) {
+	validators := []Validator{{Name: "secondary", Client: secondaryClient}}
+	if tieBreakerClient == nil {
+		return getFullDecision(ctx, primaryClient, validators, nil)
+	}
+	return getFullDecision(ctx, primaryClient, validators, &Validator{Name: "tie_breaker", Client: tieBreakerClient})
+}
+
+// GetFullDecisionWithValidators 获取AI的完整交易决策，开仓决策由多个验证模型加权投票
+func GetFullDecisionWithValidators(ctx *Context, primaryClient *mcp.Client, validators []Validator) (*FullDecision, error) {
+	return getFullDecision(ctx, primaryClient, validators, nil)
+}
+
+// GetFullDecisionWithConsensus 获取AI的完整交易决策，开仓决策需至少ctx.ValidationQuorum个验证模型同意
+func GetFullDecisionWithConsensus(ctx *Context, primaryClient *mcp.Client, validatorClients []*mcp.Client) (*FullDecision, error) {
+	validators := make([]Validator, len(validatorClients))
+	for i, client := range validatorClients {
+		validators[i] = Validator{Name: fmt.Sprintf("validator_%d", i+1), Client: client}
+	}
+	return getFullDecision(ctx, primaryClient, validators, nil)
+}
+
+// strictJSONInstruction 主模型输出无法解析时追加到user prompt的格式指令
+const strictJSONInstruction = "\n\n# ⚠️ 格式要求\n你上一次的回答中没有可解析的决策JSON。请只返回JSON数组（如 [{\"symbol\": \"BTCUSDT\", \"action\": \"wait\", \"reasoning\": \"...\"}]），不要输出任何其他文字。"
+
+// getFullDecision 获取AI的完整交易决策：主模型提议，验证模型投票，被否决时可由仲裁模型复核
+func getFullDecision(ctx *Context, primaryClient *mcp.Client, validators []Validator, tieBreaker *Validator) (*FullDecision, error) {
+	// 调用模型前先校验上下文结构，避免浪费token（净值≤0时返回ErrNonPositiveEquity）
+	if err := ctx.Validate(); err != nil {
+		return nil, fmt.Errorf("交易上下文无效: %w", err)
+	}
+
+	// 间隔过短的调用直接拒绝，避免过度交易和API滥用；主模型成功响应之前失败时撤销本次放行
+	guardTime := time.Now()
+	if ctx.CycleGuard != nil {
+		if err := ctx.CycleGuard.Allow(guardTime); err != nil {
+			return nil, err
+		}
+	}
+
 	// 1. 为所有币种获取市场数据
 	if err := fetchMarketDataForContext(ctx); err != nil {
+		ctx.CycleGuard.Release(guardTime)
 		return nil, fmt.Errorf("获取市场数据失败: %w", err)
 	}
 
 	// 2. 构建 Prompt
-	systemPrompt := buildSystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	systemPrompt := buildPrimarySystemPrompt(ctx)
 	userPrompt := buildUserPrompt(ctx)
 
-	// 3. 调用主模型(DeepSeek)获取初步决策
-	primaryResponse, err := primaryClient.CallWithMessages(systemPrompt, userPrompt)
+	// 3. 调用主模型(DeepSeek)获取初步决策（限流/服务端错误按指数退避重试）
+	primaryPolicy := mcp.NewRetryPolicy(ctx.PrimaryMaxRetries, ctx.PrimaryRetryBackoff)
+	primaryResponse, retries, err := primaryClient.CallWithPolicy(systemPrompt, userPrompt, primaryPolicy)
 	if err != nil {
+		ctx.CycleGuard.Release(guardTime)
 		return nil, fmt.Errorf("调用主模型AI API失败: %w", err)
 	}
+	var retryTrace []string
+	if retries > 0 {
+		retryTrace = append(retryTrace, fmt.Sprintf("- 主模型调用: 临时错误重试%d次后成功", retries))
+	}
+
+	// 主模型只输出了文字、没有可解析的决策JSON时，用更严格的指令重新请求一次（最多一次，控制成本）
+	if _, extractErr := extractDecisions(primaryResponse); extractErr != nil && ctx.RetryUnparseableOutput {
+		log.Printf("⚠️  主模型输出无法解析（%v），要求只返回JSON重试一次", extractErr)
+		retryResponse, err := primaryClient.CallWithRetries(systemPrompt, userPrompt+strictJSONInstruction, primaryPolicy.MaxAttempts, primaryPolicy.BaseDelay)
+		if err != nil {
+			return nil, fmt.Errorf("调用主模型AI API失败（格式重试）: %w", err)
+		}
+		primaryResponse = retryResponse
+		retryTrace = append(retryTrace, fmt.Sprintf("- 格式重试: 主模型首次输出无法解析出决策JSON（%v），已要求只返回JSON数组重新请求", extractErr))
+	}
 
 	// 4. 解析主模型响应
 	primaryDecision, err := parseFullDecisionResponse(primaryResponse, ctx, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	if primaryDecision != nil && len(retryTrace) > 0 {
+		primaryDecision.ValidationTrace = append(retryTrace, primaryDecision.ValidationTrace...)
+	}
 	if err != nil {
 		// 即使解析失败，也返回思维链，方便调试
 		if primaryDecision != nil {
@@ -118,66 +436,762 @@ func GetFullDecision(ctx *Context, primaryClient *mcp.Client, secondaryClient *m
 		return primaryDecision, fmt.Errorf("解析主模型响应失败: %w", err)
 	}
 	primaryDecision.UserPrompt = userPrompt
+	primaryDecision.MarketRegime = marketRegime(ctx.MarketDataMap["BTCUSDT"])
+
+	// 5. 风控：组合热度上限（在交叉验证前裁剪，避免浪费验证调用）
+	validationTrace := primaryDecision.ValidationTrace
+
+	proposed := primaryDecision.Decisions
+	afterMargin, marginTrace := applyMarginUsageLimit(ctx, proposed)
+	validationTrace = append(validationTrace, marginTrace...)
+	primaryDecision.Rejected = append(primaryDecision.Rejected,
+		rejectedBetween(proposed, afterMargin, marginTrace, "risk", "保证金使用率过高")...)
+
+	afterSharpe, sharpeTrace := applySharpeFloor(ctx, afterMargin)
+	validationTrace = append(validationTrace, sharpeTrace...)
+	primaryDecision.Rejected = append(primaryDecision.Rejected,
+		rejectedBetween(afterMargin, afterSharpe, sharpeTrace, "risk", "夏普比率过低")...)
+
+	afterReentry, reentryTrace := applyDailyReentryCap(ctx, afterSharpe)
+	validationTrace = append(validationTrace, reentryTrace...)
+	primaryDecision.Rejected = append(primaryDecision.Rejected,
+		rejectedBetween(afterSharpe, afterReentry, reentryTrace, "risk", "当日重复开仓超限")...)
+
+	afterHeat, heatTrace := applyPortfolioHeatCap(ctx, afterReentry)
+	validationTrace = append(validationTrace, heatTrace...)
+	primaryDecision.Rejected = append(primaryDecision.Rejected,
+		rejectedBetween(afterReentry, afterHeat, heatTrace, "risk", "组合热度超限")...)
+
+	afterConcentration, concentrationTrace := applySymbolConcentrationCap(ctx, afterHeat)
+	validationTrace = append(validationTrace, concentrationTrace...)
+	primaryDecision.Rejected = append(primaryDecision.Rejected,
+		rejectedBetween(afterHeat, afterConcentration, concentrationTrace, "risk", "单币种集中度超限")...)
+
+	// 6. 执行交叉验证 (只对开仓决策)；试运行时跳过，直接采用主模型决策
+	if ctx.DryRun {
+		log.Println("🧪 试运行模式，跳过交叉验证")
+		primaryDecision.Decisions = orderDecisions(ctx, afterConcentration)
+		primaryDecision.ValidationTrace = append(validationTrace, dryRunValidationTrace)
+		primaryDecision.Timestamp = time.Now()
+		return primaryDecision, nil
+	}
+	log.Println("🤖 正在请求验证模型(Qwen)进行交叉验证...")
+	finalDecisions, crossTrace, votes := crossValidateWithValidators(ctx, afterConcentration, validators, tieBreaker)
+	primaryDecision.ValidatorVotes = votes
+	validationTrace = append(validationTrace, crossTrace...)
+	primaryDecision.Rejected = append(primaryDecision.Rejected,
+		rejectedBetween(afterConcentration, finalDecisions, crossTrace, "cross_validation", "交叉验证未通过")...)
+
+	primaryDecision.Decisions = orderDecisions(ctx, finalDecisions)
+	primaryDecision.ValidationTrace = validationTrace
+	primaryDecision.Timestamp = time.Now()
+
+	return primaryDecision, nil
+}
+
+// decisionPriority 决策执行优先级：平仓（降低风险）最先，其次hold/wait，开仓（增加风险）最后
+func decisionPriority(action string) int {
+	switch action {
+	case "close_long", "close_short":
+		return 0
+	case "hold", "wait":
+		return 1
+	case "open_long", "open_short":
+		return 2
+	default:
+		return 3
+	}
+}
+
+// orderDecisions 按执行优先级稳定排序决策，开仓决策按信心度从高到低；PreserveDecisionOrder时保持原顺序
+func orderDecisions(ctx *Context, decisions []Decision) []Decision {
+	if ctx.PreserveDecisionOrder || len(decisions) <= 1 {
+		return decisions
+	}
+
+	ordered := make([]Decision, len(decisions))
+	copy(ordered, decisions)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, pj := decisionPriority(ordered[i].Action), decisionPriority(ordered[j].Action)
+		if pi != pj {
+			return pi < pj
+		}
+		return pi == decisionPriority("open_long") && ordered[i].Confidence > ordered[j].Confidence
+	})
+	return ordered
+}
+
+// dryRunValidationTrace 试运行跳过交叉验证时记录的trace
+const dryRunValidationTrace = "(validation skipped)"
+
+// defaultValidationConcurrency 交叉验证的默认并发数
+const defaultValidationConcurrency = 3
+
+// validationResult 单个决策的交叉验证结果
+type validationResult struct {
+	decision Decision
+	accepted bool
+	failed   bool // 验证模型调用失败（accepted由失败策略决定，不计为投票）
+	trace    string
+}
+
+// crossValidateDecisions 使用单个验证模型对开仓决策进行交叉验证
+func crossValidateDecisions(ctx *Context, decisions []Decision, client *mcp.Client) ([]Decision, []string) {
+	finalDecisions, validationTrace, _ := crossValidateWithValidators(ctx, decisions, []Validator{{Client: client}}, nil)
+	return finalDecisions, validationTrace
+}
+
+// crossValidateWithValidators 使用一个或多个验证模型对开仓决策进行交叉验证（有界并发）
+// 多个验证模型时按权重投票，同意权重大于反对权重才采纳；结果按原始决策顺序汇总，保证ValidationTrace顺序确定
+// tieBreaker不为nil时，被验证模型明确反对（非调用失败）的决策交给仲裁模型复核，仲裁同意则采纳
+func crossValidateWithValidators(ctx *Context, decisions []Decision, validators []Validator, tieBreaker *Validator) ([]Decision, []string, []ValidatorVote) {
+	concurrency := ctx.ValidationConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultValidationConcurrency
+	}
+
+	results := make([][]validationResult, len(decisions))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, decision := range decisions {
+		// 对于非开仓决策 (close, hold, wait)，直接采纳
+		if decision.Action != "open_long" && decision.Action != "open_short" {
+			continue
+		}
+
+		results[i] = make([]validationResult, len(validators))
+		for j, validator := range validators {
+			wg.Add(1)
+			go func(i, j int, decision Decision, client *mcp.Client) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				results[i][j] = validateWithModel(ctx, decision, client)
+			}(i, j, decision, validator.Client)
+		}
+	}
+	wg.Wait()
 
-	// 5. 执行交叉验证 (只对开仓决策)
 	var finalDecisions []Decision
 	var validationTrace []string
+	var votes []ValidatorVote
+	for i, decision := range decisions {
+		if results[i] == nil {
+			finalDecisions = append(finalDecisions, decision)
+			continue
+		}
 
-	log.Println("🤖 正在请求验证模型(Qwen)进行交叉验证...")
+		var agreeWeight, disagreeWeight float64
+		agreeCount := 0
+		disagreed := false
+		accepted := decision
+		for j, result := range results[i] {
+			weight := validatorWeight(ctx, validators[j].Name)
+			trace := result.trace
+			if len(validators) > 1 {
+				trace = fmt.Sprintf("%s [%s 权重%.2f]", trace, validators[j].Name, weight)
+			}
+			validationTrace = append(validationTrace, trace)
+			log.Println(trace)
 
-	for _, decision := range primaryDecision.Decisions {
-		// 只对开仓决策进行二次验证
-		if decision.Action == "open_long" || decision.Action == "open_short" {
-			// 为验证模型构建专用prompt
-			validationPrompt := buildValidationPrompt(ctx, &decision)
-
-			// 调用验证模型
-			validationResponse, err := secondaryClient.CallWithMessages("", validationPrompt) // System prompt is empty for validation
-			if err != nil {
-				// 如果验证模型调用失败，为安全起见，拒绝该决策
-				trace := fmt.Sprintf("- 验证 %s %s: 失败 (API错误: %v)。决策被拒绝。", decision.Symbol, decision.Action, err)
-				validationTrace = append(validationTrace, trace)
-				log.Println(trace)
-				continue
+			if !result.failed {
+				votes = append(votes, ValidatorVote{Validator: validators[j].Name, Symbol: decision.Symbol, Action: decision.Action, Agree: result.accepted})
+				disagreed = disagreed || !result.accepted
+			}
+			// 共识模式下调用失败一律按反对计（即使ValidationFailurePolicy为"accept"）
+			if result.accepted && (!result.failed || ctx.ValidationQuorum <= 0) {
+				if agreeWeight == 0 {
+					accepted = result.decision
+				}
+				agreeWeight += weight
+				agreeCount++
+			} else {
+				disagreeWeight += weight
 			}
+		}
 
-			// 检查验证模型的响应
-			if strings.Contains(strings.ToUpper(validationResponse), "AGREE") {
-				// 验证通过
-				trace := fmt.Sprintf("- 验证 %s %s: 通过 (AGREE)", decision.Symbol, decision.Action)
-				validationTrace = append(validationTrace, trace)
-				log.Println(trace)
+		passed := agreeWeight > disagreeWeight
+		if ctx.ValidationQuorum > 0 {
+			passed = agreeCount >= ctx.ValidationQuorum
+		}
+		if len(validators) > 1 {
+			verdict := "拒绝"
+			if passed {
+				verdict = "通过"
+			}
+			trace := fmt.Sprintf("- 加权投票 %s %s: 同意%.2f vs 反对%.2f，%s", decision.Symbol, decision.Action, agreeWeight, disagreeWeight, verdict)
+			if ctx.ValidationQuorum > 0 {
+				trace = fmt.Sprintf("- 共识投票 %s %s: 同意%d/%d（法定票数%d），%s",
+					decision.Symbol, decision.Action, agreeCount, len(validators), ctx.ValidationQuorum, verdict)
+			}
+			validationTrace = append(validationTrace, trace)
+			log.Println(trace)
+		}
 
-				// 在Reasoning中加入验证信息
-				decision.Reasoning += " (Qwen验证通过)"
-				finalDecisions = append(finalDecisions, decision)
-			} else {
-				// 验证拒绝
-				trace := fmt.Sprintf("- 验证 %s %s: 拒绝 (DISAGREE)。原始原因: %s", decision.Symbol, decision.Action, decision.Reasoning)
-				validationTrace = append(validationTrace, trace)
-				log.Println(trace)
+		// 验证模型反对时交给仲裁模型复核
+		if !passed && disagreed && tieBreaker != nil {
+			result := validateWithModel(ctx, decision, tieBreaker.Client)
+			verdict := "反对"
+			if result.accepted {
+				verdict = "同意"
+			}
+			trace := fmt.Sprintf("- 仲裁 %s %s: 主模型提议，验证模型反对，仲裁模型(%s)%s %s",
+				decision.Symbol, decision.Action, tieBreaker.Name, verdict, strings.TrimPrefix(result.trace, "- "))
+			validationTrace = append(validationTrace, trace)
+			log.Println(trace)
+
+			if !result.failed {
+				votes = append(votes, ValidatorVote{Validator: tieBreaker.Name, Symbol: decision.Symbol, Action: decision.Action, Agree: result.accepted})
+			}
+			if result.accepted {
+				passed = true
+				accepted = result.decision
 			}
+		}
+		if passed {
+			finalDecisions = append(finalDecisions, accepted)
+		}
+	}
+	return finalDecisions, validationTrace, votes
+}
+
+// validatorWeight 返回验证模型的投票权重：手动设置优先，其次为历史准确率，默认1
+func validatorWeight(ctx *Context, name string) float64 {
+	if weight, ok := ctx.ValidatorWeights[name]; ok {
+		return weight
+	}
+	if accuracy, ok := ctx.ValidatorAccuracy[name]; ok && accuracy > 0 {
+		return accuracy
+	}
+	return 1
+}
+
+// defaultValidationSuffix 验证通过后追加到Reasoning的默认标注
+const defaultValidationSuffix = " (Qwen验证通过)"
+
+// annotateValidated 在Reasoning末尾追加验证标注；已带有该标注时不重复追加（同一决策可能被多次验证或重复记录）
+func annotateValidated(reasoning, suffix string) string {
+	if suffix == "" {
+		suffix = defaultValidationSuffix
+	}
+	if strings.HasSuffix(reasoning, suffix) {
+		return reasoning
+	}
+	return reasoning + suffix
+}
+
+// validateWithModel 调用验证模型验证单个开仓决策
+func validateWithModel(ctx *Context, decision Decision, client *mcp.Client) validationResult {
+	// 为验证模型构建专用prompt
+	validationPrompt := strategyFor(ctx).ValidationPrompt(ctx, &decision)
+
+	// 调用验证模型（限流/服务端错误按指数退避重试，trace中注明重试次数）
+	validationResponse, retries, err := client.CallWithPolicy("", validationPrompt, mcp.NewRetryPolicy(ctx.ValidationMaxRetries, ctx.ValidationRetryBackoff)) // System prompt is empty for validation
+	result := judgeValidationResponse(ctx, decision, validationResponse, err)
+	if retries > 0 {
+		result.trace += fmt.Sprintf("（API重试%d次）", retries)
+	}
+	return result
+}
+
+// judgeValidationResponse 根据验证模型的回答（或调用错误）判断开仓决策是否通过
+func judgeValidationResponse(ctx *Context, decision Decision, validationResponse string, err error) validationResult {
+	if err != nil {
+		if ctx.ValidationFailurePolicy == "accept" {
+			return validationResult{
+				decision: decision,
+				accepted: true,
+				failed:   true,
+				trace:    fmt.Sprintf("- 验证 %s %s: 失败 (API错误: %v)。按配置采纳原决策。", decision.Symbol, decision.Action, err),
+			}
+		}
+		// 默认情况下验证模型调用失败时，为安全起见，拒绝该决策
+		return validationResult{
+			decision: decision,
+			failed:   true,
+			trace:    fmt.Sprintf("- 验证 %s %s: 失败 (API错误: %v)。决策被拒绝。", decision.Symbol, decision.Action, err),
+		}
+	}
+
+	// 验证模型信心度（"AGREE <0-100>"）与主模型信心度差距过大时，即使回答AGREE也视为分歧
+	if ctx.MaxConfidenceGap > 0 && decision.Confidence > 0 {
+		if _, score, ok := parseValidationVerdict(validationResponse); ok {
+			gap := decision.Confidence - score
+			if gap < 0 {
+				gap = -gap
+			}
+			if gap > ctx.MaxConfidenceGap {
+				return validationResult{
+					decision: decision,
+					trace: fmt.Sprintf("- 验证 %s %s: 拒绝 (信心度分歧: 主模型%d 验证模型%d，差值%d > %d)",
+						decision.Symbol, decision.Action, decision.Confidence, score, gap, ctx.MaxConfidenceGap),
+				}
+			}
+		}
+	}
+
+	if ctx.RequireValidationConfidence {
+		return judgeValidationConfidence(ctx, decision, validationResponse)
+	}
+
+	// 检查验证模型的响应（"DISAGREE"本身包含"AGREE"，需先排除）
+	verdict := strings.ToUpper(validationResponse)
+	if strings.Contains(verdict, "AGREE") && !strings.Contains(verdict, "DISAGREE") {
+		// 验证通过，在Reasoning中加入验证信息
+		trace := fmt.Sprintf("- 验证 %s %s: 通过 (AGREE)", decision.Symbol, decision.Action)
+		decision.Reasoning = annotateValidated(decision.Reasoning, ctx.ValidationSuffix)
+		return validationResult{decision: decision, accepted: true, trace: trace}
+	}
+
+	// 验证拒绝
+	return validationResult{
+		decision: decision,
+		trace:    fmt.Sprintf("- 验证 %s %s: 拒绝 (DISAGREE)。原始原因: %s", decision.Symbol, decision.Action, decision.Reasoning),
+	}
+}
+
+// defaultValidationConfidenceFloor AGREE的默认最低信心度
+const defaultValidationConfidenceFloor = 60
+
+// validationVerdictPattern 匹配带信心度的验证结论，如 "AGREE 80" 或 "DISAGREE: 65"
+var validationVerdictPattern = regexp.MustCompile(`(?i)\b(AGREE|DISAGREE)\s*[:：]?\s*(\d{1,3})\b`)
+
+// parseValidationVerdict 从验证模型回答中提取结论和0-100的信心度
+func parseValidationVerdict(response string) (agree bool, confidence int, ok bool) {
+	match := validationVerdictPattern.FindStringSubmatch(response)
+	if match == nil {
+		return false, 0, false
+	}
+	confidence, err := strconv.Atoi(match[2])
+	if err != nil || confidence > 100 {
+		return false, 0, false
+	}
+	return strings.EqualFold(match[1], "AGREE"), confidence, true
+}
+
+// judgeValidationConfidence 按带信心度的验证结论判断决策：AGREE且信心度不低于下限才通过，无法解析的回答视为DISAGREE
+func judgeValidationConfidence(ctx *Context, decision Decision, response string) validationResult {
+	floor := ctx.ValidationConfidenceFloor
+	if floor <= 0 {
+		floor = defaultValidationConfidenceFloor
+	}
+
+	agree, confidence, ok := parseValidationVerdict(response)
+	switch {
+	case !ok:
+		return validationResult{
+			decision: decision,
+			trace:    fmt.Sprintf("- 验证 %s %s: 拒绝 (无法解析验证结论，按DISAGREE处理): %q", decision.Symbol, decision.Action, strings.TrimSpace(response)),
+		}
+	case !agree:
+		return validationResult{
+			decision: decision,
+			trace: fmt.Sprintf("- 验证 %s %s: 拒绝 (DISAGREE, 信心度%d)。原始原因: %s",
+				decision.Symbol, decision.Action, confidence, decision.Reasoning),
+		}
+	case confidence < floor:
+		return validationResult{
+			decision: decision,
+			trace: fmt.Sprintf("- 验证 %s %s: 拒绝 (AGREE, 信心度%d低于下限%d)",
+				decision.Symbol, decision.Action, confidence, floor),
+		}
+	}
+
+	decision.Reasoning = annotateValidated(decision.Reasoning, ctx.ValidationSuffix)
+	return validationResult{
+		decision: decision,
+		accepted: true,
+		trace:    fmt.Sprintf("- 验证 %s %s: 通过 (AGREE, 信心度%d)", decision.Symbol, decision.Action, confidence),
+	}
+}
+
+// PortfolioHeat 计算组合热度：所有止损同时触发时的总美元风险（现有持仓 + 待开仓决策）
+func PortfolioHeat(positions []PositionInfo, decisions []Decision) float64 {
+	return portfolioHeat(positions, decisions, nil)
+}
+
+// portfolioHeat 计算组合热度，marketData用于获取待开仓决策的入场价（可为nil）
+func portfolioHeat(positions []PositionInfo, decisions []Decision, marketData map[string]*market.Data) float64 {
+	heat := 0.0
+	for _, pos := range positions {
+		heat += positionRiskUSD(pos)
+	}
+	for _, d := range decisions {
+		if d.Action != "open_long" && d.Action != "open_short" {
+			continue
+		}
+		entryPrice := 0.0
+		if data, ok := marketData[d.Symbol]; ok && data != nil {
+			entryPrice = data.CurrentPrice
+		}
+		heat += openRiskUSD(d, entryPrice)
+	}
+	return heat
+}
+
+// positionRiskUSD 计算单个持仓在止损触发时的美元风险
+// 没有止损记录时，以占用保证金作为最大风险（即强平损失）
+func positionRiskUSD(pos PositionInfo) float64 {
+	if pos.StopLoss <= 0 || pos.MarkPrice <= 0 {
+		return pos.MarginUsed
+	}
+	risk := 0.0
+	if pos.Side == "short" {
+		risk = (pos.StopLoss - pos.MarkPrice) * pos.Quantity
+	} else {
+		risk = (pos.MarkPrice - pos.StopLoss) * pos.Quantity
+	}
+	if risk < 0 {
+		return 0 // 止损已锁定利润
+	}
+	return risk
+}
+
+// ComputeRiskUSD 按仓位和止损距离推算开仓决策在止损触发时的美元风险: 仓位 × |入场价-止损| / 入场价
+// 入场价、止损或仓位缺失时返回0
+func ComputeRiskUSD(d *Decision, entryPrice float64) float64 {
+	if entryPrice <= 0 || d.StopLoss <= 0 || d.PositionSizeUSD <= 0 {
+		return 0
+	}
+	return d.PositionSizeUSD * math.Abs(entryPrice-d.StopLoss) / entryPrice
+}
+
+// openRiskUSD 计算待开仓决策在止损触发时的美元风险
+// 入场价未知时，退回使用AI声明的risk_usd，再退回使用保证金
+func openRiskUSD(d Decision, entryPrice float64) float64 {
+	if entryPrice > 0 && d.StopLoss > 0 {
+		distance := entryPrice - d.StopLoss
+		if d.Action == "open_short" {
+			distance = d.StopLoss - entryPrice
+		}
+		if distance < 0 {
+			distance = 0
+		}
+		return d.PositionSizeUSD * distance / entryPrice
+	}
+	if d.RiskUSD > 0 {
+		return d.RiskUSD
+	}
+	if d.Leverage > 0 {
+		return d.PositionSizeUSD / float64(d.Leverage)
+	}
+	return d.PositionSizeUSD
+}
+
+// applyPortfolioHeatCap 组合热度超过上限时，按顺序裁剪开仓决策
+func applyPortfolioHeatCap(ctx *Context, decisions []Decision) ([]Decision, []string) {
+	if ctx.MaxPortfolioHeatPct <= 0 || ctx.Account.TotalEquity <= 0 {
+		return decisions, nil
+	}
+	maxHeat := ctx.Account.TotalEquity * ctx.MaxPortfolioHeatPct / 100
+
+	// 本周期将被平仓的持仓不计入热度
+	closing := make(map[string]bool)
+	for _, d := range decisions {
+		if d.Action == "close_long" || d.Action == "close_short" {
+			closing[d.Symbol+"_"+strings.TrimPrefix(d.Action, "close_")] = true
+		}
+	}
+	var remaining []PositionInfo
+	for _, pos := range ctx.Positions {
+		if !closing[pos.Symbol+"_"+pos.Side] {
+			remaining = append(remaining, pos)
+		}
+	}
+	heat := portfolioHeat(remaining, nil, nil)
+
+	var kept []Decision
+	var trace []string
+	for _, d := range decisions {
+		if d.Action != "open_long" && d.Action != "open_short" {
+			kept = append(kept, d)
+			continue
+		}
+		risk := portfolioHeat(nil, []Decision{d}, ctx.MarketDataMap)
+		if heat+risk > maxHeat {
+			t := fmt.Sprintf("- 风控 %s %s: 组合热度超限 (%.2f + %.2f > %.2f USDT，上限为净值的%.1f%%)。决策被裁剪。",
+				d.Symbol, d.Action, heat, risk, maxHeat, ctx.MaxPortfolioHeatPct)
+			trace = append(trace, t)
+			log.Println(t)
+			continue
+		}
+		heat += risk
+		kept = append(kept, d)
+	}
+	return kept, trace
+}
+
+// SymbolConcentration 计算各币种名义价值占全部持仓名义价值的百分比（同一币种的多空仓位合并计算）
+func SymbolConcentration(positions []PositionInfo) map[string]float64 {
+	notional := make(map[string]float64)
+	total := 0.0
+	for _, pos := range positions {
+		value := positionNotional(pos)
+		notional[pos.Symbol] += value
+		total += value
+	}
+
+	shares := make(map[string]float64, len(notional))
+	for symbol, value := range notional {
+		if total > 0 {
+			shares[symbol] = value / total * 100
 		} else {
-			// 对于非开仓决策 (close, hold, wait)，直接采纳
-			finalDecisions = append(finalDecisions, decision)
+			shares[symbol] = 0
 		}
 	}
+	return shares
+}
 
-	primaryDecision.Decisions = finalDecisions
-	primaryDecision.ValidationTrace = validationTrace
-	primaryDecision.Timestamp = time.Now()
+// positionNotional 持仓名义价值（优先使用标记价格，缺失时使用开仓价）
+func positionNotional(pos PositionInfo) float64 {
+	price := pos.MarkPrice
+	if price <= 0 {
+		price = pos.EntryPrice
+	}
+	return math.Abs(pos.Quantity) * price
+}
 
-	return primaryDecision, nil
+// applySymbolConcentrationCap 开仓后单个币种名义价值占比超过上限时拒绝（或仅警告）该开仓
+// 只持有一个币种时占比必然为100%，此时不检查
+func applySymbolConcentrationCap(ctx *Context, decisions []Decision) ([]Decision, []string) {
+	if ctx.MaxSymbolConcentrationPct <= 0 {
+		return decisions, nil
+	}
+	warnOnly := ctx.SymbolConcentrationPolicy == "warn"
+
+	// 本周期将被平仓的持仓不计入
+	closing := make(map[string]bool)
+	for _, d := range decisions {
+		if d.Action == "close_long" || d.Action == "close_short" {
+			closing[d.Symbol+"_"+strings.TrimPrefix(d.Action, "close_")] = true
+		}
+	}
+	notional := make(map[string]float64)
+	total := 0.0
+	for _, pos := range ctx.Positions {
+		if !closing[pos.Symbol+"_"+pos.Side] {
+			value := positionNotional(pos)
+			notional[pos.Symbol] += value
+			total += value
+		}
+	}
+
+	var kept []Decision
+	var trace []string
+	for _, d := range decisions {
+		if d.Action != "open_long" && d.Action != "open_short" {
+			kept = append(kept, d)
+			continue
+		}
+		symbolValue := notional[d.Symbol] + d.PositionSizeUSD
+		newTotal := total + d.PositionSizeUSD
+		if newTotal <= 0 || symbolValue >= newTotal {
+			// 只持有该币种，集中度无意义
+			notional[d.Symbol] = symbolValue
+			total = newTotal
+			kept = append(kept, d)
+			continue
+		}
+		share := symbolValue / newTotal * 100
+		if share > ctx.MaxSymbolConcentrationPct {
+			if warnOnly {
+				t := fmt.Sprintf("- 风控 %s %s: 开仓后该币种占持仓名义价值%.1f%%，超过上限%.1f%%（仅警告）。",
+					d.Symbol, d.Action, share, ctx.MaxSymbolConcentrationPct)
+				trace = append(trace, t)
+				log.Println(t)
+			} else {
+				t := fmt.Sprintf("- 风控 %s %s: 单币种集中度超限 (开仓后占持仓名义价值%.1f%% > %.1f%%)。决策被拒绝。",
+					d.Symbol, d.Action, share, ctx.MaxSymbolConcentrationPct)
+				trace = append(trace, t)
+				log.Println(t)
+				continue
+			}
+		}
+		notional[d.Symbol] = symbolValue
+		total = newTotal
+		kept = append(kept, d)
+	}
+	return kept, trace
+}
+
+// marginUsageExceeded 保证金使用率是否超过配置上限
+func marginUsageExceeded(ctx *Context) bool {
+	return ctx.MaxMarginUsedPct > 0 && ctx.Account.MarginUsedPct > ctx.MaxMarginUsedPct
+}
+
+// applyMarginUsageLimit 保证金使用率超限时禁止所有新开仓，平仓/持有不受影响
+func applyMarginUsageLimit(ctx *Context, decisions []Decision) ([]Decision, []string) {
+	if !marginUsageExceeded(ctx) {
+		return decisions, nil
+	}
+
+	var kept []Decision
+	var trace []string
+	for _, d := range decisions {
+		if d.Action == "open_long" || d.Action == "open_short" {
+			t := fmt.Sprintf("- 风控 %s %s: 保证金使用率过高 (%.1f%% > %.1f%%)。禁止新开仓。",
+				d.Symbol, d.Action, ctx.Account.MarginUsedPct, ctx.MaxMarginUsedPct)
+			trace = append(trace, t)
+			log.Println(t)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept, trace
+}
+
+// performanceSharpe 从历史表现分析中提取夏普比率（未提供时ok为false）
+func performanceSharpe(ctx *Context) (sharpe float64, ok bool) {
+	if ctx.Performance == nil {
+		return 0, false
+	}
+	var perfData struct {
+		SharpeRatio *float64 `json:"sharpe_ratio"`
+	}
+	jsonData, err := json.Marshal(ctx.Performance)
+	if err != nil || json.Unmarshal(jsonData, &perfData) != nil || perfData.SharpeRatio == nil {
+		return 0, false
+	}
+	return *perfData.SharpeRatio, true
+}
+
+// sharpeBelowFloor 历史夏普比率是否低于配置的下限
+func sharpeBelowFloor(ctx *Context) bool {
+	if ctx.MinSharpeRatio >= 0 {
+		return false
+	}
+	sharpe, ok := performanceSharpe(ctx)
+	return ok && sharpe < ctx.MinSharpeRatio
+}
+
+// applySharpeFloor 历史夏普比率低于下限时禁止所有新开仓，平仓/持有不受影响
+func applySharpeFloor(ctx *Context, decisions []Decision) ([]Decision, []string) {
+	if !sharpeBelowFloor(ctx) {
+		return decisions, nil
+	}
+	sharpe, _ := performanceSharpe(ctx)
+	log.Printf("⚠️  夏普比率%.2f低于下限%.2f，本周期禁止新开仓", sharpe, ctx.MinSharpeRatio)
+
+	var kept []Decision
+	var trace []string
+	for _, d := range decisions {
+		if d.Action == "open_long" || d.Action == "open_short" {
+			t := fmt.Sprintf("- 风控 %s %s: 夏普比率过低 (%.2f < %.2f)。禁止新开仓。",
+				d.Symbol, d.Action, sharpe, ctx.MinSharpeRatio)
+			trace = append(trace, t)
+			log.Println(t)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept, trace
+}
+
+// applyDailyReentryCap 同一币种当天开仓次数达到上限后禁止再次开仓（含本批次内的开仓），平仓/持有不受影响
+func applyDailyReentryCap(ctx *Context, decisions []Decision) ([]Decision, []string) {
+	if ctx.MaxDailyReentries <= 0 {
+		return decisions, nil
+	}
+
+	opens := make(map[string]int)
+	for symbol, count := range ctx.OpensToday {
+		opens[symbol] = count
+	}
+
+	var kept []Decision
+	var trace []string
+	for _, d := range decisions {
+		if d.Action == "open_long" || d.Action == "open_short" {
+			if opens[d.Symbol] >= ctx.MaxDailyReentries {
+				t := fmt.Sprintf("- 风控 %s %s: 今日已开仓%d次 (上限%d)。禁止再次开仓。",
+					d.Symbol, d.Action, opens[d.Symbol], ctx.MaxDailyReentries)
+				trace = append(trace, t)
+				log.Println(t)
+				continue
+			}
+			opens[d.Symbol]++
+		}
+		kept = append(kept, d)
+	}
+	return kept, trace
+}
+
+// ValidationRules 返回验证模型用来否决开仓决策的VWAP策略核心规则
+func ValidationRules() string {
+	var sb strings.Builder
+	sb.WriteString("# VWAP策略核心规则\n")
+	sb.WriteString("- 做多信号: `价格 > VWAP`，且 `RSI < 70`，`MACD > 0`。\n")
+	sb.WriteString("- 做空信号: `价格 < VWAP`，且 `RSI > 30`，`MACD < 0`。\n")
+	return sb.String()
+}
+
+// StrategyPrompt 交易策略的prompt模板：主模型的system prompt和验证模型的复核prompt
+// 不同策略（VWAP、EMA交叉、布林带均值回归等）实现该接口后通过Context.Strategy注入，无需修改引擎
+type StrategyPrompt interface {
+	SystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int) string
+	ValidationPrompt(ctx *Context, decision *Decision) string
+}
+
+// VWAPStrategy 默认的VWAP日内趋势策略
+type VWAPStrategy struct{}
+
+// SystemPrompt 构建VWAP策略的system prompt
+func (VWAPStrategy) SystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int) string {
+	return buildSystemPrompt(accountEquity, btcEthLeverage, altcoinLeverage)
+}
+
+// ValidationPrompt 构建按VWAP规则复核决策的prompt
+func (VWAPStrategy) ValidationPrompt(ctx *Context, decision *Decision) string {
+	return buildValidationPrompt(ctx, decision)
+}
+
+// strategyFor 返回上下文配置的策略（未配置时为VWAP策略）
+func strategyFor(ctx *Context) StrategyPrompt {
+	if ctx.Strategy != nil {
+		return ctx.Strategy
+	}
+	return VWAPStrategy{}
+}
+
+// buildPrimarySystemPrompt 构建主模型的system prompt，按配置附加验证模型的否决规则
+func buildPrimarySystemPrompt(ctx *Context) string {
+	systemPrompt := strategyFor(ctx).SystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	if len(ctx.MaxLeverageBySymbol) > 0 {
+		symbols := make([]string, 0, len(ctx.MaxLeverageBySymbol))
+		for symbol := range ctx.MaxLeverageBySymbol {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+		var caps []string
+		for _, symbol := range symbols {
+			caps = append(caps, fmt.Sprintf("%s 不超过 %dx", symbol, ctx.MaxLeverageBySymbol[symbol]))
+		}
+		systemPrompt += fmt.Sprintf("**币种杠杆上限**（优先于上面的杠杆规则）: %s。\n\n", strings.Join(caps, ", "))
+	}
+	if !ctx.IncludeValidationRules {
+		return systemPrompt
+	}
+
+	var sb strings.Builder
+	sb.WriteString(systemPrompt)
+	sb.WriteString("\n# ✅ 验证模型否决规则\n\n")
+	sb.WriteString("你的每个开仓决策都会由验证模型按以下规则复核，不满足规则的开仓会被直接否决。请只提出满足这些规则的开仓：\n\n")
+	sb.WriteString(ValidationRules())
+	return sb.String()
 }
 
 // buildValidationPrompt 为验证模型构建专用的prompt
 func buildValidationPrompt(ctx *Context, decision *Decision) string {
 	var sb strings.Builder
 	sb.WriteString("你是一个严谨的交易策略验证助手。请根据提供的VWAP策略规则和市场数据，判断以下交易决策是否合理。")
-	sb.WriteString("请只回答 'AGREE' 或 'DISAGREE'。\n\n")
-	sb.WriteString("# VWAP策略核心规则\n")
-	sb.WriteString("- 做多信号: `价格 > VWAP`，且 `RSI < 70`，`MACD > 0`。\n")
-	sb.WriteString("- 做空信号: `价格 < VWAP`，且 `RSI > 30`，`MACD < 0`。\n\n")
+	if ctx.RequireValidationConfidence {
+		sb.WriteString("请回答 'AGREE <0-100>' 或 'DISAGREE <0-100>'，数字为你对该判断的信心度。\n\n")
+	} else {
+		sb.WriteString("请只回答 'AGREE' 或 'DISAGREE'。\n\n")
+	}
+	sb.WriteString(ValidationRules())
+	sb.WriteString("\n")
 
 	sb.WriteString("# 待验证决策\n")
 	sb.WriteString(fmt.Sprintf("- 币种: %s\n", decision.Symbol))
@@ -191,7 +1205,11 @@ func buildValidationPrompt(ctx *Context, decision *Decision) string {
 		sb.WriteString("未找到该币种的市场数据。\n")
 	}
 
-	sb.WriteString("\n请判断此决策是否符合VWAP策略规则？请只回答 'AGREE' 或 'DISAGREE'。")
+	if ctx.RequireValidationConfidence || ctx.MaxConfidenceGap > 0 {
+		sb.WriteString("\n请判断此决策是否符合VWAP策略规则？请只回答 'AGREE <0-100>' 或 'DISAGREE <0-100>'，例如 'AGREE 75'。")
+	} else {
+		sb.WriteString("\n请判断此决策是否符合VWAP策略规则？请只回答 'AGREE' 或 'DISAGREE'。")
+	}
 
 	return sb.String()
 }
@@ -201,6 +1219,9 @@ func fetchMarketDataForContext(ctx *Context) error {
 	ctx.MarketDataMap = make(map[string]*market.Data)
 	ctx.OITopDataMap = make(map[string]*OITopData)
 
+	// 先统一币种命名，保证持仓、候选币种、市场数据和OI数据使用相同的key
+	applySymbolAliasesToContext(ctx)
+
 	// 收集所有需要获取数据的币种
 	symbolSet := make(map[string]bool)
 
@@ -225,12 +1246,15 @@ func fetchMarketDataForContext(ctx *Context) error {
 		positionSymbols[pos.Symbol] = true
 	}
 
+	fetched := make(map[string]bool)
+	passedLiquidity := make(map[string]bool)
 	for symbol := range symbolSet {
-		data, err := market.Get(symbol)
+		data, err := fetchMarketData(symbol)
 		if err != nil {
 			// 单个币种失败不影响整体，只记录错误
 			continue
 		}
+		fetched[symbol] = true
 
 		// ⚠️ 流动性过滤：持仓价值低于15M USD的币种不做（多空都不做）
 		// 持仓价值 = 持仓量 × 当前价格
@@ -246,16 +1270,52 @@ func fetchMarketDataForContext(ctx *Context) error {
 				continue
 			}
 		}
+		passedLiquidity[symbol] = true
+
+		// ⚠️ 数据完整性过滤：候选币种缺少必需指标时跳过（现有持仓不受影响）
+		if !isExistingPosition {
+			if missing := missingIndicators(data, ctx.RequiredIndicators); len(missing) > 0 {
+				log.Printf("⚠️  %s 市场数据不完整(缺少%s)，跳过此币种", symbol, strings.Join(missing, "/"))
+				continue
+			}
+		}
 
 		ctx.MarketDataMap[symbol] = data
 	}
 
+	coverage := CandidateCoverage{Total: len(ctx.CandidateCoins)}
+	for i, coin := range ctx.CandidateCoins {
+		for _, source := range coin.Sources {
+			switch source {
+			case "ai500":
+				coverage.FromAI500++
+			case "oi_top":
+				coverage.FromOITop++
+			}
+		}
+		if i >= maxCandidates {
+			continue
+		}
+		coverage.Considered++
+		if fetched[coin.Symbol] {
+			coverage.Fetched++
+		}
+		if passedLiquidity[coin.Symbol] {
+			coverage.PassedLiquidity++
+		}
+		if _, ok := ctx.MarketDataMap[coin.Symbol]; ok {
+			coverage.CompleteData++
+		}
+	}
+	ctx.CandidateCoverage = coverage
+	log.Printf("📊 候选币种覆盖: %s", coverage)
+
 	// 加载OI Top数据（不影响主流程）
-	oiPositions, err := pool.GetOITopPositions()
+	oiPositions, err := fetchOITopPositions()
 	if err == nil {
 		for _, pos := range oiPositions {
 			// 标准化符号匹配
-			symbol := pos.Symbol
+			symbol := canonicalSymbol(ctx.SymbolAliases, pos.Symbol)
 			ctx.OITopDataMap[symbol] = &OITopData{
 				Rank:              pos.Rank,
 				OIDeltaPercent:    pos.OIDeltaPercent,
@@ -270,14 +1330,133 @@ func fetchMarketDataForContext(ctx *Context) error {
 	return nil
 }
 
+// oiTopSignal 返回币种的OI Top数据，以及是否作为OI_Top信号展示
+// 持仓量变化的绝对值低于MinOITopDeltaPct时视为噪音，不展示来源标签和OI行；没有OI Top数据时无法判断，保留来源标签
+func oiTopSignal(ctx *Context, symbol string) (*OITopData, bool) {
+	data := ctx.OITopDataMap[symbol]
+	if data == nil {
+		return nil, true
+	}
+	return data, ctx.MinOITopDeltaPct <= 0 || math.Abs(data.OIDeltaPercent) >= ctx.MinOITopDeltaPct
+}
+
+// missingIndicators 返回数据中缺失（为0）的必需指标
+func missingIndicators(data *market.Data, required []string) []string {
+	var missing []string
+	for _, indicator := range required {
+		var value float64
+		switch strings.ToLower(indicator) {
+		case "vwap":
+			value = data.CurrentVWAP
+		case "rsi":
+			value = data.CurrentRSI7
+		case "macd":
+			value = data.CurrentMACD
+		default:
+			continue
+		}
+		if value == 0 {
+			missing = append(missing, strings.ToUpper(indicator))
+		}
+	}
+	return missing
+}
+
+// marketDataAgeNote 返回市场数据获取时长的提示行（未开启或缺少获取时间时返回空字符串）
+func marketDataAgeNote(ctx *Context, data *market.Data) string {
+	if !ctx.IncludeMarketDataAge || data == nil || data.FetchedAt.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("数据时效: %d秒前获取\n", int(time.Since(data.FetchedAt).Seconds()))
+}
+
+// marketRegime 根据价格相对VWAP的位置和MACD方向判断市场状态
+// 价格在VWAP上方且MACD为正为up，相反为down，其余为range；缺少数据时返回空字符串
+func marketRegime(data *market.Data) string {
+	if data == nil || data.CurrentPrice <= 0 || data.CurrentVWAP <= 0 {
+		return ""
+	}
+	switch {
+	case data.CurrentPrice > data.CurrentVWAP && data.CurrentMACD > 0:
+		return "up"
+	case data.CurrentPrice < data.CurrentVWAP && data.CurrentMACD < 0:
+		return "down"
+	default:
+		return "range"
+	}
+}
+
+// fetchMarketData 获取单个币种的市场数据（测试中可替换）
+var fetchMarketData = market.Get
+
+// fetchOITopPositions 获取OI Top数据（测试中可替换）
+var fetchOITopPositions = pool.GetOITopPositions
+
+// canonicalSymbol 返回币种的标准名（未配置别名时原样返回）
+func canonicalSymbol(aliases map[string]string, symbol string) string {
+	if canonical, ok := aliases[symbol]; ok && canonical != "" {
+		return canonical
+	}
+	return symbol
+}
+
+// applySymbolAliasesToContext 将持仓和候选币种的别名替换为标准名，别名与标准名同时出现的候选币种合并来源
+func applySymbolAliasesToContext(ctx *Context) {
+	if len(ctx.SymbolAliases) == 0 {
+		return
+	}
+	for i := range ctx.Positions {
+		ctx.Positions[i].Symbol = canonicalSymbol(ctx.SymbolAliases, ctx.Positions[i].Symbol)
+	}
+
+	merged := make([]CandidateCoin, 0, len(ctx.CandidateCoins))
+	index := make(map[string]int)
+	for _, coin := range ctx.CandidateCoins {
+		coin.Symbol = canonicalSymbol(ctx.SymbolAliases, coin.Symbol)
+		if i, ok := index[coin.Symbol]; ok {
+		nextSource:
+			for _, source := range coin.Sources {
+				for _, existing := range merged[i].Sources {
+					if existing == source {
+						continue nextSource
+					}
+				}
+				merged[i].Sources = append(merged[i].Sources, source)
+			}
+			continue
+		}
+		index[coin.Symbol] = len(merged)
+		merged = append(merged, coin)
+	}
+	ctx.CandidateCoins = merged
+}
+
+// applySymbolAliases 将AI决策中的币种别名替换为标准名，以便与持仓和市场数据匹配
+func applySymbolAliases(decisions []Decision, aliases map[string]string) {
+	for i := range decisions {
+		decisions[i].Symbol = canonicalSymbol(aliases, decisions[i].Symbol)
+	}
+}
+
 // calculateMaxCandidates 根据账户状态计算需要分析的候选币种数量
 func calculateMaxCandidates(ctx *Context) int {
-	// 直接返回候选池的全部币种数量
+	// 默认返回候选池的全部币种数量
 	// 因为候选池已经在 auto_trader.go 中筛选过了
-	// 固定分析前20个评分最高的币种（来自AI500）
+	if ctx.MaxFetchCandidates > 0 && ctx.MaxFetchCandidates < len(ctx.CandidateCoins) {
+		return ctx.MaxFetchCandidates
+	}
 	return len(ctx.CandidateCoins)
 }
 
+// calculateMaxPromptCandidates 计算prompt中展示的候选币种数量（可小于获取数量以节省token）
+func calculateMaxPromptCandidates(ctx *Context) int {
+	maxCandidates := calculateMaxCandidates(ctx)
+	if ctx.MaxPromptCandidates > 0 && ctx.MaxPromptCandidates < maxCandidates {
+		return ctx.MaxPromptCandidates
+	}
+	return maxCandidates
+}
+
 // buildSystemPrompt 构建 System Prompt（固定规则，可缓存）
 func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int) string {
 	var sb strings.Builder
@@ -342,6 +1521,7 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	sb.WriteString("```json\n[\n")
 	sb.WriteString("  {\"symbol\": \"BTCUSDT\", \"action\": \"open_long\", \"leverage\": 10, \"position_size_usd\": 5000, \"stop_loss\": 68000, \"take_profit\": 72000, \"confidence\": 80, \"risk_usd\": 200, \"reasoning\": \"价格上穿VWAP，RSI<70，MACD上行，满足做多条件。\"}\n")
 	sb.WriteString("]\n```\n")
+	sb.WriteString("分批止盈时，`close_long`/`close_short` 可附带 `close_percent`（1-100，默认100即全部平仓），例如 `\"close_percent\": 50` 只平掉一半仓位。\n")
 
 	return sb.String()
 }
@@ -370,6 +1550,27 @@ func buildUserPrompt(ctx *Context) string {
 		ctx.Account.MarginUsedPct,
 		ctx.Account.PositionCount))
 
+	if marginUsageExceeded(ctx) {
+		sb.WriteString(fmt.Sprintf("⚠️ **保证金使用率%.1f%%已超过上限%.1f%%**: 本周期禁止新开仓，请优先考虑减仓或平仓以降低风险\n\n",
+			ctx.Account.MarginUsedPct, ctx.MaxMarginUsedPct))
+	}
+	// 可用余额不足以按现有持仓的平均保证金填满剩余名额时提示
+	if margin := averagePositionMargin(ctx.Positions); margin > 0 {
+		maxPositions := ctx.MaxPositions
+		if maxPositions <= 0 {
+			maxPositions = defaultMaxPositions
+		}
+		if fundable, free := FundablePositions(ctx, margin), maxPositions-len(ctx.Positions); fundable < free {
+			sb.WriteString(fmt.Sprintf("⚠️ **可用余额%.2f按平均保证金%.2f只够再开%d个新仓**（持仓名额还剩%d个），请勿提出超出资金能力的开仓\n\n",
+				ctx.Account.AvailableBalance, margin, fundable, free))
+		}
+	}
+	if sharpeBelowFloor(ctx) {
+		sharpe, _ := performanceSharpe(ctx)
+		sb.WriteString(fmt.Sprintf("⚠️ **夏普比率%.2f已低于下限%.2f**: 近期风险调整后表现很差，本周期禁止新开仓，请谨慎管理现有持仓\n\n",
+			sharpe, ctx.MinSharpeRatio))
+	}
+
 	// 持仓（完整市场数据）
 	if len(ctx.Positions) > 0 {
 		sb.WriteString("## 当前持仓\n")
@@ -393,8 +1594,19 @@ func buildUserPrompt(ctx *Context) string {
 				pos.EntryPrice, pos.MarkPrice, pos.UnrealizedPnLPct,
 				pos.Leverage, pos.MarginUsed, pos.LiquidationPrice, holdingDuration))
 
+			// 距强平距离（百分比），距离过近时提示优先降低风险
+			if ctx.IncludeLiquidationDistance && pos.LiquidationPrice > 0 && pos.MarkPrice > 0 {
+				distancePct := liquidationDistancePct(pos)
+				sb.WriteString(fmt.Sprintf("   距强平: %.2f%%", distancePct))
+				if distancePct < liquidationWarnPct {
+					sb.WriteString(fmt.Sprintf(" ⚠️ 低于%.0f%%，请优先考虑减仓或平仓等降低风险的操作", liquidationWarnPct))
+				}
+				sb.WriteString("\n\n")
+			}
+
 			// 使用FormatMarketData输出完整市场数据
 			if marketData, ok := ctx.MarketDataMap[pos.Symbol]; ok {
+				sb.WriteString(marketDataAgeNote(ctx, marketData))
 				sb.WriteString(market.Format(marketData))
 				sb.WriteString("\n")
 			}
@@ -403,25 +1615,41 @@ func buildUserPrompt(ctx *Context) string {
 		sb.WriteString("**当前持仓**: 无\n\n")
 	}
 
-	// 候选币种（完整市场数据）
-	sb.WriteString(fmt.Sprintf("## 候选币种 (%d个)\n\n", len(ctx.MarketDataMap)))
-	displayedCount := 0
-	for _, coin := range ctx.CandidateCoins {
-		marketData, hasData := ctx.MarketDataMap[coin.Symbol]
-		if !hasData {
-			continue
+	// 候选币种（完整市场数据，只展示评分最高的前N个）
+	maxPromptCandidates := calculateMaxPromptCandidates(ctx)
+	rankedCoins := make([]CandidateCoin, len(ctx.CandidateCoins))
+	copy(rankedCoins, ctx.CandidateCoins)
+	sort.SliceStable(rankedCoins, func(i, j int) bool { return rankedCoins[i].Score > rankedCoins[j].Score })
+	var promptCoins []CandidateCoin
+	for _, coin := range rankedCoins {
+		if len(promptCoins) >= maxPromptCandidates {
+			break
 		}
+		if _, hasData := ctx.MarketDataMap[coin.Symbol]; hasData {
+			promptCoins = append(promptCoins, coin)
+		}
+	}
+	sb.WriteString(fmt.Sprintf("## 候选币种 (%d个)\n\n", len(promptCoins)))
+	displayedCount := 0
+	for _, coin := range promptCoins {
+		marketData := ctx.MarketDataMap[coin.Symbol]
 		displayedCount++
 
+		oiData, oiQualified := oiTopSignal(ctx, coin.Symbol)
 		sourceTags := ""
-		if len(coin.Sources) > 1 {
+		if oiQualified && len(coin.Sources) > 1 {
 			sourceTags = " (AI500+OI_Top双重信号)"
-		} else if len(coin.Sources) == 1 && coin.Sources[0] == "oi_top" {
+		} else if oiQualified && len(coin.Sources) == 1 && coin.Sources[0] == "oi_top" {
 			sourceTags = " (OI_Top持仓增长)"
 		}
 
 		// 使用FormatMarketData输出完整市场数据
 		sb.WriteString(fmt.Sprintf("### %d. %s%s\n\n", displayedCount, coin.Symbol, sourceTags))
+		if oiQualified && oiData != nil {
+			sb.WriteString(fmt.Sprintf("OI_Top排名#%d: 持仓量1h变化%+.2f%%, 价格变化%+.2f%%\n",
+				oiData.Rank, oiData.OIDeltaPercent, oiData.PriceDeltaPercent))
+		}
+		sb.WriteString(marketDataAgeNote(ctx, marketData))
 		sb.WriteString(market.Format(marketData))
 		sb.WriteString("\n")
 	}
@@ -431,12 +1659,21 @@ func buildUserPrompt(ctx *Context) string {
 	if ctx.Performance != nil {
 		// 直接从interface{}中提取SharpeRatio
 		type PerformanceData struct {
-			SharpeRatio float64 `json:"sharpe_ratio"`
+			SharpeRatio    float64                      `json:"sharpe_ratio"`
+			MaxDrawdownPct float64                      `json:"max_drawdown_pct"`
+			MaxDrawdownUSD float64                      `json:"max_drawdown_usd"`
+			SymbolStats    map[string]symbolStatsPrompt `json:"symbol_stats"`
 		}
 		var perfData PerformanceData
 		if jsonData, err := json.Marshal(ctx.Performance); err == nil {
 			if err := json.Unmarshal(jsonData, &perfData); err == nil {
 				sb.WriteString(fmt.Sprintf("## 📊 夏普比率: %.2f\n\n", perfData.SharpeRatio))
+				sb.WriteString(fmt.Sprintf("## 📉 最大回撤: %.2f%% (%.2f)\n\n", perfData.MaxDrawdownPct, perfData.MaxDrawdownUSD))
+
+				// 各币种历史表现（引导AI发挥优势）
+				if ctx.IncludeSymbolStats && len(perfData.SymbolStats) > 0 {
+					sb.WriteString(formatSymbolStats(perfData.SymbolStats))
+				}
 			}
 		}
 	}
@@ -453,6 +1690,73 @@ func buildUserPrompt(ctx *Context) string {
 	return sb.String()
 }
 
+// liquidationWarnPct 距强平低于该百分比时，在prompt中提示优先降低风险
+const liquidationWarnPct = 10.0
+
+// liquidationDistancePct 计算持仓从标记价到强平价的距离（百分比）
+func liquidationDistancePct(pos PositionInfo) float64 {
+	if pos.MarkPrice <= 0 || pos.LiquidationPrice <= 0 {
+		return 0
+	}
+	if pos.Side == "short" {
+		return (pos.LiquidationPrice - pos.MarkPrice) / pos.MarkPrice * 100
+	}
+	return (pos.MarkPrice - pos.LiquidationPrice) / pos.MarkPrice * 100
+}
+
+// symbolStatsPromptCount prompt中展示的最好/最差币种数量
+const symbolStatsPromptCount = 3
+
+// symbolStatsPrompt 币种历史表现（从logger.SymbolPerformance中提取的字段）
+type symbolStatsPrompt struct {
+	TotalTrades int     `json:"total_trades"`
+	WinRate     float64 `json:"win_rate"`
+	TotalPnL    float64 `json:"total_pn_l"`
+	AvgPnL      float64 `json:"avg_pn_l"`
+}
+
+// formatSymbolStats 按总盈亏排序，输出表现最好和最差的币种（紧凑格式）
+func formatSymbolStats(stats map[string]symbolStatsPrompt) string {
+	symbols := make([]string, 0, len(stats))
+	for symbol := range stats {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if stats[symbols[i]].TotalPnL == stats[symbols[j]].TotalPnL {
+			return symbols[i] < symbols[j]
+		}
+		return stats[symbols[i]].TotalPnL > stats[symbols[j]].TotalPnL
+	})
+
+	// 币种较少时平分为两组，避免同一币种同时出现在最好和最差中
+	n := symbolStatsPromptCount
+	if len(symbols) < 2*n {
+		n = (len(symbols) + 1) / 2
+	}
+
+	format := func(symbol string) string {
+		st := stats[symbol]
+		return fmt.Sprintf("%s 胜率%.0f%% 均盈亏%+.2f (%d笔)", symbol, st.WinRate, st.AvgPnL, st.TotalTrades)
+	}
+
+	var best, worst []string
+	for _, symbol := range symbols[:n] {
+		best = append(best, format(symbol))
+	}
+	for i := len(symbols) - 1; i >= n && i >= len(symbols)-n; i-- {
+		worst = append(worst, format(symbols[i]))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## 🏅 历史币种表现\n")
+	sb.WriteString("- 擅长: " + strings.Join(best, " | ") + "\n")
+	if len(worst) > 0 {
+		sb.WriteString("- 薄弱: " + strings.Join(worst, " | ") + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
 // parseFullDecisionResponse 解析AI的完整决策响应
 func parseFullDecisionResponse(aiResponse string, ctx *Context, accountEquity float64, btcEthLeverage, altcoinLeverage int) (*FullDecision, error) {
 	// 1. 提取思维链
@@ -466,67 +1770,349 @@ func parseFullDecisionResponse(aiResponse string, ctx *Context, accountEquity fl
 			Decisions: []Decision{},
 		}, fmt.Errorf("提取决策失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
 	}
-
-	// 3. 标准化决策 (例如, 'close' -> 'close_long')
-	normalizeDecisions(decisions, ctx.Positions)
-
-	// 4. 验证决策
-	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
-		return &FullDecision{
-			CoTTrace:  cotTrace,
-			Decisions: decisions,
-		}, fmt.Errorf("决策验证失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
+
+	// 3. 标准化决策 (例如, 'close' -> 'close_long')
+	applySymbolAliases(decisions, ctx.SymbolAliases)
+	normalizeDecisions(decisions, ctx.Positions)
+	normalizeTrace := applyDefaultLeverage(decisions, ctx.DefaultBTCETHLeverage, ctx.DefaultAltcoinLeverage)
+	normalizeTrace = append(normalizeTrace, snapLeverageToBrackets(decisions, ctx.AllowedLeverage)...)
+	var holdTrace []string
+	decisions, holdTrace = resolveUnheldHolds(decisions, ctx.Positions, ctx.UnheldHoldPolicy)
+	normalizeTrace = append(normalizeTrace, holdTrace...)
+
+	beforeReasoning := decisions
+	var reasoningTrace []string
+	decisions, reasoningTrace = applyEmptyReasoningPolicy(decisions, ctx.EmptyReasoningPolicy)
+	normalizeTrace = append(normalizeTrace, reasoningTrace...)
+	policyRejected := rejectedBetween(beforeReasoning, decisions, reasoningTrace, "validation", "缺少开仓理由")
+
+	// 开仓决策记录当前价作为入场价，后续各项检查都以此为准
+	normalizeTrace = append(normalizeTrace, fillEntryPrices(decisions, ctx.MarketDataMap)...)
+
+	beforeSizeRisk := decisions
+	var sizeRiskTrace []string
+	decisions, sizeRiskTrace = applySizeRiskConsistency(decisions, ctx.SizeRiskTolerancePct, ctx.SizeRiskPolicy)
+	normalizeTrace = append(normalizeTrace, sizeRiskTrace...)
+	policyRejected = append(policyRejected, rejectedBetween(beforeSizeRisk, decisions, sizeRiskTrace, "validation", "仓位与风险不一致")...)
+
+	// 4. 验证决策（回撤较深时先按下调后的上限降杠杆）
+	lev := leverageRule{btcEth: btcEthLeverage, altcoin: altcoinLeverage, bySymbol: ctx.MaxLeverageBySymbol,
+		scale: drawdownLeverageScale(ctx.CurrentDrawdownPct, ctx.DeRiskDrawdownPct), hardCap: ctx.HardMaxNotionalUSD}
+	normalizeTrace = append(normalizeTrace, capLeverageForDrawdown(decisions, lev, ctx.CurrentDrawdownPct)...)
+	rr := riskRewardRule{minRatio: ctx.MinRiskReward, bySymbol: ctx.MinRiskRewardBySymbol}
+	err = validateDecisions(decisions, accountEquity, lev, rr, ctx.Positions, ctx.MaxPositions)
+	if err == nil {
+		err = validateLeverageBrackets(decisions, ctx.AllowedLeverage)
+	}
+	if err != nil {
+		return &FullDecision{
+			CoTTrace:        cotTrace,
+			Decisions:       decisions,
+			ValidationTrace: normalizeTrace,
+			Rejected:        append(policyRejected, rejectAll(decisions, "validation", "决策验证失败", err)...),
+		}, fmt.Errorf("决策验证失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
+	}
+
+	// 5. 验证止损止盈相对当前价格的方向（避免下单即触发）
+	if err := validateStopsAgainstPrice(decisions); err != nil {
+		return &FullDecision{
+			CoTTrace:        cotTrace,
+			Decisions:       decisions,
+			ValidationTrace: normalizeTrace,
+			Rejected:        append(policyRejected, rejectAll(decisions, "validation", "止损止盈方向错误", err)...),
+		}, fmt.Errorf("决策验证失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
+	}
+
+	// 6. 验证止盈幅度足以覆盖往返手续费
+	if err := validateFeeFloor(decisions, ctx.FeeRatePct, ctx.MinTPFeeMultiple); err != nil {
+		return &FullDecision{
+			CoTTrace:        cotTrace,
+			Decisions:       decisions,
+			ValidationTrace: normalizeTrace,
+			Rejected:        append(policyRejected, rejectAll(decisions, "validation", "止盈不足以覆盖手续费", err)...),
+		}, fmt.Errorf("决策验证失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
+	}
+
+	// 7. 以真实入场价验证止盈距离达到最低R倍数（可选）
+	if err := validateRewardMultiple(decisions, ctx.MinRewardR); err != nil {
+		return &FullDecision{
+			CoTTrace:        cotTrace,
+			Decisions:       decisions,
+			ValidationTrace: normalizeTrace,
+			Rejected:        append(policyRejected, rejectAll(decisions, "validation", "止盈R倍数不足", err)...),
+		}, fmt.Errorf("决策验证失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
+	}
+
+	// 8. 验证开仓方向与MACD动能一致（可选）
+	if ctx.RequireMACDMomentum {
+		if err := validateMACDMomentum(decisions, ctx.MarketDataMap); err != nil {
+			return &FullDecision{
+				CoTTrace:        cotTrace,
+				Decisions:       decisions,
+				ValidationTrace: normalizeTrace,
+				Rejected:        append(policyRejected, rejectAll(decisions, "validation", "逆MACD动能", err)...),
+			}, fmt.Errorf("决策验证失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
+		}
+	}
+
+	// 9. 验证止损触发时的实际风险不超过声明的risk_usd（可选）
+	if ctx.EnforceRiskUSD {
+		if err := validateStopRiskWithinRiskUSD(decisions, ctx.RiskUSDTolerancePct); err != nil {
+			return &FullDecision{
+				CoTTrace:        cotTrace,
+				Decisions:       decisions,
+				ValidationTrace: normalizeTrace,
+				Rejected:        append(policyRejected, rejectAll(decisions, "validation", "止损风险超过risk_usd", err)...),
+			}, fmt.Errorf("决策验证失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
+		}
+	}
+
+	return &FullDecision{
+		CoTTrace:        cotTrace,
+		Decisions:       decisions,
+		ValidationTrace: normalizeTrace,
+		Rejected:        policyRejected,
+	}, nil
+}
+
+// rejectAll 验证失败时整批决策都不会执行，全部记为被拒绝
+func rejectAll(decisions []Decision, stage, reason string, err error) []RejectedDecision {
+	rejected := make([]RejectedDecision, 0, len(decisions))
+	for _, d := range decisions {
+		rejected = append(rejected, RejectedDecision{Decision: d, Stage: stage, Reason: reason, Detail: err.Error()})
+	}
+	return rejected
+}
+
+// extractCoTTrace 提取思维链分析
+func extractCoTTrace(response string) string {
+	// 查找JSON数组的开始位置
+	jsonStart := strings.Index(response, "[")
+
+	if jsonStart > 0 {
+		// 思维链是JSON数组之前的内容
+		return strings.TrimSpace(response[:jsonStart])
+	}
+
+	// 如果找不到JSON，整个响应都是思维链
+	return strings.TrimSpace(response)
+}
+
+// extractDecisions 提取JSON决策列表
+// 优先使用 ```json 代码块中的数组；没有代码块或代码块无法解析时，取全文中最后一个能解析为决策列表的顶层数组
+// （模型有时先输出草稿再输出最终版本，或在数组后继续写说明）。推理文字中的数字列表等无法解析为决策的数组会被跳过
+func extractDecisions(response string) ([]Decision, error) {
+	// 🔧 修复常见的JSON格式错误：中文引号（先替换，避免括号匹配时误判字符串边界）
+	response = fixMissingQuotes(response)
+
+	var candidates []string
+	for _, block := range fencedJSONBlocks(response) {
+		candidates = append(candidates, topLevelArrays(block)...)
+	}
+	fenced := len(candidates)
+	candidates = append(candidates, topLevelArrays(response)...)
+	if len(candidates) == 0 {
+		if !strings.Contains(response, "[") {
+			return nil, fmt.Errorf("无法找到JSON数组起始")
+		}
+		return nil, fmt.Errorf("无法找到JSON数组结束")
+	}
+
+	// 代码块内和全文分别从后往前尝试；空数组只在找不到非空决策列表时使用
+	var empty []Decision
+	var firstErr error
+	for _, group := range [][]string{candidates[:fenced], candidates[fenced:]} {
+		for i := len(group) - 1; i >= 0; i-- {
+			jsonContent := strings.TrimSpace(group[i])
+			raw := coerceDecisionNumbers(json.RawMessage(jsonContent))
+			if err := validateDecisionSchema(raw); err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("决策格式错误: %w\nJSON内容: %s", err, jsonContent)
+				}
+				continue
+			}
+			var decisions []Decision
+			if err := json.Unmarshal(raw, &decisions); err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
+				}
+				continue
+			}
+			if len(decisions) == 0 {
+				if empty == nil {
+					empty = decisions
+				}
+				continue
+			}
+			return decisions, nil
+		}
+	}
+	if empty != nil {
+		return empty, nil
 	}
-
-	return &FullDecision{
-		CoTTrace:  cotTrace,
-		Decisions: decisions,
-	}, nil
+	return nil, firstErr
 }
 
-// extractCoTTrace 提取思维链分析
-func extractCoTTrace(response string) string {
-	// 查找JSON数组的开始位置
-	jsonStart := strings.Index(response, "[")
+// decisionFields Decision支持的JSON字段名
+var decisionFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(Decision{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// coerceDecisionNumbers 将leverage/position_size_usd中以字符串表示的数字（如"10"）转换为数字
+// 只转换能完整解析的值（杠杆须为整数），其他情况原样返回，由validateDecisionSchema报告
+func coerceDecisionNumbers(raw json.RawMessage) json.RawMessage {
+	var elements []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		return raw
+	}
 
-	if jsonStart > 0 {
-		// 思维链是JSON数组之前的内容
-		return strings.TrimSpace(response[:jsonStart])
+	changed := false
+	for _, element := range elements {
+		for _, key := range []string{"leverage", "position_size_usd"} {
+			var text string
+			if value, ok := element[key]; !ok || json.Unmarshal(value, &text) != nil {
+				continue
+			}
+			text = strings.TrimSpace(text)
+			if key == "leverage" {
+				if _, err := strconv.Atoi(text); err != nil {
+					continue
+				}
+			} else if number, err := strconv.ParseFloat(text, 64); err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+				continue
+			}
+			element[key] = json.RawMessage(text)
+			changed = true
+		}
+	}
+	if !changed {
+		return raw
 	}
 
-	// 如果找不到JSON，整个响应都是思维链
-	return strings.TrimSpace(response)
+	coerced, err := json.Marshal(elements)
+	if err != nil {
+		return raw
+	}
+	return coerced
 }
 
-// extractDecisions 提取JSON决策列表
-func extractDecisions(response string) ([]Decision, error) {
-	// 直接查找JSON数组 - 找第一个完整的JSON数组
-	arrayStart := strings.Index(response, "[")
-	if arrayStart == -1 {
-		return nil, fmt.Errorf("无法找到JSON数组起始")
+// validateDecisionSchema 严格校验决策数组：每个元素必须是对象，不允许未知字段（拼写错误时提示最接近的字段名），
+// 字段类型必须正确；错误信息指出是第几个决策的哪个字段
+func validateDecisionSchema(raw json.RawMessage) error {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		return fmt.Errorf("决策列表必须是JSON数组: %w", err)
 	}
 
-	// 从 [ 开始，匹配括号找到对应的 ]
-	arrayEnd := findMatchingBracket(response, arrayStart)
-	if arrayEnd == -1 {
-		return nil, fmt.Errorf("无法找到JSON数组结束")
+	for i, element := range elements {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(element, &fields); err != nil {
+			return fmt.Errorf("决策 #%d 必须是JSON对象: %s", i+1, element)
+		}
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if decisionFields[key] {
+				continue
+			}
+			if suggestion := closestDecisionField(key); suggestion != "" {
+				return fmt.Errorf("决策 #%d 包含未知字段 %q（是否应为 %q？）", i+1, key, suggestion)
+			}
+			return fmt.Errorf("决策 #%d 包含未知字段 %q", i+1, key)
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(string(element)))
+		decoder.DisallowUnknownFields()
+		var d Decision
+		if err := decoder.Decode(&d); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return fmt.Errorf("决策 #%d 字段 %q 类型错误: 应为%s，实际为%s", i+1, typeErr.Field, typeErr.Type, typeErr.Value)
+			}
+			return fmt.Errorf("决策 #%d 解析失败: %w", i+1, err)
+		}
 	}
+	return nil
+}
 
-	jsonContent := strings.TrimSpace(response[arrayStart : arrayEnd+1])
+// closestDecisionField 返回与未知字段编辑距离不超过2的已知字段名（没有时返回空）
+func closestDecisionField(key string) string {
+	best, bestDistance := "", 3
+	for field := range decisionFields {
+		if distance := editDistance(strings.ToLower(key), field); distance < bestDistance || (distance == bestDistance && field < best) {
+			best, bestDistance = field, distance
+		}
+	}
+	return best
+}
 
-	// 🔧 修复常见的JSON格式错误：缺少引号的字段值
-	// 匹配: "reasoning": 内容"}  或  "reasoning": 内容}  (没有引号)
-	// 修复为: "reasoning": "内容"}
-	// 使用简单的字符串扫描而不是正则表达式
-	jsonContent = fixMissingQuotes(jsonContent)
+// editDistance 计算两个字符串的编辑距离（Levenshtein）
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
 
-	// 解析JSON
-	var decisions []Decision
-	if err := json.Unmarshal([]byte(jsonContent), &decisions); err != nil {
-		return nil, fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
+// fencedJSONBlocks 返回所有 ```json 代码块的内容（按出现顺序）
+func fencedJSONBlocks(response string) []string {
+	const fence = "```"
+	var blocks []string
+	rest := response
+	for {
+		start := strings.Index(rest, fence+"json")
+		if start == -1 {
+			return blocks
+		}
+		rest = rest[start+len(fence)+len("json"):]
+		end := strings.Index(rest, fence)
+		if end == -1 {
+			return append(blocks, rest)
+		}
+		blocks = append(blocks, rest[:end])
+		rest = rest[end+len(fence):]
 	}
+}
 
-	return decisions, nil
+// topLevelArrays 按出现顺序返回文本中所有括号完整匹配的顶层数组（嵌套数组包含在外层数组中）
+func topLevelArrays(s string) []string {
+	var arrays []string
+	for i := 0; i < len(s); i++ {
+		if s[i] != '[' {
+			continue
+		}
+		end := findMatchingBracket(s, i)
+		if end == -1 {
+			continue // 推理文字中未闭合的 [ ，继续查找后面的数组
+		}
+		arrays = append(arrays, s[i:end+1])
+		i = end
+	}
+	return arrays
 }
 
 // fixMissingQuotes 替换中文引号为英文引号（避免输入法自动转换）
@@ -568,16 +2154,484 @@ func normalizeDecisions(decisions []Decision, positions []PositionInfo) {
 				d.Action = "unknown_close"
 			}
 		}
+
+		// 平仓比例只对平仓决策有意义，其他决策忽略
+		if d.Action != "close_long" && d.Action != "close_short" {
+			d.ClosePercent = 0
+		}
+	}
+}
+
+// applyDefaultLeverage 为未给出杠杆的开仓决策补全默认杠杆（按币种类别），每次补全记录一条trace
+func applyDefaultLeverage(decisions []Decision, btcEthDefault, altcoinDefault int) []string {
+	var trace []string
+	for i := range decisions {
+		d := &decisions[i]
+		if (d.Action != "open_long" && d.Action != "open_short") || d.Leverage != 0 {
+			continue
+		}
+
+		defaultLeverage := altcoinDefault
+		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
+			defaultLeverage = btcEthDefault
+		}
+		if defaultLeverage <= 0 {
+			continue
+		}
+
+		d.Leverage = defaultLeverage
+		trace = append(trace, fmt.Sprintf("- 标准化 %s %s: 未给出杠杆，已使用默认杠杆 %dx", d.Symbol, d.Action, defaultLeverage))
+	}
+	return trace
+}
+
+// snapLeverageToBrackets 将开仓杠杆向下取整到交易所允许的最近档位（低于最小档位时保持不变，由验证阶段拒绝）
+func snapLeverageToBrackets(decisions []Decision, allowed map[string][]int) []string {
+	var trace []string
+	for i := range decisions {
+		d := &decisions[i]
+		brackets, ok := allowed[d.Symbol]
+		if (d.Action != "open_long" && d.Action != "open_short") || !ok || d.Leverage <= 0 {
+			continue
+		}
+
+		snapped := 0
+		for _, b := range brackets {
+			if b <= d.Leverage && b > snapped {
+				snapped = b
+			}
+		}
+		if snapped == 0 || snapped == d.Leverage {
+			continue
+		}
+		trace = append(trace, fmt.Sprintf("- 标准化 %s %s: 杠杆 %dx 不在允许档位内，已调整为 %dx", d.Symbol, d.Action, d.Leverage, snapped))
+		d.Leverage = snapped
+	}
+	return trace
+}
+
+// validateLeverageBrackets 验证开仓杠杆属于该币种允许的档位
+func validateLeverageBrackets(decisions []Decision, allowed map[string][]int) error {
+	for i, d := range decisions {
+		brackets, ok := allowed[d.Symbol]
+		if (d.Action != "open_long" && d.Action != "open_short") || !ok {
+			continue
+		}
+		valid := false
+		for _, b := range brackets {
+			if b == d.Leverage {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("决策 #%d 验证失败: %s杠杆%dx不在允许档位%v内", i+1, d.Symbol, d.Leverage, brackets)
+		}
+	}
+	return nil
+}
+
+// resolveUnheldHolds 处理对未持仓币种的hold决策（没有持仓的hold没有意义）
+// policy为"drop"时直接丢弃，否则转为wait；每次处理都会记录一条trace
+func resolveUnheldHolds(decisions []Decision, positions []PositionInfo, policy string) ([]Decision, []string) {
+	held := make(map[string]bool)
+	for _, pos := range positions {
+		held[pos.Symbol] = true
+	}
+
+	var result []Decision
+	var trace []string
+	for _, d := range decisions {
+		if d.Action != "hold" || held[d.Symbol] {
+			result = append(result, d)
+			continue
+		}
+		if policy == "drop" {
+			trace = append(trace, fmt.Sprintf("- 标准化 %s hold: 未持有该币种，决策已丢弃", d.Symbol))
+			continue
+		}
+		trace = append(trace, fmt.Sprintf("- 标准化 %s hold: 未持有该币种，已转为 wait", d.Symbol))
+		d.Action = "wait"
+		result = append(result, d)
+	}
+	return result, trace
+}
+
+// defaultMinRiskReward 默认最低风险回报比
+const defaultMinRiskReward = 3.0
+
+// leverageTier 币种档位：决定未单独配置杠杆时使用的上限和单币种仓位价值上限
+type leverageTier struct {
+	label                 string
+	positionValueMultiple float64 // 单币种仓位价值上限（账户净值的倍数）
+}
+
+var (
+	btcEthTier  = leverageTier{label: "BTC/ETH", positionValueMultiple: 10}
+	altcoinTier = leverageTier{label: "山寨币", positionValueMultiple: 1.5}
+)
+
+// leverageRule 开仓杠杆约束：BTC/ETH与山寨币两档默认值 + 按币种覆盖
+type leverageRule struct {
+	btcEth   int            // BTC/ETH杠杆上限
+	altcoin  int            // 山寨币杠杆上限（未配置覆盖的币种使用）
+	bySymbol map[string]int // 按币种覆盖
+	scale    float64        // 回撤降杠杆系数（0或1表示不下调）
+	hardCap  float64        // 单仓名义价值硬上限（USDT，0表示不限制），在净值倍数上限之后检查
+}
+
+// drawdownLeverageScale 按当前回撤计算杠杆上限的下调系数：回撤达到deRiskPct时为0.5，按比例线性下降
+// deRiskPct<=0或没有回撤时返回1
+func drawdownLeverageScale(drawdownPct, deRiskPct float64) float64 {
+	if deRiskPct <= 0 || drawdownPct <= 0 {
+		return 1
+	}
+	return math.Max(1-0.5*drawdownPct/deRiskPct, 0)
+}
+
+// tierFor 返回指定币种所属档位
+func (r leverageRule) tierFor(symbol string) leverageTier {
+	if symbol == "BTCUSDT" || symbol == "ETHUSDT" {
+		return btcEthTier
+	}
+	return altcoinTier
+}
+
+// maxFor 返回指定币种的杠杆上限（已按回撤降杠杆系数下调，最低1倍）
+func (r leverageRule) maxFor(symbol string) int {
+	leverage := r.altcoin
+	if override, ok := r.bySymbol[symbol]; ok && override > 0 {
+		leverage = override
+	} else if r.tierFor(symbol) == btcEthTier {
+		leverage = r.btcEth
+	}
+	if r.scale <= 0 || r.scale >= 1 || leverage <= 1 {
+		return leverage
+	}
+	return int(math.Max(math.Floor(float64(leverage)*r.scale), 1))
+}
+
+// capLeverageForDrawdown 回撤降杠杆生效时，将超过下调后上限的开仓杠杆降到上限
+func capLeverageForDrawdown(decisions []Decision, lev leverageRule, drawdownPct float64) []string {
+	if lev.scale <= 0 || lev.scale >= 1 {
+		return nil
+	}
+	var trace []string
+	for i := range decisions {
+		d := &decisions[i]
+		if d.Action != "open_long" && d.Action != "open_short" {
+			continue
+		}
+		if limit := lev.maxFor(d.Symbol); d.Leverage > limit {
+			trace = append(trace, fmt.Sprintf("- 降杠杆 %s %s: 当前回撤%.2f%%，杠杆 %dx 超过下调后的上限，已调整为 %dx",
+				d.Symbol, d.Action, drawdownPct, d.Leverage, limit))
+			d.Leverage = limit
+		}
 	}
+	return trace
 }
 
-// validateDecisions 验证所有决策（需要账户信息和杠杆配置）
-func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+// riskRewardRule 风险回报比约束：全局最低值 + 按币种覆盖
+type riskRewardRule struct {
+	minRatio float64            // 全局最低值（0表示默认3.0）
+	bySymbol map[string]float64 // 按币种覆盖
+}
+
+// minFor 返回指定币种的最低风险回报比
+func (r riskRewardRule) minFor(symbol string) float64 {
+	if ratio, ok := r.bySymbol[symbol]; ok && ratio > 0 {
+		return ratio
+	}
+	if r.minRatio > 0 {
+		return r.minRatio
+	}
+	return defaultMinRiskReward
+}
+
+// applySizeRiskConsistency 检查开仓决策的仓位大小、止损距离与AI声明的risk_usd是否自洽
+// 推算风险 = 仓位 × |入场价-止损| / 入场价，与risk_usd偏差超过tolerancePct时，
+// policy为"reject"则丢弃决策，否则保留并记录trace（未配置容差、未声明risk_usd或没有入场价时跳过）
+func applySizeRiskConsistency(decisions []Decision, tolerancePct float64, policy string) ([]Decision, []string) {
+	if tolerancePct <= 0 {
+		return decisions, nil
+	}
+
+	var result []Decision
+	var trace []string
+	for _, d := range decisions {
+		if (d.Action != "open_long" && d.Action != "open_short") || d.RiskUSD <= 0 || d.StopLoss <= 0 || d.EntryPrice <= 0 {
+			result = append(result, d)
+			continue
+		}
+
+		impliedRisk := ComputeRiskUSD(&d, d.EntryPrice)
+		deviationPct := 100.0
+		if impliedRisk > 0 {
+			deviationPct = math.Abs(d.RiskUSD-impliedRisk) / impliedRisk * 100
+		}
+		if deviationPct <= tolerancePct {
+			result = append(result, d)
+			continue
+		}
+
+		detail := fmt.Sprintf("仓位%.2f按止损推算风险%.2f USD，声明risk_usd为%.2f（偏差%.1f%% > %.1f%%）",
+			d.PositionSizeUSD, impliedRisk, d.RiskUSD, deviationPct, tolerancePct)
+		if policy == "reject" {
+			trace = append(trace, fmt.Sprintf("- 仓位检查 %s %s: %s，决策已拒绝", d.Symbol, d.Action, detail))
+			continue
+		}
+		trace = append(trace, fmt.Sprintf("- 仓位检查 %s %s: %s（仅标记）", d.Symbol, d.Action, detail))
+		result = append(result, d)
+	}
+	return result, trace
+}
+
+// applyEmptyReasoningPolicy 处理未给出理由的开仓决策（没有理由的开仓无法复盘）
+// policy为"flag"时保留决策并记录trace，为"reject"时丢弃并记录trace，其他值不处理
+func applyEmptyReasoningPolicy(decisions []Decision, policy string) ([]Decision, []string) {
+	if policy != "flag" && policy != "reject" {
+		return decisions, nil
+	}
+
+	var result []Decision
+	var trace []string
+	for _, d := range decisions {
+		if (d.Action != "open_long" && d.Action != "open_short") || strings.TrimSpace(d.Reasoning) != "" {
+			result = append(result, d)
+			continue
+		}
+		if policy == "reject" {
+			trace = append(trace, fmt.Sprintf("- 理由检查 %s %s: 开仓未给出理由，决策已拒绝", d.Symbol, d.Action))
+			continue
+		}
+		trace = append(trace, fmt.Sprintf("- 理由检查 %s %s: 开仓未给出理由（仅标记）", d.Symbol, d.Action))
+		result = append(result, d)
+	}
+	return result, trace
+}
+
+// fillEntryPrices 为开仓决策填入参考入场价（当前市价，无行情时为0）
+// 入场价由系统决定，模型在JSON中给出的entry_price与当前价不一致时被替换并记录trace
+func fillEntryPrices(decisions []Decision, marketDataMap map[string]*market.Data) []string {
+	var trace []string
+	for i := range decisions {
+		d := &decisions[i]
+		if d.Action != "open_long" && d.Action != "open_short" {
+			continue
+		}
+		var price float64
+		if data, ok := marketDataMap[d.Symbol]; ok && data != nil {
+			price = data.CurrentPrice
+		}
+		if d.EntryPrice > 0 && d.EntryPrice != price {
+			trace = append(trace, fmt.Sprintf("- 入场价 %s %s: 模型给出的entry_price %.4f 已替换为当前价 %.4f", d.Symbol, d.Action, d.EntryPrice, price))
+		}
+		d.EntryPrice = price
+	}
+	return trace
+}
+
+// defaultMaxPositions 默认最多同时持有的币种数量
+const defaultMaxPositions = 3
+
+// validateDecisions 验证所有决策（需要账户信息、杠杆配置、风险回报比约束和当前持仓）
+func validateDecisions(decisions []Decision, accountEquity float64, lev leverageRule, rr riskRewardRule, positions []PositionInfo, maxPositions int) error {
 	for i, decision := range decisions {
-		if err := validateDecision(&decision, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+		if err := validateDecision(&decision, accountEquity, lev, rr.minFor(decision.Symbol)); err != nil {
 			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
 		}
 	}
+	return validatePositionLimit(decisions, positions, maxPositions)
+}
+
+// FundablePositions 返回账户实际还能开的新仓数量：持仓名额剩余数与可用余额按typicalMargin能覆盖的仓位数取较小值
+// typicalMargin<=0时只按持仓名额计算
+func FundablePositions(ctx *Context, typicalMargin float64) int {
+	maxPositions := ctx.MaxPositions
+	if maxPositions <= 0 {
+		maxPositions = defaultMaxPositions
+	}
+	free := maxPositions - len(ctx.Positions)
+	if free < 0 {
+		free = 0
+	}
+	if typicalMargin <= 0 {
+		return free
+	}
+	if fundable := int(math.Max(ctx.Account.AvailableBalance, 0) / typicalMargin); fundable < free {
+		return fundable
+	}
+	return free
+}
+
+// averagePositionMargin 返回现有持仓的平均保证金（没有持仓时返回0）
+func averagePositionMargin(positions []PositionInfo) float64 {
+	total, count := 0.0, 0
+	for _, pos := range positions {
+		if pos.MarginUsed > 0 {
+			total += pos.MarginUsed
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// validatePositionLimit 验证现有持仓加上新开仓不超过最多持仓数（maxPositions<=0时默认3）
+// 平仓先于开仓执行，本批次平掉的持仓会腾出名额；hold/wait不占用名额
+func validatePositionLimit(decisions []Decision, positions []PositionInfo, maxPositions int) error {
+	if maxPositions <= 0 {
+		maxPositions = defaultMaxPositions
+	}
+
+	held := make(map[string]bool)
+	for _, pos := range positions {
+		held[pos.Symbol+"_"+pos.Side] = true
+	}
+	occupied := len(positions)
+	for _, d := range decisions {
+		if (d.Action == "close_long" && held[d.Symbol+"_long"]) || (d.Action == "close_short" && held[d.Symbol+"_short"]) {
+			occupied--
+		}
+	}
+
+	var dropped []string
+	for i, d := range decisions {
+		if d.Action != "open_long" && d.Action != "open_short" {
+			continue
+		}
+		if occupied < maxPositions {
+			occupied++
+			continue
+		}
+		dropped = append(dropped, fmt.Sprintf("#%d %s %s", i+1, d.Symbol, d.Action))
+	}
+	if len(dropped) > 0 {
+		return fmt.Errorf("持仓数量超限: 现有%d个持仓，最多同时持有%d个币种，超出的开仓决策: %s",
+			len(positions), maxPositions, strings.Join(dropped, ", "))
+	}
+	return nil
+}
+
+// validateStopsAgainstPrice 验证开仓决策的止损止盈与当前价格方向一致
+// 做多: 止损 < 当前价 < 止盈；做空: 止盈 < 当前价 < 止损（当前价取d.EntryPrice，没有入场价时跳过）
+func validateStopsAgainstPrice(decisions []Decision) error {
+	for i, d := range decisions {
+		if (d.Action != "open_long" && d.Action != "open_short") || d.EntryPrice <= 0 {
+			continue
+		}
+		price := d.EntryPrice
+
+		if d.Action == "open_long" {
+			if d.StopLoss >= price {
+				return fmt.Errorf("决策 #%d 验证失败: 做多%s止损价(%.4f)必须低于当前价(%.4f)", i+1, d.Symbol, d.StopLoss, price)
+			}
+			if d.TakeProfit <= price {
+				return fmt.Errorf("决策 #%d 验证失败: 做多%s止盈价(%.4f)必须高于当前价(%.4f)", i+1, d.Symbol, d.TakeProfit, price)
+			}
+		} else {
+			if d.StopLoss <= price {
+				return fmt.Errorf("决策 #%d 验证失败: 做空%s止损价(%.4f)必须高于当前价(%.4f)", i+1, d.Symbol, d.StopLoss, price)
+			}
+			if d.TakeProfit >= price {
+				return fmt.Errorf("决策 #%d 验证失败: 做空%s止盈价(%.4f)必须低于当前价(%.4f)", i+1, d.Symbol, d.TakeProfit, price)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFeeFloor 验证开仓决策的止盈幅度（相对当前价）超过往返手续费的指定倍数
+// 止盈幅度小于手续费的交易即使止盈也必然亏损（没有入场价或未配置费率时跳过）
+func validateFeeFloor(decisions []Decision, feeRatePct, multiple float64) error {
+	if feeRatePct <= 0 {
+		return nil
+	}
+	if multiple <= 0 {
+		multiple = 1
+	}
+	roundTripFeePct := feeRatePct * 2
+
+	for i, d := range decisions {
+		if (d.Action != "open_long" && d.Action != "open_short") || d.EntryPrice <= 0 {
+			continue
+		}
+
+		targetPct := math.Abs(d.TakeProfit-d.EntryPrice) / d.EntryPrice * 100
+		if targetPct <= roundTripFeePct*multiple {
+			return fmt.Errorf("决策 #%d 验证失败: %s止盈幅度%.3f%%未超过往返手续费%.3f%%的%.1f倍",
+				i+1, d.Symbol, targetPct, roundTripFeePct, multiple)
+		}
+	}
+	return nil
+}
+
+// validateRewardMultiple 以当前价作为真实入场价，验证止盈距离不小于止损距离的minR倍
+// 不依赖假设入场位置的比值计算（未配置minR或没有入场价时跳过）
+func validateRewardMultiple(decisions []Decision, minR float64) error {
+	if minR <= 0 {
+		return nil
+	}
+	for i, d := range decisions {
+		if (d.Action != "open_long" && d.Action != "open_short") || d.EntryPrice <= 0 {
+			continue
+		}
+		entry := d.EntryPrice
+
+		risk := math.Abs(entry - d.StopLoss)
+		reward := d.TakeProfit - entry
+		if d.Action == "open_short" {
+			reward = entry - d.TakeProfit
+		}
+		if reward < minR*risk {
+			return fmt.Errorf("决策 #%d 验证失败: %s止盈距离%.4f不足止损距离%.4f的%s倍 [入场:%.4f 止损:%.4f 止盈:%.4f]",
+				i+1, d.Symbol, reward, risk, strconv.FormatFloat(minR, 'f', -1, 64), entry, d.StopLoss, d.TakeProfit)
+		}
+	}
+	return nil
+}
+
+// validateStopRiskWithinRiskUSD 以当前价作为入场价，按 仓位/入场价 推算数量，
+// 验证止损触发时的实际亏损（|入场-止损| × 数量）不超过AI声明的risk_usd（允许超出tolerancePct%）
+// 未声明risk_usd或没有入场价的决策跳过
+func validateStopRiskWithinRiskUSD(decisions []Decision, tolerancePct float64) error {
+	for i, d := range decisions {
+		if (d.Action != "open_long" && d.Action != "open_short") || d.RiskUSD <= 0 || d.StopLoss <= 0 || d.EntryPrice <= 0 {
+			continue
+		}
+		entry := d.EntryPrice
+		risk := ComputeRiskUSD(&d, entry)
+		if limit := d.RiskUSD * (1 + tolerancePct/100); risk > limit {
+			return fmt.Errorf("决策 #%d 验证失败: %s止损风险%.2f USDT超过声明的risk_usd %.2f（容差%.1f%%）[入场:%.4f 止损:%.4f 仓位:%.2f]",
+				i+1, d.Symbol, risk, d.RiskUSD, tolerancePct, entry, d.StopLoss, d.PositionSizeUSD)
+		}
+	}
+	return nil
+}
+
+// validateMACDMomentum 验证开仓方向与MACD动能一致：做多要求MACD上行，做空要求MACD下行
+// 按日内MACD序列最后两个值判断（序列不足两个值时跳过）
+func validateMACDMomentum(decisions []Decision, marketDataMap map[string]*market.Data) error {
+	for i, d := range decisions {
+		if d.Action != "open_long" && d.Action != "open_short" {
+			continue
+		}
+		data, ok := marketDataMap[d.Symbol]
+		if !ok || data == nil || data.IntradaySeries == nil || len(data.IntradaySeries.MACDValues) < 2 {
+			continue
+		}
+		series := data.IntradaySeries.MACDValues
+		previous, current := series[len(series)-2], series[len(series)-1]
+
+		if d.Action == "open_long" && current <= previous {
+			return fmt.Errorf("决策 #%d 验证失败: 做多%s时MACD未上行(%.4f → %.4f)", i+1, d.Symbol, previous, current)
+		}
+		if d.Action == "open_short" && current >= previous {
+			return fmt.Errorf("决策 #%d 验证失败: 做空%s时MACD未下行(%.4f → %.4f)", i+1, d.Symbol, previous, current)
+		}
+	}
 	return nil
 }
 
@@ -587,9 +2641,24 @@ func findMatchingBracket(s string, start int) int {
 		return -1
 	}
 
+	// 跳过JSON字符串内的括号（如 reasoning 中的 "区间[60000, 61000]"）
 	depth := 0
+	inString, escaped := false, false
 	for i := start; i < len(s); i++ {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case s[i] == '\\':
+				escaped = true
+			case s[i] == '"':
+				inString = false
+			}
+			continue
+		}
 		switch s[i] {
+		case '"':
+			inString = true
 		case '[':
 			depth++
 		case ']':
@@ -604,7 +2673,8 @@ func findMatchingBracket(s string, start int) int {
 }
 
 // validateDecision 验证单个决策的有效性
-func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+// 风险回报比以d.EntryPrice（fillEntryPrices填入的当前价）作为入场价计算；没有入场价时假设在区间20%位置入场
+func validateDecision(d *Decision, accountEquity float64, lev leverageRule, minRiskReward float64) error {
 	// 验证action
 	validActions := map[string]bool{
 		"open_long":   true,
@@ -619,15 +2689,17 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		return fmt.Errorf("无效的action: %s", d.Action)
 	}
 
+	// 部分平仓比例必须在(0, 100]之间（0表示未设置，按全部平仓）
+	if (d.Action == "close_long" || d.Action == "close_short") && (d.ClosePercent < 0 || d.ClosePercent > 100) {
+		return fmt.Errorf("平仓比例必须在0-100之间: %.2f", d.ClosePercent)
+	}
+
 	// 开仓操作必须提供完整参数
 	if d.Action == "open_long" || d.Action == "open_short" {
-		// 根据币种使用配置的杠杆上限
-		maxLeverage := altcoinLeverage          // 山寨币使用配置的杠杆
-		maxPositionValue := accountEquity * 1.5 // 山寨币最多1.5倍账户净值
-		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-			maxLeverage = btcEthLeverage          // BTC和ETH使用配置的杠杆
-			maxPositionValue = accountEquity * 10 // BTC/ETH最多10倍账户净值
-		}
+		// 根据币种使用配置的杠杆上限，仓位价值上限按档位（BTC/ETH最多10倍净值，山寨币1.5倍）
+		tier := lev.tierFor(d.Symbol)
+		maxLeverage := lev.maxFor(d.Symbol)
+		maxPositionValue := accountEquity * tier.positionValueMultiple
 
 		if d.Leverage <= 0 || d.Leverage > maxLeverage {
 			return fmt.Errorf("杠杆必须在1-%d之间（%s，当前配置上限%d倍）: %d", maxLeverage, d.Symbol, maxLeverage, d.Leverage)
@@ -638,11 +2710,11 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		// 验证仓位价值上限（加1%容差以避免浮点数精度问题）
 		tolerance := maxPositionValue * 0.01 // 1%容差
 		if d.PositionSizeUSD > maxPositionValue+tolerance {
-			if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-				return fmt.Errorf("BTC/ETH单币种仓位价值不能超过%.0f USDT（10倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
-			} else {
-				return fmt.Errorf("山寨币单币种仓位价值不能超过%.0f USDT（1.5倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
-			}
+			return fmt.Errorf("%s单币种仓位价值不能超过%.0f USDT（%g倍账户净值），实际: %.0f",
+				tier.label, maxPositionValue, tier.positionValueMultiple, d.PositionSizeUSD)
+		}
+		if lev.hardCap > 0 && d.PositionSizeUSD > lev.hardCap {
+			return fmt.Errorf("单仓名义价值不能超过硬上限%.0f USDT，实际: %.0f", lev.hardCap, d.PositionSizeUSD)
 		}
 		if d.StopLoss <= 0 || d.TakeProfit <= 0 {
 			return fmt.Errorf("止损和止盈必须大于0")
@@ -659,10 +2731,15 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			}
 		}
 
-		// 验证风险回报比（必须≥1:3）
-		// 计算入场价（假设当前市价）
-		var entryPrice float64
-		if d.Action == "open_long" {
+		// 验证风险回报比（必须≥minRiskReward）
+		// 入场价使用填入的当前市价（当前价已越过止盈时风险回报比为负，同样被拒绝）
+		entryPrice := d.EntryPrice
+		if entryPrice > 0 {
+			// 当前价已越过止损时由validateStopsAgainstPrice拒绝，这里不重复检查
+			if (d.Action == "open_long" && entryPrice <= d.StopLoss) || (d.Action == "open_short" && entryPrice >= d.StopLoss) {
+				return nil
+			}
+		} else if d.Action == "open_long" {
 			// 做多：入场价在止损和止盈之间
 			entryPrice = d.StopLoss + (d.TakeProfit-d.StopLoss)*0.2 // 假设在20%位置入场
 		} else {
@@ -685,10 +2762,10 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			}
 		}
 
-		// 硬约束：风险回报比必须≥3.0
-		if riskRewardRatio < 3.0 {
-			return fmt.Errorf("风险回报比过低(%.2f:1)，必须≥3.0:1 [风险:%.2f%% 收益:%.2f%%] [止损:%.2f 止盈:%.2f]",
-				riskRewardRatio, riskPercent, rewardPercent, d.StopLoss, d.TakeProfit)
+		// 硬约束：风险回报比必须≥minRiskReward
+		if riskRewardRatio < minRiskReward {
+			return fmt.Errorf("风险回报比过低(%.2f:1)，必须≥%s:1 [风险:%.2f%% 收益:%.2f%%] [止损:%.2f 止盈:%.2f]",
+				riskRewardRatio, strconv.FormatFloat(minRiskReward, 'f', -1, 64), riskPercent, rewardPercent, d.StopLoss, d.TakeProfit)
 		}
 	}
 
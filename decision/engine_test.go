@@ -0,0 +1,1732 @@
+package decision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nofx/market"
+	"nofx/mcp"
+	"nofx/pool"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeModel answers a chat completion request; a non-200 status is returned as an API error.
+type fakeModel func(systemPrompt, userPrompt string) (content string, status int)
+
+// newFakeClient returns an mcp.Client backed by an httptest server that delegates to model.
+func newFakeClient(t *testing.T, model fakeModel) *mcp.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var systemPrompt, userPrompt string
+		for _, m := range req.Messages {
+			if m.Role == "system" {
+				systemPrompt = m.Content
+			} else {
+				userPrompt = m.Content
+			}
+		}
+
+		content, status := model(systemPrompt, userPrompt)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			w.Write([]byte(content))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"content": content}},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client := mcp.New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+	return client
+}
+
+// replyWith returns a fakeModel that always answers with content.
+func replyWith(content string) fakeModel {
+	return func(string, string) (string, int) { return content, http.StatusOK }
+}
+
+func TestBuildUserPromptLiquidationDistance(t *testing.T) {
+	// A long position marked at 100 with liquidation at 96 is 4% away from liquidation
+	ctx := &Context{
+		Account: AccountInfo{TotalEquity: 1000, AvailableBalance: 500},
+		Positions: []PositionInfo{
+			{Symbol: "SOLUSDT", Side: "long", EntryPrice: 105, MarkPrice: 100, Leverage: 5, LiquidationPrice: 96},
+		},
+		IncludeLiquidationDistance: true,
+	}
+
+	prompt := buildUserPrompt(ctx)
+
+	if !strings.Contains(prompt, "距强平: 4.00%") {
+		t.Errorf("Expected prompt to contain liquidation distance of 4.00%%, but got:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "请优先考虑减仓或平仓") {
+		t.Errorf("Expected prompt to contain a risk-reduction directive for a position near liquidation")
+	}
+
+	// The line should be omitted when the option is disabled
+	ctx.IncludeLiquidationDistance = false
+	prompt = buildUserPrompt(ctx)
+	if strings.Contains(prompt, "距强平") {
+		t.Errorf("Expected no liquidation distance line when the option is disabled")
+	}
+}
+
+func TestApplyPortfolioHeatCap(t *testing.T) {
+	// Held long: 10 SOL marked at 100 with a stop at 95 -> 50 USDT at risk
+	ctx := &Context{
+		Account: AccountInfo{TotalEquity: 1000},
+		Positions: []PositionInfo{
+			{Symbol: "SOLUSDT", Side: "long", MarkPrice: 100, Quantity: 10, StopLoss: 95},
+		},
+		MaxPortfolioHeatPct: 10, // 100 USDT cap
+	}
+	decisions := []Decision{
+		{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 1000, StopLoss: 58000, TakeProfit: 66000, RiskUSD: 40},
+		{Symbol: "ETHUSDT", Action: "open_short", Leverage: 5, PositionSizeUSD: 1000, StopLoss: 3100, TakeProfit: 2800, RiskUSD: 40},
+		{Symbol: "XRPUSDT", Action: "wait"},
+	}
+
+	if heat := PortfolioHeat(ctx.Positions, decisions); heat != 130 {
+		t.Errorf("Expected portfolio heat to be 130, but got %.2f", heat)
+	}
+
+	kept, trace := applyPortfolioHeatCap(ctx, decisions)
+
+	if len(kept) != 2 {
+		t.Fatalf("Expected 2 decisions to be kept, but got %d", len(kept))
+	}
+	if kept[0].Symbol != "BTCUSDT" || kept[1].Symbol != "XRPUSDT" {
+		t.Errorf("Expected BTCUSDT open and XRPUSDT wait to be kept, but got %s and %s", kept[0].Symbol, kept[1].Symbol)
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "ETHUSDT") {
+		t.Errorf("Expected a single trace entry for the trimmed ETHUSDT open, but got %v", trace)
+	}
+}
+
+func TestSymbolConcentrationCap(t *testing.T) {
+	// Held: 1000 USDT of BTC and 1000 USDT of ETH notional
+	ctx := &Context{
+		Positions: []PositionInfo{
+			{Symbol: "BTCUSDT", Side: "long", MarkPrice: 50000, Quantity: 0.02},
+			{Symbol: "ETHUSDT", Side: "short", EntryPrice: 2500, Quantity: 0.4},
+		},
+		MaxSymbolConcentrationPct: 60,
+	}
+	shares := SymbolConcentration(ctx.Positions)
+	if shares["BTCUSDT"] != 50 || shares["ETHUSDT"] != 50 {
+		t.Errorf("Expected a 50/50 split, but got %v", shares)
+	}
+
+	decisions := []Decision{
+		{Symbol: "ETHUSDT", Action: "open_short", PositionSizeUSD: 3000}, // (1000+3000)/5000 = 80%
+		{Symbol: "SOLUSDT", Action: "open_long", PositionSizeUSD: 500},   // 500/2500 = 20%
+		{Symbol: "BTCUSDT", Action: "hold"},
+	}
+	kept, trace := applySymbolConcentrationCap(ctx, decisions)
+	if len(kept) != 2 || kept[0].Symbol != "SOLUSDT" || kept[1].Symbol != "BTCUSDT" {
+		t.Fatalf("Expected the ETHUSDT open to be blocked, but kept %v", kept)
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "ETHUSDT") || !strings.Contains(trace[0], "80.0%") {
+		t.Errorf("Expected a single trace entry for the ETHUSDT open at 80%%, but got %v", trace)
+	}
+
+	ctx.SymbolConcentrationPolicy = "warn"
+	kept, trace = applySymbolConcentrationCap(ctx, decisions)
+	if len(kept) != 3 || len(trace) != 1 {
+		t.Errorf("Expected warn policy to keep all decisions with one warning, but got %d kept and %v", len(kept), trace)
+	}
+}
+
+func TestResolveUnheldHolds(t *testing.T) {
+	positions := []PositionInfo{{Symbol: "BTCUSDT", Side: "long"}}
+	decisions := []Decision{
+		{Symbol: "BTCUSDT", Action: "hold"},
+		{Symbol: "SOLUSDT", Action: "hold"},
+	}
+
+	result, trace := resolveUnheldHolds(decisions, positions, "")
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 decisions, but got %d", len(result))
+	}
+	if result[0].Action != "hold" {
+		t.Errorf("Expected hold on held BTCUSDT to stay hold, but got %s", result[0].Action)
+	}
+	if result[1].Action != "wait" {
+		t.Errorf("Expected hold on unheld SOLUSDT to become wait, but got %s", result[1].Action)
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "SOLUSDT") {
+		t.Errorf("Expected one trace note for SOLUSDT, but got %v", trace)
+	}
+
+	result, _ = resolveUnheldHolds(decisions, positions, "drop")
+	if len(result) != 1 || result[0].Symbol != "BTCUSDT" {
+		t.Errorf("Expected unheld hold to be dropped under the drop policy, but got %+v", result)
+	}
+}
+
+func TestCrossValidateDecisionsConcurrently(t *testing.T) {
+	const callDelay = 200 * time.Millisecond
+	validator := newFakeClient(t, func(string, string) (string, int) {
+		time.Sleep(callDelay)
+		return "AGREE", http.StatusOK
+	})
+
+	ctx := &Context{}
+	decisions := []Decision{
+		{Symbol: "BTCUSDT", Action: "open_long"},
+		{Symbol: "ETHUSDT", Action: "open_short"},
+		{Symbol: "SOLUSDT", Action: "close_long"},
+		{Symbol: "BNBUSDT", Action: "open_long"},
+	}
+
+	start := time.Now()
+	final, trace := crossValidateDecisions(ctx, decisions, validator)
+	elapsed := time.Since(start)
+
+	if elapsed >= 2*callDelay {
+		t.Errorf("Expected three validations to run concurrently in about %v, but took %v", callDelay, elapsed)
+	}
+	if len(final) != 4 {
+		t.Fatalf("Expected all 4 decisions to be accepted, but got %d", len(final))
+	}
+
+	expectedOrder := []string{"BTCUSDT", "ETHUSDT", "BNBUSDT"}
+	if len(trace) != len(expectedOrder) {
+		t.Fatalf("Expected %d trace entries, but got %d: %v", len(expectedOrder), len(trace), trace)
+	}
+	for i, symbol := range expectedOrder {
+		if !strings.Contains(trace[i], symbol) {
+			t.Errorf("Expected trace[%d] to be for %s, but got %s", i, symbol, trace[i])
+		}
+	}
+	for i, d := range final {
+		if d.Symbol != decisions[i].Symbol {
+			t.Errorf("Expected decision order to be preserved at %d: %s, but got %s", i, decisions[i].Symbol, d.Symbol)
+		}
+	}
+}
+
+func TestBuildUserPromptSymbolStats(t *testing.T) {
+	// Mirrors the JSON shape of logger.PerformanceAnalysis
+	performance := map[string]interface{}{
+		"sharpe_ratio": 0.8,
+		"symbol_stats": map[string]interface{}{
+			"BTCUSDT":  map[string]interface{}{"total_trades": 4, "win_rate": 75.0, "total_pn_l": 120.0, "avg_pn_l": 30.0},
+			"ETHUSDT":  map[string]interface{}{"total_trades": 2, "win_rate": 50.0, "total_pn_l": 5.0, "avg_pn_l": 2.5},
+			"DOGEUSDT": map[string]interface{}{"total_trades": 3, "win_rate": 0.0, "total_pn_l": -90.0, "avg_pn_l": -30.0},
+		},
+	}
+	ctx := &Context{
+		Account:            AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		Performance:        performance,
+		IncludeSymbolStats: true,
+	}
+
+	prompt := buildUserPrompt(ctx)
+
+	if !strings.Contains(prompt, "历史币种表现") {
+		t.Fatalf("Expected prompt to contain the per-symbol stats block, but got:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "- 擅长: BTCUSDT 胜率75% 均盈亏+30.00 (4笔)") {
+		t.Errorf("Expected BTCUSDT to be listed first as the best symbol, but got:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "- 薄弱: DOGEUSDT 胜率0% 均盈亏-30.00 (3笔)") {
+		t.Errorf("Expected DOGEUSDT to be listed as the worst symbol, but got:\n%s", prompt)
+	}
+
+	ctx.IncludeSymbolStats = false
+	if strings.Contains(buildUserPrompt(ctx), "历史币种表现") {
+		t.Errorf("Expected no per-symbol stats block when the option is disabled")
+	}
+}
+
+// stubMarketData replaces the market data fetcher for the duration of the test.
+func stubMarketData(t *testing.T, fetch func(symbol string) (*market.Data, error)) {
+	t.Helper()
+	original := fetchMarketData
+	fetchMarketData = fetch
+	t.Cleanup(func() { fetchMarketData = original })
+}
+
+func TestPromptCandidateCapSeparateFromFetchCap(t *testing.T) {
+	var fetched []string
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		fetched = append(fetched, symbol)
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+
+	ctx := &Context{
+		Account: AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "BTCUSDT", Score: 50}, {Symbol: "ETHUSDT", Score: 90}, {Symbol: "SOLUSDT", Score: 70},
+			{Symbol: "BNBUSDT", Score: 95}, {Symbol: "XRPUSDT", Score: 99},
+		},
+		MaxFetchCandidates:  4,
+		MaxPromptCandidates: 2,
+	}
+
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		t.Fatalf("Expected no error fetching market data, but got %v", err)
+	}
+	if len(fetched) != 4 {
+		t.Errorf("Expected 4 symbols to be fetched, but got %d: %v", len(fetched), fetched)
+	}
+
+	prompt := buildUserPrompt(ctx)
+	if !strings.Contains(prompt, "## 候选币种 (2个)") {
+		t.Errorf("Expected 2 candidates to be rendered, but got:\n%s", prompt)
+	}
+	// XRPUSDT scores highest but was never fetched; of the fetched coins BNBUSDT and ETHUSDT score highest
+	if !strings.Contains(prompt, "### 1. BNBUSDT") || !strings.Contains(prompt, "### 2. ETHUSDT") {
+		t.Errorf("Expected the top-scored fetched candidates BNBUSDT and ETHUSDT to be rendered in score order, but got:\n%s", prompt)
+	}
+	for _, symbol := range []string{"BTCUSDT", "SOLUSDT", "XRPUSDT"} {
+		if strings.Contains(prompt, symbol) {
+			t.Errorf("Expected lower-scored or unfetched %s not to be rendered", symbol)
+		}
+	}
+}
+
+func TestValidateStopsAgainstPrice(t *testing.T) {
+	valid := []Decision{{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 60000, StopLoss: 59000, TakeProfit: 63000}}
+	if err := validateStopsAgainstPrice(valid); err != nil {
+		t.Errorf("Expected a long with stop below and target above price to pass, but got %v", err)
+	}
+
+	// Stop above the current price would trigger immediately
+	invalid := []Decision{{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 60000, StopLoss: 60500, TakeProfit: 64000}}
+	err := validateStopsAgainstPrice(invalid)
+	if err == nil {
+		t.Fatal("Expected a long with stop above current price to be rejected")
+	}
+	if !strings.Contains(err.Error(), "止损价(60500.0000)必须低于当前价(60000.0000)") {
+		t.Errorf("Expected the error to name the stop-loss violation, but got %v", err)
+	}
+}
+
+func TestApplyDefaultLeverage(t *testing.T) {
+	decisions := []Decision{
+		{Symbol: "SOLUSDT", Action: "open_long", PositionSizeUSD: 500, StopLoss: 95, TakeProfit: 130},
+		{Symbol: "BTCUSDT", Action: "open_short", Leverage: 4, PositionSizeUSD: 500, StopLoss: 62000, TakeProfit: 54000},
+	}
+
+	if err := validateDecisions(decisions, 1000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{}, nil, 0); err == nil {
+		t.Fatal("Expected an open without leverage to fail validation before defaults are applied")
+	}
+
+	trace := applyDefaultLeverage(decisions, 10, 3)
+
+	if decisions[0].Leverage != 3 {
+		t.Errorf("Expected SOLUSDT to get the altcoin default of 3x, but got %dx", decisions[0].Leverage)
+	}
+	if decisions[1].Leverage != 4 {
+		t.Errorf("Expected explicit BTCUSDT leverage to be kept at 4x, but got %dx", decisions[1].Leverage)
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "SOLUSDT") {
+		t.Errorf("Expected one trace entry for SOLUSDT, but got %v", trace)
+	}
+	if err := validateDecisions(decisions, 1000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{}, nil, 0); err != nil {
+		t.Errorf("Expected decisions to pass validation after defaults are applied, but got %v", err)
+	}
+}
+
+func TestFetchSkipsCandidatesMissingIndicators(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		data := &market.Data{Symbol: symbol, CurrentPrice: 100, CurrentVWAP: 99, CurrentRSI7: 55, CurrentMACD: 0.2}
+		if symbol == "DOGEUSDT" || symbol == "SOLUSDT" {
+			data.CurrentVWAP = 0 // upstream gap
+		}
+		return data, nil
+	})
+
+	ctx := &Context{
+		Positions:          []PositionInfo{{Symbol: "SOLUSDT", Side: "long"}},
+		CandidateCoins:     []CandidateCoin{{Symbol: "BTCUSDT"}, {Symbol: "DOGEUSDT"}},
+		RequiredIndicators: []string{"vwap", "rsi", "macd"},
+	}
+
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		t.Fatalf("Expected no error fetching market data, but got %v", err)
+	}
+	if _, ok := ctx.MarketDataMap["BTCUSDT"]; !ok {
+		t.Errorf("Expected BTCUSDT with complete data to be kept")
+	}
+	if _, ok := ctx.MarketDataMap["DOGEUSDT"]; ok {
+		t.Errorf("Expected DOGEUSDT with zero VWAP to be skipped")
+	}
+	if _, ok := ctx.MarketDataMap["SOLUSDT"]; !ok {
+		t.Errorf("Expected held SOLUSDT to be kept despite missing VWAP")
+	}
+}
+
+func TestContextValidate(t *testing.T) {
+	validContext := func() *Context {
+		return &Context{
+			Account:         AccountInfo{TotalEquity: 1000},
+			BTCETHLeverage:  5,
+			AltcoinLeverage: 5,
+			Positions:       []PositionInfo{{Symbol: "BTCUSDT", Side: "long"}, {Symbol: "ETHUSDT", Side: "short"}},
+			CandidateCoins:  []CandidateCoin{},
+		}
+	}
+
+	if err := validContext().Validate(); err != nil {
+		t.Fatalf("Expected a coherent context to pass validation, but got %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(ctx *Context)
+		wantErr string
+	}{
+		{"missing equity", func(ctx *Context) { ctx.Account.TotalEquity = 0 }, "账户净值"},
+		{"negative leverage", func(ctx *Context) { ctx.AltcoinLeverage = -1 }, "杠杆配置"},
+		{"duplicate position symbol", func(ctx *Context) {
+			ctx.Positions = append(ctx.Positions, PositionInfo{Symbol: "BTCUSDT", Side: "short"})
+		}, "币种重复: BTCUSDT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := validContext()
+			tt.mutate(ctx)
+			err := ctx.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMarginUsageLimitBlocksOpens(t *testing.T) {
+	ctx := &Context{
+		Account:          AccountInfo{TotalEquity: 1000, AvailableBalance: 150, MarginUsedPct: 85},
+		MaxMarginUsedPct: 80,
+	}
+	decisions := []Decision{
+		{Symbol: "BTCUSDT", Action: "open_long"},
+		{Symbol: "ETHUSDT", Action: "close_short"},
+		{Symbol: "SOLUSDT", Action: "open_short"},
+	}
+
+	kept, trace := applyMarginUsageLimit(ctx, decisions)
+
+	if len(kept) != 1 || kept[0].Action != "close_short" {
+		t.Errorf("Expected only the close to be kept, but got %+v", kept)
+	}
+	if len(trace) != 2 {
+		t.Errorf("Expected 2 suppression trace entries, but got %v", trace)
+	}
+	if !strings.Contains(buildUserPrompt(ctx), "本周期禁止新开仓") {
+		t.Errorf("Expected the prompt to contain a reduce-risk directive")
+	}
+
+	ctx.Account.MarginUsedPct = 50
+	if kept, _ := applyMarginUsageLimit(ctx, decisions); len(kept) != 3 {
+		t.Errorf("Expected all decisions to pass under the limit, but got %d", len(kept))
+	}
+}
+
+func TestRejectedBetween(t *testing.T) {
+	before := []Decision{
+		{Symbol: "BTCUSDT", Action: "open_long"},
+		{Symbol: "ETHUSDT", Action: "open_short"},
+		{Symbol: "SOLUSDT", Action: "close_long"},
+	}
+	after := []Decision{before[0], before[2]}
+	trace := []string{"- 风控 ETHUSDT open_short: 组合热度超限"}
+
+	rejected := rejectedBetween(before, after, trace, "risk", "组合热度超限")
+
+	if len(rejected) != 1 {
+		t.Fatalf("Expected 1 rejected decision, but got %d", len(rejected))
+	}
+	if rejected[0].Decision.Symbol != "ETHUSDT" || rejected[0].Stage != "risk" || rejected[0].Detail != trace[0] {
+		t.Errorf("Expected ETHUSDT to be rejected at the risk stage with its trace, but got %+v", rejected[0])
+	}
+}
+
+func TestValidateFeeFloor(t *testing.T) {
+	// 0.05% target (60030) under 0.04% per side = 0.08% round-trip fees
+	tinyTarget := []Decision{{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 60000, StopLoss: 59000, TakeProfit: 60030}}
+	err := validateFeeFloor(tinyTarget, 0.04, 1)
+	if err == nil {
+		t.Fatal("Expected a 0.05% target under 0.08% round-trip fees to be rejected")
+	}
+	if !strings.Contains(err.Error(), "往返手续费0.080%") {
+		t.Errorf("Expected the error to cite the round-trip fee, but got %v", err)
+	}
+
+	// 1% target clears the floor
+	target := []Decision{{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 60000, StopLoss: 59000, TakeProfit: 60600}}
+	if err := validateFeeFloor(target, 0.04, 1); err != nil {
+		t.Errorf("Expected a 1%% target to pass, but got %v", err)
+	}
+
+	// Disabled when no fee rate is configured
+	if err := validateFeeFloor(tinyTarget, 0, 1); err != nil {
+		t.Errorf("Expected no fee check without a fee rate, but got %v", err)
+	}
+}
+
+func TestValidatorUsesOwnRetryCount(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+
+	// Both models share one server: the primary fails once then answers, the validator always hangs up.
+	var mu sync.Mutex
+	primaryCalls, validatorCalls := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role string `json:"role"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		isPrimary := len(req.Messages) > 0 && req.Messages[0].Role == "system"
+
+		mu.Lock()
+		var hangUp bool
+		if isPrimary {
+			primaryCalls++
+			hangUp = primaryCalls == 1
+		} else {
+			validatorCalls++
+			hangUp = true
+		}
+		mu.Unlock()
+
+		if hangUp {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"content": `[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":1000,"stop_loss":95,"take_profit":120,"reasoning":"breakout"}]`}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := mcp.New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+
+	ctx := &Context{
+		Account:                 AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins:          []CandidateCoin{{Symbol: "BTCUSDT"}},
+		BTCETHLeverage:          10,
+		AltcoinLeverage:         5,
+		PrimaryMaxRetries:       2,
+		PrimaryRetryBackoff:     time.Millisecond,
+		ValidationMaxRetries:    4,
+		ValidationRetryBackoff:  time.Millisecond,
+		ValidationFailurePolicy: "accept",
+	}
+
+	decision, err := GetFullDecision(ctx, client, client)
+	if err != nil {
+		t.Fatalf("Expected primary to succeed on its retry, but got %v", err)
+	}
+	if primaryCalls != 2 {
+		t.Errorf("Expected 2 primary calls, but got %d", primaryCalls)
+	}
+	if validatorCalls != 4 {
+		t.Errorf("Expected validator to use its own retry count of 4, but got %d calls", validatorCalls)
+	}
+	if len(decision.Decisions) != 1 {
+		t.Errorf("Expected accept policy to keep the decision after validator exhausted retries, but got %d", len(decision.Decisions))
+	}
+}
+
+func TestGetFullDecisionRejectsNonPositiveEquity(t *testing.T) {
+	calls := 0
+	client := newFakeClient(t, func(string, string) (string, int) {
+		calls++
+		return "[]", http.StatusOK
+	})
+
+	for _, equity := range []float64{0, -50} {
+		ctx := &Context{
+			Account:         AccountInfo{TotalEquity: equity},
+			CandidateCoins:  []CandidateCoin{},
+			BTCETHLeverage:  10,
+			AltcoinLeverage: 5,
+		}
+		_, err := GetFullDecision(ctx, client, client)
+		if !errors.Is(err, ErrNonPositiveEquity) {
+			t.Errorf("Expected ErrNonPositiveEquity for equity %.2f, but got %v", equity, err)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("Expected no model calls, but got %d", calls)
+	}
+}
+
+func TestConfidenceGapRejectsDespiteAgree(t *testing.T) {
+	var prompt string
+	validator := newFakeClient(t, func(_, userPrompt string) (string, int) {
+		prompt = userPrompt
+		return "AGREE 55", http.StatusOK
+	})
+
+	ctx := &Context{MaxConfidenceGap: 25}
+	decisions := []Decision{{Symbol: "BTCUSDT", Action: "open_long", Confidence: 90}}
+
+	final, trace := crossValidateDecisions(ctx, decisions, validator)
+	if !strings.Contains(prompt, "'AGREE <0-100>'") {
+		t.Errorf("Expected validation prompt to ask for a confidence")
+	}
+	if len(final) != 0 {
+		t.Fatalf("Expected decision to be rejected for a 35-point confidence gap, but got %v", final)
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "信心度分歧") {
+		t.Errorf("Expected a confidence gap trace, but got %v", trace)
+	}
+
+	decisions[0].Confidence = 75
+	if final, _ := crossValidateDecisions(ctx, decisions, validator); len(final) != 1 {
+		t.Errorf("Expected decision within the gap to be accepted, but got %v", final)
+	}
+
+	// With the structured verdict also required, the same confidence drives both the floor and the gap check
+	ctx = &Context{MaxConfidenceGap: 25, RequireValidationConfidence: true, ValidationConfidenceFloor: 50}
+	decisions[0].Confidence = 90
+	final, trace = crossValidateDecisions(ctx, decisions, validator)
+	if len(final) != 0 || len(trace) != 1 || !strings.Contains(trace[0], "主模型90 验证模型55") {
+		t.Errorf("Expected the 35-point gap to reject an AGREE above the floor, but got %v (trace %v)", final, trace)
+	}
+}
+
+func TestCandidateCoverage(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		data := &market.Data{Symbol: symbol, CurrentPrice: 100, CurrentVWAP: 99,
+			OpenInterest: &market.OIData{Latest: 1_000_000}} // 100M USD
+		switch symbol {
+		case "SOLUSDT":
+			return nil, fmt.Errorf("upstream timeout")
+		case "ETHUSDT":
+			data.OpenInterest.Latest = 1000 // 0.1M USD, below the liquidity floor
+		case "DOGEUSDT":
+			data.CurrentVWAP = 0
+		}
+		return data, nil
+	})
+
+	ctx := &Context{
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "BTCUSDT", Sources: []string{"ai500"}},
+			{Symbol: "ETHUSDT", Sources: []string{"ai500", "oi_top"}},
+			{Symbol: "DOGEUSDT", Sources: []string{"oi_top"}},
+			{Symbol: "SOLUSDT", Sources: []string{"ai500"}},
+			{Symbol: "XRPUSDT", Sources: []string{"ai500"}},
+		},
+		MaxFetchCandidates: 4,
+		RequiredIndicators: []string{"vwap"},
+	}
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		t.Fatalf("Expected no error fetching market data, but got %v", err)
+	}
+
+	expected := CandidateCoverage{Total: 5, FromAI500: 4, FromOITop: 2, Considered: 4, Fetched: 3, PassedLiquidity: 2, CompleteData: 1}
+	if ctx.CandidateCoverage != expected {
+		t.Errorf("Expected coverage %+v, but got %+v", expected, ctx.CandidateCoverage)
+	}
+}
+
+func TestPredictCandidateCount(t *testing.T) {
+	history := []CandidateCoverage{{CompleteData: 20}, {CompleteData: 4}, {CompleteData: 6}, {CompleteData: 8}}
+
+	if got := PredictCandidateCount(history, 3); got != 6 {
+		t.Errorf("Expected the 3-cycle average of recent coverage to be 6, but got %.2f", got)
+	}
+	if got := PredictCandidateCount(history, 0); got != 9.5 {
+		t.Errorf("Expected the full-history average to be 9.5, but got %.2f", got)
+	}
+	if got := PredictCandidateCount(nil, 3); got != 0 {
+		t.Errorf("Expected 0 without history, but got %.2f", got)
+	}
+}
+
+func TestPerSymbolMinRiskReward(t *testing.T) {
+	rr := riskRewardRule{bySymbol: map[string]float64{"DOGEUSDT": 4}}
+	// Entry 100, stop 98, target 107 → 3.5:1
+	btc := []Decision{{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 100, Leverage: 5, PositionSizeUSD: 500, StopLoss: 98, TakeProfit: 107}}
+	doge := []Decision{{Symbol: "DOGEUSDT", Action: "open_long", EntryPrice: 100, Leverage: 5, PositionSizeUSD: 500, StopLoss: 98, TakeProfit: 107}}
+
+	if err := validateDecisions(btc, 1000, leverageRule{btcEth: 10, altcoin: 5}, rr, nil, 0); err != nil {
+		t.Errorf("Expected BTCUSDT at 3.5:1 to pass the 3:1 global minimum, but got %v", err)
+	}
+	if err := validateDecisions(doge, 1000, leverageRule{btcEth: 10, altcoin: 5}, rr, nil, 0); err == nil || !strings.Contains(err.Error(), "风险回报比过低") {
+		t.Errorf("Expected DOGEUSDT at 3.5:1 to fail its 4:1 override, but got %v", err)
+	}
+}
+
+func TestPerSymbolLeverageCap(t *testing.T) {
+	lev := leverageRule{btcEth: 50, altcoin: 10, bySymbol: map[string]int{"SOLUSDT": 15}}
+	rr := riskRewardRule{}
+	open := func(leverage int) []Decision {
+		return []Decision{{Symbol: "SOLUSDT", Action: "open_long", EntryPrice: 100, Leverage: leverage, PositionSizeUSD: 500, StopLoss: 98, TakeProfit: 107}}
+	}
+
+	if err := validateDecisions(open(20), 1000, lev, rr, nil, 0); err == nil || !strings.Contains(err.Error(), "15倍") {
+		t.Errorf("Expected a 20x SOLUSDT open to exceed its 15x cap, but got %v", err)
+	}
+	if err := validateDecisions(open(12), 1000, lev, rr, nil, 0); err != nil {
+		t.Errorf("Expected a 12x SOLUSDT open to pass above the 10x altcoin default, but got %v", err)
+	}
+	if got := (leverageRule{btcEth: 50, altcoin: 10}).maxFor("ETHUSDT"); got != 50 {
+		t.Errorf("Expected ETHUSDT to keep the BTC/ETH default without overrides, but got %dx", got)
+	}
+
+	// SOL keeps the altcoin position-value tier (1.5x equity)
+	big := open(12)
+	big[0].PositionSizeUSD = 2000
+	if err := validateDecisions(big, 1000, lev, rr, nil, 0); err == nil || !strings.Contains(err.Error(), "山寨币") {
+		t.Errorf("Expected a 2000 USDT SOLUSDT open to exceed the altcoin value cap, but got %v", err)
+	}
+}
+
+func TestMinRiskRewardThreshold(t *testing.T) {
+	// Entry 100, stop 98, target 105 → 2.5:1
+	decisions := []Decision{{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 100, Leverage: 5, PositionSizeUSD: 500, StopLoss: 98, TakeProfit: 105}}
+
+	if err := validateDecisions(decisions, 1000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{minRatio: 2.0}, nil, 0); err != nil {
+		t.Errorf("Expected 2.5:1 to pass a 2.0 threshold, but got %v", err)
+	}
+	err := validateDecisions(decisions, 1000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{minRatio: 3.0}, nil, 0)
+	if err == nil || !strings.Contains(err.Error(), "必须≥3:1") {
+		t.Errorf("Expected 2.5:1 to fail a 3.0 threshold quoting the configured value, but got %v", err)
+	}
+	err = validateDecisions(decisions, 1000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{minRatio: 2.75}, nil, 0)
+	if err == nil || !strings.Contains(err.Error(), "必须≥2.75:1") {
+		t.Errorf("Expected the error to quote the configured 2.75 threshold, but got %v", err)
+	}
+}
+
+func TestMaxConcurrentPositions(t *testing.T) {
+	positions := []PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long"},
+		{Symbol: "ETHUSDT", Side: "short"},
+	}
+	open := func(symbol string) Decision {
+		return Decision{Symbol: symbol, Action: "open_long", Leverage: 5, PositionSizeUSD: 100, StopLoss: 90, TakeProfit: 150}
+	}
+	decisions := []Decision{
+		open("SOLUSDT"),
+		{Symbol: "BTCUSDT", Action: "hold"},
+		open("BNBUSDT"),
+		open("XRPUSDT"),
+	}
+
+	// 2 existing + 3 opens against a limit of 4: only the last open is dropped
+	err := validateDecisions(decisions, 1000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{}, positions, 4)
+	if err == nil || !strings.Contains(err.Error(), "持仓数量超限") {
+		t.Fatalf("Expected the position limit to be exceeded, but got %v", err)
+	}
+	if strings.Count(err.Error(), "open_long") != 1 || !strings.Contains(err.Error(), "#4 XRPUSDT") {
+		t.Errorf("Expected exactly one open (XRPUSDT) to be rejected, but got %v", err)
+	}
+
+	// Default limit of 3 leaves a single free slot
+	if err := validateDecisions(decisions, 1000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{}, positions, 0); err == nil || strings.Count(err.Error(), "open_long") != 2 {
+		t.Errorf("Expected two opens to exceed the default limit, but got %v", err)
+	}
+
+	// Closing an existing position frees a slot for the same batch
+	withClose := append([]Decision{{Symbol: "ETHUSDT", Action: "close_short"}}, decisions...)
+	if err := validateDecisions(withClose, 1000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{}, positions, 4); err != nil {
+		t.Errorf("Expected the close to free a slot, but got %v", err)
+	}
+}
+
+func TestValidateRewardMultiple(t *testing.T) {
+	// Entry 100, stop 98 (2 risk), target 105 (5 reward) → 2.5R
+	short := []Decision{{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 100, StopLoss: 98, TakeProfit: 105}}
+	if err := validateRewardMultiple(short, 3); err == nil || !strings.Contains(err.Error(), "3倍") {
+		t.Errorf("Expected a TP below 3x the entry-to-stop distance to be rejected, but got %v", err)
+	}
+
+	enough := []Decision{{Symbol: "BTCUSDT", Action: "open_short", EntryPrice: 100, StopLoss: 102, TakeProfit: 94}}
+	if err := validateRewardMultiple(enough, 3); err != nil {
+		t.Errorf("Expected a 3R short to pass, but got %v", err)
+	}
+	if err := validateRewardMultiple(short, 0); err != nil {
+		t.Errorf("Expected the check to be disabled without a minimum, but got %v", err)
+	}
+}
+
+func TestSizeRiskConsistency(t *testing.T) {
+	// 1000 USD with a 2% stop risks 20 USD
+	consistent := Decision{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 100, PositionSizeUSD: 1000, StopLoss: 98, TakeProfit: 110, RiskUSD: 21}
+	inconsistent := Decision{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 100, PositionSizeUSD: 1000, StopLoss: 98, TakeProfit: 110, RiskUSD: 60}
+
+	kept, trace := applySizeRiskConsistency([]Decision{consistent, inconsistent}, 10, "")
+	if len(kept) != 2 {
+		t.Errorf("Expected flag policy to keep both decisions, but got %d", len(kept))
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "risk_usd为60.00") || !strings.Contains(trace[0], "仅标记") {
+		t.Errorf("Expected only the inconsistent size/risk pair to be flagged, but got %v", trace)
+	}
+
+	kept, trace = applySizeRiskConsistency([]Decision{consistent, inconsistent}, 10, "reject")
+	if len(kept) != 1 || kept[0].RiskUSD != 21 || len(trace) != 1 {
+		t.Errorf("Expected reject policy to drop the inconsistent decision, but got %v (trace %v)", kept, trace)
+	}
+
+	if kept, trace := applySizeRiskConsistency([]Decision{inconsistent}, 0, "reject"); len(kept) != 1 || trace != nil {
+		t.Errorf("Expected the check to be disabled without a tolerance, but got %v %v", kept, trace)
+	}
+}
+
+func TestValidateMACDMomentum(t *testing.T) {
+	marketData := map[string]*market.Data{
+		"BTCUSDT": {Symbol: "BTCUSDT", CurrentMACD: 8, IntradaySeries: &market.IntradayData{MACDValues: []float64{12, 10, 8}}},
+		"ETHUSDT": {Symbol: "ETHUSDT", CurrentMACD: 5, IntradaySeries: &market.IntradayData{MACDValues: []float64{2, 3, 5}}},
+	}
+
+	// Positive but falling MACD
+	fading := []Decision{{Symbol: "BTCUSDT", Action: "open_long"}}
+	if err := validateMACDMomentum(fading, marketData); err == nil || !strings.Contains(err.Error(), "MACD未上行") {
+		t.Errorf("Expected a long against falling MACD to be rejected, but got %v", err)
+	}
+
+	rising := []Decision{{Symbol: "ETHUSDT", Action: "open_long"}, {Symbol: "BTCUSDT", Action: "open_short"}}
+	if err := validateMACDMomentum(rising, marketData); err != nil {
+		t.Errorf("Expected opens with MACD momentum to pass, but got %v", err)
+	}
+}
+
+func TestValidateStopRiskWithinRiskUSD(t *testing.T) {
+	// 1000 USDT at 100 is 10 SOL; a stop at 90 risks 100 USDT against a declared 20
+	far := []Decision{{Symbol: "SOLUSDT", Action: "open_long", EntryPrice: 100, PositionSizeUSD: 1000, StopLoss: 90, TakeProfit: 130, RiskUSD: 20}}
+	if err := validateStopRiskWithinRiskUSD(far, 10); err == nil || !strings.Contains(err.Error(), "止损风险100.00 USDT超过声明的risk_usd 20.00") {
+		t.Errorf("Expected a far stop exceeding the declared risk to be rejected, but got %v", err)
+	}
+
+	// A stop at 98 risks 20 USDT, within 10% of the declared 19
+	near := []Decision{{Symbol: "SOLUSDT", Action: "open_long", EntryPrice: 100, PositionSizeUSD: 1000, StopLoss: 98, TakeProfit: 110, RiskUSD: 19}}
+	if err := validateStopRiskWithinRiskUSD(near, 10); err != nil {
+		t.Errorf("Expected risk within tolerance to pass, but got %v", err)
+	}
+	if err := validateStopRiskWithinRiskUSD(near, 0); err == nil {
+		t.Errorf("Expected risk above the declared amount to fail without tolerance")
+	}
+}
+
+func TestWeightedValidatorQuorum(t *testing.T) {
+	sharp := newFakeClient(t, replyWith("AGREE"))
+	noisy := newFakeClient(t, replyWith("DISAGREE"))
+	validators := []Validator{{Name: "sharp", Client: sharp}, {Name: "noisy", Client: noisy}}
+	decisions := []Decision{{Symbol: "BTCUSDT", Action: "open_long"}, {Symbol: "ETHUSDT", Action: "close_long"}}
+
+	ctx := &Context{ValidatorAccuracy: map[string]float64{"sharp": 0.8, "noisy": 0.35}}
+	final, trace, votes := crossValidateWithValidators(ctx, decisions, validators, nil)
+	if len(final) != 2 {
+		t.Fatalf("Expected the high-accuracy AGREE to outweigh the low-accuracy DISAGREE, but got %v (trace %v)", final, trace)
+	}
+	if len(votes) != 2 || !votes[0].Agree || votes[1].Agree {
+		t.Errorf("Expected one AGREE and one DISAGREE vote, but got %+v", votes)
+	}
+	if !strings.Contains(trace[len(trace)-1], "同意0.80 vs 反对0.35") {
+		t.Errorf("Expected a weighted tally in the trace, but got %v", trace)
+	}
+
+	// Manual weights override historical accuracy
+	ctx.ValidatorWeights = map[string]float64{"noisy": 2}
+	if final, _, _ := crossValidateWithValidators(ctx, decisions, validators, nil); len(final) != 1 || final[0].Symbol != "ETHUSDT" {
+		t.Errorf("Expected the overridden noisy weight to reject the open, but got %v", final)
+	}
+}
+
+func TestDailyReentryCap(t *testing.T) {
+	ctx := &Context{
+		MaxDailyReentries: 2,
+		OpensToday:        map[string]int{"DOGEUSDT": 2, "SOLUSDT": 1},
+	}
+	decisions := []Decision{
+		{Symbol: "DOGEUSDT", Action: "open_long"},
+		{Symbol: "DOGEUSDT", Action: "close_short"},
+		{Symbol: "BTCUSDT", Action: "open_long"},
+		{Symbol: "SOLUSDT", Action: "open_short"},
+	}
+
+	kept, trace := applyDailyReentryCap(ctx, decisions)
+	if len(kept) != 3 {
+		t.Fatalf("Expected only the DOGEUSDT open to be blocked, but got %+v", kept)
+	}
+	for _, d := range kept {
+		if d.Symbol == "DOGEUSDT" && d.Action == "open_long" {
+			t.Errorf("Expected DOGEUSDT opened twice today to be blocked")
+		}
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "今日已开仓2次") {
+		t.Errorf("Expected one re-entry trace for DOGEUSDT, but got %v", trace)
+	}
+	if ctx.OpensToday["SOLUSDT"] != 1 {
+		t.Errorf("Expected the caller's open counts to be left untouched")
+	}
+}
+
+func TestPrimarySystemPromptIncludesValidationRules(t *testing.T) {
+	ctx := &Context{Account: AccountInfo{TotalEquity: 1000}, BTCETHLeverage: 10, AltcoinLeverage: 5}
+
+	if strings.Contains(buildPrimarySystemPrompt(ctx), ValidationRules()) {
+		t.Errorf("Expected validation rules to be omitted by default")
+	}
+
+	ctx.IncludeValidationRules = true
+	prompt := buildPrimarySystemPrompt(ctx)
+	if !strings.Contains(prompt, "交易规则 (VWAP策略)") {
+		t.Errorf("Expected the primary VWAP rules in the combined prompt")
+	}
+	if !strings.Contains(prompt, ValidationRules()) {
+		t.Errorf("Expected the validator's rules in the combined prompt")
+	}
+}
+
+func TestEmptyReasoningPolicy(t *testing.T) {
+	decisions := []Decision{
+		{Symbol: "BTCUSDT", Action: "open_long"},
+		{Symbol: "ETHUSDT", Action: "open_short", Reasoning: "lost VWAP"},
+		{Symbol: "SOLUSDT", Action: "wait"},
+	}
+
+	if kept, trace := applyEmptyReasoningPolicy(decisions, ""); len(kept) != 3 || len(trace) != 0 {
+		t.Errorf("Expected the lenient default to pass everything silently, but got %d decisions and %v", len(kept), trace)
+	}
+
+	kept, trace := applyEmptyReasoningPolicy(decisions, "flag")
+	if len(kept) != 3 {
+		t.Errorf("Expected flagging to keep all decisions, but got %d", len(kept))
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "BTCUSDT open_long") {
+		t.Errorf("Expected the BTCUSDT open to be flagged, but got %v", trace)
+	}
+
+	kept, trace = applyEmptyReasoningPolicy(decisions, "reject")
+	if len(kept) != 2 || kept[0].Symbol != "ETHUSDT" {
+		t.Errorf("Expected the BTCUSDT open to be rejected, but got %+v", kept)
+	}
+	if rejected := rejectedBetween(decisions, kept, trace, "validation", "缺少开仓理由"); len(rejected) != 1 || rejected[0].Detail == "" {
+		t.Errorf("Expected the rejection to be recorded with its trace, but got %+v", rejected)
+	}
+}
+
+func TestSharpeFloorBlocksOpens(t *testing.T) {
+	ctx := &Context{
+		Account:        AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		Performance:    map[string]interface{}{"sharpe_ratio": -1.5},
+		MinSharpeRatio: -1.0,
+	}
+	decisions := []Decision{
+		{Symbol: "BTCUSDT", Action: "open_long"},
+		{Symbol: "ETHUSDT", Action: "close_long"},
+	}
+
+	kept, trace := applySharpeFloor(ctx, decisions)
+	if len(kept) != 1 || kept[0].Action != "close_long" {
+		t.Errorf("Expected only the close to be kept, but got %+v", kept)
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "夏普比率过低") {
+		t.Errorf("Expected one suppression trace entry, but got %v", trace)
+	}
+	if !strings.Contains(buildUserPrompt(ctx), "本周期禁止新开仓") {
+		t.Errorf("Expected the prompt to contain a caution directive")
+	}
+
+	ctx.Performance = map[string]interface{}{"sharpe_ratio": -0.5}
+	if kept, _ := applySharpeFloor(ctx, decisions); len(kept) != 2 {
+		t.Errorf("Expected opens to pass above the floor, but got %d", len(kept))
+	}
+}
+
+func TestSnapLeverageToBrackets(t *testing.T) {
+	allowed := map[string][]int{"DOGEUSDT": {5, 10, 20}}
+	decisions := []Decision{
+		{Symbol: "DOGEUSDT", Action: "open_long", Leverage: 15},
+		{Symbol: "BTCUSDT", Action: "open_long", Leverage: 15},
+		{Symbol: "DOGEUSDT", Action: "open_short", Leverage: 3},
+	}
+
+	trace := snapLeverageToBrackets(decisions, allowed)
+	if decisions[0].Leverage != 10 {
+		t.Errorf("Expected 15x to snap down to 10x, but got %dx", decisions[0].Leverage)
+	}
+	if decisions[1].Leverage != 15 {
+		t.Errorf("Expected a symbol without brackets to keep 15x, but got %dx", decisions[1].Leverage)
+	}
+	if len(trace) != 1 || !strings.Contains(trace[0], "15x") {
+		t.Errorf("Expected one snap trace entry, but got %v", trace)
+	}
+
+	if err := validateLeverageBrackets(decisions[:2], allowed); err != nil {
+		t.Errorf("Expected snapped leverage to re-validate, but got %v", err)
+	}
+	if err := validateLeverageBrackets(decisions, allowed); err == nil {
+		t.Errorf("Expected 3x below the lowest bracket to fail validation")
+	}
+}
+
+func TestCycleGuardRejectsRapidCalls(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+	calls := 0
+	client := newFakeClient(t, func(string, string) (string, int) {
+		calls++
+		return "[]", http.StatusOK
+	})
+
+	guard := NewCycleGuard(time.Minute)
+	newCtx := func() *Context {
+		return &Context{
+			Account:         AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+			CandidateCoins:  []CandidateCoin{},
+			BTCETHLeverage:  10,
+			AltcoinLeverage: 5,
+			CycleGuard:      guard,
+		}
+	}
+
+	if _, err := GetFullDecision(newCtx(), client, client); err != nil {
+		t.Fatalf("Expected the first call to succeed, but got %v", err)
+	}
+	if _, err := GetFullDecision(newCtx(), client, client); !errors.Is(err, ErrCycleTooSoon) {
+		t.Errorf("Expected ErrCycleTooSoon for an immediate second call, but got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected only the first call to reach the model, but got %d calls", calls)
+	}
+
+	if err := guard.Allow(time.Now().Add(2 * time.Minute)); err != nil {
+		t.Errorf("Expected a call after the interval to be allowed, but got %v", err)
+	}
+
+	// A failed primary call does not use up the interval
+	guard = NewCycleGuard(time.Minute)
+	failing := newFakeClient(t, func(string, string) (string, int) { return "upstream unavailable", http.StatusInternalServerError })
+	failedCtx := newCtx()
+	failedCtx.PrimaryMaxRetries = 1
+	if _, err := GetFullDecision(failedCtx, failing, client); err == nil || errors.Is(err, ErrCycleTooSoon) {
+		t.Fatalf("Expected the primary call to fail, but got %v", err)
+	}
+	if _, err := GetFullDecision(newCtx(), client, client); err != nil {
+		t.Errorf("Expected a retry right after a failed primary call to be allowed, but got %v", err)
+	}
+}
+
+func TestValidationSuffixIsIdempotent(t *testing.T) {
+	validator := newFakeClient(t, func(_, _ string) (string, int) {
+		return "AGREE", http.StatusOK
+	})
+
+	for _, suffix := range []string{"", " [validated]"} {
+		ctx := &Context{ValidationSuffix: suffix}
+		decisions := []Decision{{Symbol: "BTCUSDT", Action: "open_long", Reasoning: "breakout"}}
+
+		once, _ := crossValidateDecisions(ctx, decisions, validator)
+		twice, _ := crossValidateDecisions(ctx, once, validator)
+		if len(twice) != 1 {
+			t.Fatalf("Expected decision to pass validation twice, but got %v", twice)
+		}
+
+		expected := suffix
+		if expected == "" {
+			expected = defaultValidationSuffix
+		}
+		if twice[0].Reasoning != "breakout"+expected {
+			t.Errorf("Expected suffix %q to appear exactly once, but got %q", expected, twice[0].Reasoning)
+		}
+	}
+}
+
+func TestSymbolAliasesMergeMarketAndOIData(t *testing.T) {
+	var fetched []string
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		fetched = append(fetched, symbol)
+		return &market.Data{Symbol: symbol, CurrentPrice: 60000, CurrentVWAP: 59900,
+			OpenInterest: &market.OIData{Latest: 1000}}, nil
+	})
+	original := fetchOITopPositions
+	fetchOITopPositions = func() ([]pool.OIPosition, error) {
+		return []pool.OIPosition{{Symbol: "XBTUSDT", Rank: 1, OIDeltaPercent: 5}}, nil
+	}
+	t.Cleanup(func() { fetchOITopPositions = original })
+
+	ctx := &Context{
+		Account: AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "XBTUSDT", Sources: []string{"oi_top"}},
+			{Symbol: "BTCUSDT", Sources: []string{"ai500"}},
+		},
+		SymbolAliases: map[string]string{"XBTUSDT": "BTCUSDT"},
+	}
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		t.Fatalf("fetchMarketDataForContext failed: %v", err)
+	}
+
+	if len(fetched) != 1 || fetched[0] != "BTCUSDT" {
+		t.Errorf("Expected a single fetch under the canonical symbol, but got %v", fetched)
+	}
+	if len(ctx.CandidateCoins) != 1 || len(ctx.CandidateCoins[0].Sources) != 2 {
+		t.Errorf("Expected aliased candidates to merge with both sources, but got %+v", ctx.CandidateCoins)
+	}
+	if _, ok := ctx.MarketDataMap["BTCUSDT"]; !ok {
+		t.Errorf("Expected market data keyed by BTCUSDT")
+	}
+	if oi, ok := ctx.OITopDataMap["BTCUSDT"]; !ok || oi.Rank != 1 {
+		t.Errorf("Expected OI data for XBTUSDT to be keyed by BTCUSDT, but got %v", ctx.OITopDataMap)
+	}
+
+	decisions := []Decision{{Symbol: "XBTUSDT", Action: "wait"}}
+	applySymbolAliases(decisions, ctx.SymbolAliases)
+	if decisions[0].Symbol != "BTCUSDT" {
+		t.Errorf("Expected decision symbol to be canonicalized, but got %s", decisions[0].Symbol)
+	}
+}
+
+func TestTieBreakerOverridesDisagree(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+	primary := newFakeClient(t, replyWith(`[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":1000,"stop_loss":95,"take_profit":120,"reasoning":"breakout"}]`))
+	secondary := newFakeClient(t, replyWith("DISAGREE"))
+	tieBreaker := newFakeClient(t, replyWith("AGREE"))
+	newCtx := func() *Context {
+		return &Context{
+			Account:         AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+			CandidateCoins:  []CandidateCoin{{Symbol: "BTCUSDT"}},
+			BTCETHLeverage:  10,
+			AltcoinLeverage: 5,
+		}
+	}
+
+	decision, err := GetFullDecisionWithTieBreaker(newCtx(), primary, secondary, tieBreaker)
+	if err != nil {
+		t.Fatalf("GetFullDecisionWithTieBreaker failed: %v", err)
+	}
+	if len(decision.Decisions) != 1 || decision.Decisions[0].Symbol != "BTCUSDT" {
+		t.Fatalf("Expected tie-breaker AGREE to keep the decision, but got %v", decision.Decisions)
+	}
+	trace := strings.Join(decision.ValidationTrace, "\n")
+	if !strings.Contains(trace, "DISAGREE") || !strings.Contains(trace, "仲裁") || !strings.Contains(trace, "tie_breaker)同意") {
+		t.Errorf("Expected the trace to record the disagreement and the tie-breaker vote, but got %v", decision.ValidationTrace)
+	}
+	if len(decision.ValidatorVotes) != 2 || decision.ValidatorVotes[1].Validator != "tie_breaker" || !decision.ValidatorVotes[1].Agree {
+		t.Errorf("Expected secondary and tie-breaker votes, but got %+v", decision.ValidatorVotes)
+	}
+
+	// Without a tie-breaker the disagreement still drops the decision
+	decision, err = GetFullDecision(newCtx(), primary, secondary)
+	if err != nil {
+		t.Fatalf("GetFullDecision failed: %v", err)
+	}
+	if len(decision.Decisions) != 0 {
+		t.Errorf("Expected the decision to be dropped without a tie-breaker, but got %v", decision.Decisions)
+	}
+}
+
+func TestExtractDecisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		symbol   string
+		action   string
+	}{
+		{
+			name: "fenced block followed by commentary",
+			response: "分析：BTC区间[60000, 61000]震荡\n```json\n" +
+				`[{"symbol": "BTCUSDT", "action": "open_long", "reasoning": "突破"}]` +
+				"\n```\n补充说明：如果跌破支撑则考虑 [止损]",
+			symbol: "BTCUSDT",
+			action: "open_long",
+		},
+		{
+			name: "draft array is invalid, final array wins",
+			response: `草稿: [{"symbol": "ETHUSDT", "action": 1}]` + "\n最终:\n" +
+				`[{"symbol": "SOLUSDT", "action": "open_short"}]` + "\n以上为最终决策",
+			symbol: "SOLUSDT",
+			action: "open_short",
+		},
+		{
+			name: "bracket inside reasoning string",
+			response: "关注数据 [1, 2, [3]]\n" +
+				`[{"symbol": "BTCUSDT", "action": "hold", "reasoning": "等待回到 [60000 区间] 再判断"}]`,
+			symbol: "BTCUSDT",
+			action: "hold",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions, err := extractDecisions(tt.response)
+			if err != nil {
+				t.Fatalf("extractDecisions failed: %v", err)
+			}
+			if len(decisions) != 1 || decisions[0].Symbol != tt.symbol || decisions[0].Action != tt.action {
+				t.Errorf("Expected a single %s %s decision, but got %+v", tt.action, tt.symbol, decisions)
+			}
+		})
+	}
+
+	if _, err := extractDecisions("仅有数字列表 [1, 2, 3]"); err == nil {
+		t.Errorf("Expected an error when no array unmarshals into decisions")
+	}
+}
+
+func TestMarketDataAgeInPrompt(t *testing.T) {
+	ctx := &Context{
+		Account:        AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins: []CandidateCoin{{Symbol: "ETHUSDT"}},
+		MarketDataMap: map[string]*market.Data{
+			"ETHUSDT": {Symbol: "ETHUSDT", CurrentPrice: 3000, FetchedAt: time.Now().Add(-45 * time.Second)},
+		},
+	}
+
+	if prompt := buildUserPrompt(ctx); strings.Contains(prompt, "数据时效") {
+		t.Errorf("Expected no age annotation when disabled, but got:\n%s", prompt)
+	}
+
+	ctx.IncludeMarketDataAge = true
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "数据时效: 45秒前获取") {
+		t.Errorf("Expected a 45s age annotation, but got:\n%s", prompt)
+	}
+}
+
+func TestDryRunSkipsCrossValidation(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+	primary := newFakeClient(t, replyWith(`[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":1000,"stop_loss":95,"take_profit":120,"reasoning":"breakout"}]`))
+	ctx := &Context{
+		Account:         AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins:  []CandidateCoin{{Symbol: "BTCUSDT"}},
+		BTCETHLeverage:  10,
+		AltcoinLeverage: 5,
+		DryRun:          true,
+	}
+
+	decision, err := GetFullDecision(ctx, primary, nil)
+	if err != nil {
+		t.Fatalf("GetFullDecision failed: %v", err)
+	}
+	if len(decision.Decisions) != 1 || decision.Decisions[0].Reasoning != "breakout" || decision.Decisions[0].PositionSizeUSD != 1000 {
+		t.Fatalf("Expected the open decision to be returned unmodified, but got %+v", decision.Decisions)
+	}
+	if len(decision.ValidationTrace) != 1 || decision.ValidationTrace[0] != "(validation skipped)" {
+		t.Errorf("Expected a single skipped-validation trace entry, but got %v", decision.ValidationTrace)
+	}
+	if len(decision.ValidatorVotes) != 0 || len(decision.Rejected) != 0 {
+		t.Errorf("Expected no votes or rejections, but got %+v and %+v", decision.ValidatorVotes, decision.Rejected)
+	}
+}
+
+// meanReversionStrategy is a custom strategy used to check that prompts come from Context.Strategy.
+type meanReversionStrategy struct{}
+
+func (meanReversionStrategy) SystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int) string {
+	return fmt.Sprintf("BOLLINGER MEAN REVERSION equity=%.0f lev=%d/%d", accountEquity, btcEthLeverage, altcoinLeverage)
+}
+
+func (meanReversionStrategy) ValidationPrompt(ctx *Context, decision *Decision) string {
+	return "BOLLINGER CHECK " + decision.Symbol
+}
+
+func TestCustomStrategyPrompts(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+	var sentSystem string
+	primary := newFakeClient(t, func(systemPrompt, userPrompt string) (string, int) {
+		sentSystem = systemPrompt
+		return `[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":1000,"stop_loss":95,"take_profit":120,"reasoning":"band touch"}]`, http.StatusOK
+	})
+	var sentValidation string
+	secondary := newFakeClient(t, func(systemPrompt, userPrompt string) (string, int) {
+		sentValidation = userPrompt
+		return "AGREE", http.StatusOK
+	})
+	ctx := &Context{
+		Account:         AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins:  []CandidateCoin{{Symbol: "BTCUSDT"}},
+		BTCETHLeverage:  10,
+		AltcoinLeverage: 5,
+		Strategy:        meanReversionStrategy{},
+	}
+
+	if _, err := GetFullDecision(ctx, primary, secondary); err != nil {
+		t.Fatalf("GetFullDecision failed: %v", err)
+	}
+	if sentSystem != "BOLLINGER MEAN REVERSION equity=1000 lev=10/5" {
+		t.Errorf("Expected the custom strategy's system prompt to be sent, but got %q", sentSystem)
+	}
+	if sentValidation != "BOLLINGER CHECK BTCUSDT" {
+		t.Errorf("Expected the custom strategy's validation prompt to be sent, but got %q", sentValidation)
+	}
+
+	if prompt := buildPrimarySystemPrompt(&Context{Account: ctx.Account, BTCETHLeverage: 10, AltcoinLeverage: 5}); !strings.Contains(prompt, "VWAP") {
+		t.Errorf("Expected the VWAP strategy by default")
+	}
+}
+
+func TestConsensusQuorumAcceptsWithFailedValidator(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+	primary := newFakeClient(t, replyWith(`[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":1000,"stop_loss":95,"take_profit":120,"reasoning":"breakout"}]`))
+	validators := []*mcp.Client{
+		newFakeClient(t, replyWith("AGREE")),
+		newFakeClient(t, replyWith("AGREE")),
+		newFakeClient(t, func(string, string) (string, int) {
+			return "upstream unavailable", http.StatusInternalServerError
+		}),
+	}
+	ctx := &Context{
+		Account:                AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins:         []CandidateCoin{{Symbol: "BTCUSDT"}},
+		BTCETHLeverage:         10,
+		AltcoinLeverage:        5,
+		ValidationMaxRetries:   1,
+		ValidationRetryBackoff: time.Millisecond,
+		ValidationQuorum:       2,
+	}
+
+	decision, err := GetFullDecisionWithConsensus(ctx, primary, validators)
+	if err != nil {
+		t.Fatalf("GetFullDecisionWithConsensus failed: %v", err)
+	}
+	if len(decision.Decisions) != 1 || decision.Decisions[0].Action != "open_long" {
+		t.Fatalf("Expected two AGREE votes to meet the quorum of 2, but got %+v (trace %v)", decision.Decisions, decision.ValidationTrace)
+	}
+	if len(decision.ValidationTrace) != 4 {
+		t.Fatalf("Expected three per-validator entries and a tally, but got %v", decision.ValidationTrace)
+	}
+	if tally := decision.ValidationTrace[3]; !strings.Contains(tally, "同意2/3（法定票数2），通过") {
+		t.Errorf("Expected the consensus tally in the trace, but got %q", tally)
+	}
+
+	// 调用失败按反对计，3票法定数无法达到
+	ctx.ValidationQuorum = 3
+	if decision, err := GetFullDecisionWithConsensus(ctx, primary, validators); err != nil || len(decision.Decisions) != 0 {
+		t.Errorf("Expected the failed validator to count as DISAGREE under a quorum of 3, but got %+v (err: %v)", decision, err)
+	}
+
+	// 即使配置为调用失败时采纳，共识模式下两个故障加一票AGREE也达不到法定票数2
+	failing := func(string, string) (string, int) { return "upstream unavailable", http.StatusInternalServerError }
+	outages := []*mcp.Client{newFakeClient(t, replyWith("AGREE")), newFakeClient(t, failing), newFakeClient(t, failing)}
+	ctx.ValidationQuorum = 2
+	ctx.ValidationFailurePolicy = "accept"
+	decision, err = GetFullDecisionWithConsensus(ctx, primary, outages)
+	if err != nil || len(decision.Decisions) != 0 {
+		t.Fatalf("Expected failed validators to count as DISAGREE under the accept policy, but got %+v (err: %v)", decision, err)
+	}
+	if tally := decision.ValidationTrace[3]; !strings.Contains(tally, "同意1/3（法定票数2），拒绝") {
+		t.Errorf("Expected only the real AGREE to be tallied, but got %q", tally)
+	}
+}
+
+func TestValidationConfidenceFloor(t *testing.T) {
+	decisions := []Decision{{Symbol: "BTCUSDT", Action: "open_long", Reasoning: "breakout"}}
+	ctx := &Context{RequireValidationConfidence: true, ValidationConfidenceFloor: 60}
+
+	cases := []struct {
+		reply    string
+		accepted bool
+		trace    string
+	}{
+		{"AGREE 40", false, "信心度40低于下限60"},
+		{"AGREE 80", true, "通过 (AGREE, 信心度80)"},
+		{"DISAGREE 90", false, "DISAGREE, 信心度90"},
+		{"AGREE", false, "无法解析验证结论"},
+	}
+	for _, tc := range cases {
+		validator := newFakeClient(t, replyWith(tc.reply))
+		final, trace := crossValidateDecisions(ctx, decisions, validator)
+		if (len(final) == 1) != tc.accepted {
+			t.Errorf("Reply %q: expected accepted=%v, but got %v", tc.reply, tc.accepted, final)
+		}
+		if len(trace) != 1 || !strings.Contains(trace[0], tc.trace) {
+			t.Errorf("Reply %q: expected trace to contain %q, but got %v", tc.reply, tc.trace, trace)
+		}
+	}
+
+	if prompt := buildValidationPrompt(ctx, &decisions[0]); !strings.Contains(prompt, "'AGREE <0-100>' 或 'DISAGREE <0-100>'") {
+		t.Errorf("Expected the validation prompt to ask for a confidence, but got %s", prompt)
+	}
+}
+
+func TestRiskRewardUsesCurrentPrice(t *testing.T) {
+	lev := leverageRule{btcEth: 10, altcoin: 5}
+	// Stop 95, target 120: 4:1 when assuming entry at 20% of the range (100)
+	decisions := []Decision{{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 500, StopLoss: 95, TakeProfit: 120}}
+	if err := validateDecisions(decisions, 1000, lev, riskRewardRule{}, nil, 0); err != nil {
+		t.Fatalf("Expected the 20%% entry assumption to pass without market data, but got %v", err)
+	}
+
+	// At the real price of 110 the trade risks 15 to make 10
+	marketData := map[string]*market.Data{"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 110}}
+	fillEntryPrices(decisions, marketData)
+	if err := validateDecisions(decisions, 1000, lev, riskRewardRule{}, nil, 0); err == nil || !strings.Contains(err.Error(), "风险回报比过低(0.67:1)") {
+		t.Errorf("Expected the real entry to fail the risk/reward check, but got %v", err)
+	}
+
+	// A price already below the stop is left to validateStopsAgainstPrice
+	marketData["BTCUSDT"].CurrentPrice = 94
+	fillEntryPrices(decisions, marketData)
+	if decisions[0].EntryPrice != 94 {
+		t.Errorf("Expected the open to record the current price as its entry, but got %.2f", decisions[0].EntryPrice)
+	}
+	if err := validateStopsAgainstPrice(decisions); err == nil || !strings.Contains(err.Error(), "必须低于当前价(94.0000)") {
+		t.Errorf("Expected a price already below the stop to be rejected, but got %v", err)
+	}
+
+	// An entry_price sent by the model is replaced by the current price, with a trace
+	decisions[0].EntryPrice = 100
+	if trace := fillEntryPrices(decisions, marketData); decisions[0].EntryPrice != 94 || len(trace) != 1 || !strings.Contains(trace[0], "entry_price 100.0000 已替换为当前价 94.0000") {
+		t.Errorf("Expected the model's entry_price to be replaced with a trace, but got %.2f (trace %v)", decisions[0].EntryPrice, trace)
+	}
+}
+
+func TestDrawdownDeRiskLeverage(t *testing.T) {
+	rr := riskRewardRule{}
+	open := func() []Decision {
+		return []Decision{{Symbol: "BTCUSDT", Action: "open_long", EntryPrice: 100, Leverage: 20, PositionSizeUSD: 500, StopLoss: 98, TakeProfit: 107}}
+	}
+
+	// Drawdown at the configured de-risk level halves the 20x cap
+	lev := leverageRule{btcEth: 20, altcoin: 10, scale: drawdownLeverageScale(10, 10)}
+	if err := validateDecisions(open(), 1000, lev, rr, nil, 0); err == nil || !strings.Contains(err.Error(), "上限10倍") {
+		t.Errorf("Expected an uncapped 20x open to exceed the de-risked 10x cap, but got %v", err)
+	}
+	decisions := open()
+	trace := capLeverageForDrawdown(decisions, lev, 10)
+	if decisions[0].Leverage != 10 || len(trace) != 1 || !strings.Contains(trace[0], "已调整为 10x") {
+		t.Fatalf("Expected the 20x request to be capped to 10x, but got %dx (trace %v)", decisions[0].Leverage, trace)
+	}
+	if err := validateDecisions(decisions, 1000, lev, rr, nil, 0); err != nil {
+		t.Errorf("Expected the capped open to pass validation, but got %v", err)
+	}
+
+	// Halfway to the de-risk level scales the cap by 75%; no drawdown leaves it untouched
+	if got := (leverageRule{btcEth: 20, scale: drawdownLeverageScale(5, 10)}).maxFor("BTCUSDT"); got != 15 {
+		t.Errorf("Expected a 15x cap at half the de-risk drawdown, but got %dx", got)
+	}
+	if got := drawdownLeverageScale(0, 10); got != 1 {
+		t.Errorf("Expected no reduction without drawdown, but got %.2f", got)
+	}
+}
+
+func TestRiskUSDMatchesStopDistance(t *testing.T) {
+	// 1000 USD with a stop 2% away risks 20 USD
+	d := Decision{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 1000, StopLoss: 98, TakeProfit: 110, RiskUSD: 20}
+	if got := ComputeRiskUSD(&d, 100); got != 20 {
+		t.Errorf("Expected 20 USD of risk, but got %.4f", got)
+	}
+	if got := ComputeRiskUSD(&d, 0); got != 0 {
+		t.Errorf("Expected 0 without an entry price, but got %.4f", got)
+	}
+
+	ctx := &Context{
+		MarketDataMap:        map[string]*market.Data{"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 100}},
+		SizeRiskTolerancePct: 50,
+		SizeRiskPolicy:       "reject",
+	}
+	response := func(riskUSD string) string {
+		return `[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":1000,"stop_loss":98,"take_profit":110,"risk_usd":` + riskUSD + `,"reasoning":"breakout"}]`
+	}
+	full, err := parseFullDecisionResponse(response("20"), ctx, 1000, 10, 5)
+	if err != nil || len(full.Decisions) != 1 {
+		t.Fatalf("Expected a consistent risk_usd to pass, but got %+v (err: %v)", full, err)
+	}
+
+	// Claims 2 USD of risk while the position and stop actually risk 20
+	full, err = parseFullDecisionResponse(response("2"), ctx, 1000, 10, 5)
+	if err != nil || len(full.Decisions) != 0 {
+		t.Fatalf("Expected a mismatched risk_usd to be dropped, but got %+v (err: %v)", full, err)
+	}
+	if len(full.Rejected) != 1 || full.Rejected[0].Reason != "仓位与风险不一致" || !strings.Contains(full.Rejected[0].Detail, "按止损推算风险20.00 USD") {
+		t.Errorf("Expected the mismatch to be recorded as a validation rejection, but got %+v", full.Rejected)
+	}
+}
+
+func TestRetryUnparseablePrimaryOutput(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+	calls := 0
+	var retryPrompt string
+	primary := newFakeClient(t, func(_, userPrompt string) (string, int) {
+		calls++
+		if calls == 1 {
+			return "BTC looks strong here, I would wait for a pullback before entering.", http.StatusOK
+		}
+		retryPrompt = userPrompt
+		return `[{"symbol":"BTCUSDT","action":"wait","reasoning":"waiting for a pullback"}]`, http.StatusOK
+	})
+	newCtx := func(retry bool) *Context {
+		return &Context{
+			Account:                AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+			CandidateCoins:         []CandidateCoin{{Symbol: "BTCUSDT"}},
+			BTCETHLeverage:         10,
+			AltcoinLeverage:        5,
+			RetryUnparseableOutput: retry,
+		}
+	}
+
+	decision, err := GetFullDecision(newCtx(true), primary, nil)
+	if err != nil {
+		t.Fatalf("Expected the retried response to parse, but got %v", err)
+	}
+	if calls != 2 || !strings.Contains(retryPrompt, "请只返回JSON数组") {
+		t.Errorf("Expected one stricter re-prompt, but got %d calls (prompt %q)", calls, retryPrompt)
+	}
+	if len(decision.Decisions) != 1 || decision.Decisions[0].Action != "wait" {
+		t.Errorf("Expected the wait decision from the retry, but got %+v", decision.Decisions)
+	}
+	if len(decision.ValidationTrace) == 0 || !strings.Contains(decision.ValidationTrace[0], "格式重试") {
+		t.Errorf("Expected the retry to be recorded in the trace, but got %v", decision.ValidationTrace)
+	}
+
+	// Disabled by default: prose-only output fails after a single call
+	calls = 0
+	if _, err := GetFullDecision(newCtx(false), primary, nil); err == nil || calls != 1 {
+		t.Errorf("Expected a parse failure without retrying, but got %v after %d calls", err, calls)
+	}
+}
+
+func TestFundablePositions(t *testing.T) {
+	ctx := &Context{
+		Account:      AccountInfo{TotalEquity: 1000, AvailableBalance: 300},
+		Positions:    []PositionInfo{{Symbol: "BTCUSDT", Side: "long", MarginUsed: 200}},
+		MaxPositions: 5,
+	}
+
+	// Four slots left, but 300 of free balance only funds one more 200 margin position
+	if got := FundablePositions(ctx, 200); got != 1 {
+		t.Errorf("Expected margin to limit fundable positions to 1, but got %d", got)
+	}
+	if got := FundablePositions(ctx, 50); got != 4 {
+		t.Errorf("Expected the slot cap of 4 to bind with small margins, but got %d", got)
+	}
+	if got := FundablePositions(ctx, 0); got != 4 {
+		t.Errorf("Expected only the slot cap without a typical margin, but got %d", got)
+	}
+
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "只够再开1个新仓**（持仓名额还剩4个）") {
+		t.Errorf("Expected the prompt to warn about fundable positions, but got %s", prompt)
+	}
+}
+
+func TestHardMaxNotionalCap(t *testing.T) {
+	// 60k BTC notional is within 10x of a 10k account
+	decisions := []Decision{{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 60000, StopLoss: 95, TakeProfit: 120}}
+	if err := validateDecisions(decisions, 10000, leverageRule{btcEth: 10, altcoin: 5}, riskRewardRule{}, nil, 0); err != nil {
+		t.Fatalf("Expected the position to pass the equity-multiple cap, but got %v", err)
+	}
+
+	lev := leverageRule{btcEth: 10, altcoin: 5, hardCap: 50000}
+	if err := validateDecisions(decisions, 10000, lev, riskRewardRule{}, nil, 0); err == nil || !strings.Contains(err.Error(), "硬上限50000") {
+		t.Errorf("Expected the hard notional ceiling to reject the position, but got %v", err)
+	}
+}
+
+func TestClosePercentValidation(t *testing.T) {
+	lev := leverageRule{btcEth: 10, altcoin: 5}
+	for _, pct := range []float64{0, 50, 100} {
+		decisions := []Decision{{Symbol: "BTCUSDT", Action: "close_long", ClosePercent: pct}}
+		if err := validateDecisions(decisions, 1000, lev, riskRewardRule{}, nil, 0); err != nil {
+			t.Errorf("Expected close_percent %.0f to be accepted, but got %v", pct, err)
+		}
+	}
+	for _, pct := range []float64{-10, 150} {
+		decisions := []Decision{{Symbol: "BTCUSDT", Action: "close_short", ClosePercent: pct}}
+		if err := validateDecisions(decisions, 1000, lev, riskRewardRule{}, nil, 0); err == nil || !strings.Contains(err.Error(), "平仓比例") {
+			t.Errorf("Expected close_percent %.0f to be rejected, but got %v", pct, err)
+		}
+	}
+
+	// A generic close keeps its percent once resolved; other actions drop it
+	decisions := []Decision{{Symbol: "BTCUSDT", Action: "close", ClosePercent: 50}, {Symbol: "ETHUSDT", Action: "hold", ClosePercent: 50}}
+	normalizeDecisions(decisions, []PositionInfo{{Symbol: "BTCUSDT", Side: "long"}, {Symbol: "ETHUSDT", Side: "short"}})
+	if decisions[0].Action != "close_long" || decisions[0].ClosePercent != 50 || decisions[1].ClosePercent != 0 {
+		t.Errorf("Expected close_long at 50%% and a hold without percent, but got %+v", decisions)
+	}
+}
+
+func TestValidateDecisionSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{
+			name:     "unknown field",
+			raw:      `[{"symbol": "BTCUSDT", "action": "wait"}, {"symbol": "ETHUSDT", "action": "wait", "invalidation_condition": "跌破VWAP"}]`,
+			expected: `决策 #2 包含未知字段 "invalidation_condition"`,
+		},
+		{
+			name:     "non-numeric string leverage",
+			raw:      `[{"symbol": "BTCUSDT", "action": "open_long", "leverage": "10x"}]`,
+			expected: `决策 #1 字段 "leverage" 类型错误: 应为int，实际为string`,
+		},
+		{
+			name:     "misspelled action key",
+			raw:      `[{"symbol": "BTCUSDT", "actoin": "open_long"}]`,
+			expected: `决策 #1 包含未知字段 "actoin"（是否应为 "action"？）`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDecisionSchema(coerceDecisionNumbers(json.RawMessage(tt.raw)))
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("Expected error %q, but got %v", tt.expected, err)
+			}
+			if _, err := extractDecisions(tt.raw); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected extractDecisions to report %q, but got %v", tt.expected, err)
+			}
+		})
+	}
+
+	// String-encoded numbers for leverage and position size are coerced
+	decisions, err := extractDecisions(`[{"symbol": "BTCUSDT", "action": "open_long", "leverage": "10", "position_size_usd": " 2500.5"}]`)
+	if err != nil {
+		t.Fatalf("Expected string numbers to be coerced, but got %v", err)
+	}
+	if decisions[0].Leverage != 10 || decisions[0].PositionSizeUSD != 2500.5 {
+		t.Errorf("Expected leverage 10 and size 2500.5, but got %+v", decisions[0])
+	}
+}
+
+func TestOrderDecisionsByPriority(t *testing.T) {
+	decisions := []Decision{
+		{Symbol: "SOLUSDT", Action: "open_long", Confidence: 70},
+		{Symbol: "XRPUSDT", Action: "wait"},
+		{Symbol: "ETHUSDT", Action: "close_short"},
+		{Symbol: "DOGEUSDT", Action: "open_short", Confidence: 90},
+		{Symbol: "BNBUSDT", Action: "hold"},
+		{Symbol: "BTCUSDT", Action: "close_long"},
+	}
+
+	ordered := orderDecisions(&Context{}, decisions)
+	expected := []string{"ETHUSDT", "BTCUSDT", "XRPUSDT", "BNBUSDT", "DOGEUSDT", "SOLUSDT"}
+	for i, symbol := range expected {
+		if ordered[i].Symbol != symbol {
+			t.Fatalf("Expected order %v, but got %+v", expected, ordered)
+		}
+	}
+	if decisions[0].Symbol != "SOLUSDT" {
+		t.Errorf("Expected the input slice to be left untouched, but got %+v", decisions)
+	}
+
+	if preserved := orderDecisions(&Context{PreserveDecisionOrder: true}, decisions); preserved[0].Symbol != "SOLUSDT" || preserved[5].Symbol != "BTCUSDT" {
+		t.Errorf("Expected the model's order to be kept when disabled, but got %+v", preserved)
+	}
+}
+
+func TestPrimaryRetriesTransientErrors(t *testing.T) {
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+	})
+	// Rate-limited, then a gateway error, then the real answer
+	calls := 0
+	primary := newFakeClient(t, func(string, string) (string, int) {
+		calls++
+		switch calls {
+		case 1:
+			return "rate limited", http.StatusTooManyRequests
+		case 2:
+			return "bad gateway", http.StatusBadGateway
+		}
+		return `[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":1000,"stop_loss":95,"take_profit":120,"reasoning":"third call"}]`, http.StatusOK
+	})
+	ctx := &Context{
+		Account:             AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins:      []CandidateCoin{{Symbol: "BTCUSDT"}},
+		BTCETHLeverage:      10,
+		AltcoinLeverage:     5,
+		DryRun:              true,
+		PrimaryMaxRetries:   3,
+		PrimaryRetryBackoff: time.Millisecond,
+	}
+
+	decision, err := GetFullDecision(ctx, primary, nil)
+	if err != nil {
+		t.Fatalf("Expected the third attempt to succeed, but got %v", err)
+	}
+	if calls != 3 || len(decision.Decisions) != 1 || decision.Decisions[0].Reasoning != "third call" {
+		t.Fatalf("Expected the third call's decision after 3 calls, but got %d calls and %+v", calls, decision.Decisions)
+	}
+	if decision.ValidationTrace[0] != "- 主模型调用: 临时错误重试2次后成功" {
+		t.Errorf("Expected the trace to note 2 retries, but got %v", decision.ValidationTrace)
+	}
+
+	// Client errors are not transient and fail immediately
+	calls = 0
+	rejected := newFakeClient(t, func(string, string) (string, int) {
+		calls++
+		return "bad request", http.StatusBadRequest
+	})
+	if _, err := GetFullDecision(ctx, rejected, nil); err == nil || calls != 1 {
+		t.Errorf("Expected a 400 to fail without retrying, but got %d calls and %v", calls, err)
+	}
+}
+
+func TestMinOITopDelta(t *testing.T) {
+	ctx := &Context{
+		Account: AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "DOGEUSDT", Sources: []string{"oi_top"}},
+			{Symbol: "SOLUSDT", Sources: []string{"ai500", "oi_top"}},
+			{Symbol: "PEPEUSDT", Sources: []string{"oi_top"}},
+		},
+		MarketDataMap: map[string]*market.Data{
+			"DOGEUSDT": {Symbol: "DOGEUSDT", CurrentPrice: 0.1},
+			"SOLUSDT":  {Symbol: "SOLUSDT", CurrentPrice: 150},
+			"PEPEUSDT": {Symbol: "PEPEUSDT", CurrentPrice: 0.00001},
+		},
+		OITopDataMap: map[string]*OITopData{
+			"DOGEUSDT": {Rank: 1, OIDeltaPercent: 12.5, PriceDeltaPercent: 3},
+			"SOLUSDT":  {Rank: 2, OIDeltaPercent: 0.4, PriceDeltaPercent: 0.1},
+			"PEPEUSDT": {Rank: 3, OIDeltaPercent: -0.2},
+		},
+		MinOITopDeltaPct: 2,
+	}
+
+	prompt := buildUserPrompt(ctx)
+
+	if !strings.Contains(prompt, "DOGEUSDT (OI_Top持仓增长)") || !strings.Contains(prompt, "OI_Top排名#1: 持仓量1h变化+12.50%") {
+		t.Errorf("Expected DOGEUSDT above the threshold to keep its OI_Top tag and OI line, but got:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "SOLUSDT (") || strings.Contains(prompt, "OI_Top排名#2") {
+		t.Errorf("Expected SOLUSDT below the threshold to lose its OI_Top emphasis, but got:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "PEPEUSDT (") || strings.Contains(prompt, "OI_Top排名#3") {
+		t.Errorf("Expected PEPEUSDT below the threshold to lose its OI_Top emphasis, but got:\n%s", prompt)
+	}
+
+	ctx.MinOITopDeltaPct = 0
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "SOLUSDT (AI500+OI_Top双重信号)") || !strings.Contains(prompt, "OI_Top排名#3") {
+		t.Errorf("Expected every OI Top coin to be emphasized without a threshold, but got:\n%s", prompt)
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/adshao/go-binance/v2 v2.8.7
 	github.com/ethereum/go-ethereum v1.16.5
 	github.com/gin-gonic/gin v1.11.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/sonirico/go-hyperliquid v0.17.0
 )
 
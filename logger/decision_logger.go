@@ -7,7 +7,9 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,12 +23,58 @@ type DecisionRecord struct {
 	DecisionJSON   string             `json:"decision_json"`   // 决策JSON
 	AccountState   AccountSnapshot    `json:"account_state"`   // 账户状态快照
 	Positions      []PositionSnapshot `json:"positions"`       // 持仓快照
-	CandidateCoins []string           `json:"candidate_coins"` // 候选币种列表
+	CandidateCoins []CandidateRecord  `json:"candidate_coins"` // 候选币种列表（含来源和评分）
 	Decisions      []DecisionAction   `json:"decisions"`       // 执行的决策
 	ExecutionLog   []string           `json:"execution_log"`   // 执行日志
 	Success        bool               `json:"success"`         // 是否成功
 	ErrorMessage   string             `json:"error_message"`   // 错误信息（如果有）
 	MarketData     map[string]MarketDataSnapshot `json:"market_data"`     // 市场数据快照
+
+	RejectedDecisions []RejectedDecision `json:"rejected_decisions,omitempty"` // 被验证/风控过滤掉的决策
+	ValidatorVotes    []ValidatorVote    `json:"validator_votes,omitempty"`    // 各验证模型对开仓决策的投票
+
+	MarketRegime string `json:"market_regime,omitempty"` // 决策时BTC所处的市场状态（up/down/range）
+}
+
+// CandidateRecord 候选币种快照
+type CandidateRecord struct {
+	Symbol  string   `json:"symbol"`            // 币种
+	Sources []string `json:"sources,omitempty"` // 来源: "ai500" 和/或 "oi_top"
+	Score   float64  `json:"score,omitempty"`   // AI500评分
+}
+
+// UnmarshalJSON 兼容旧版日志中只记录币种名的字符串格式
+func (c *CandidateRecord) UnmarshalJSON(data []byte) error {
+	var symbol string
+	if err := json.Unmarshal(data, &symbol); err == nil {
+		*c = CandidateRecord{Symbol: symbol}
+		return nil
+	}
+
+	type candidateRecord CandidateRecord // 避免递归调用UnmarshalJSON
+	var record candidateRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	*c = CandidateRecord(record)
+	return nil
+}
+
+// ValidatorVote 验证模型对开仓决策的投票
+type ValidatorVote struct {
+	Validator string `json:"validator"` // 验证模型名称
+	Symbol    string `json:"symbol"`    // 币种
+	Action    string `json:"action"`    // 决策动作
+	Agree     bool   `json:"agree"`     // 是否同意
+}
+
+// RejectedDecision 被过滤掉（未执行）的决策
+type RejectedDecision struct {
+	Symbol string `json:"symbol"`           // 币种
+	Action string `json:"action"`           // 决策动作
+	Stage  string `json:"stage"`            // 过滤阶段: validation/risk/cross_validation
+	Reason string `json:"reason"`           // 原因分类
+	Detail string `json:"detail,omitempty"` // 详细说明
 }
 
 // MarketDataSnapshot 市场数据快照（用于日志）
@@ -35,6 +83,7 @@ type MarketDataSnapshot struct {
 	CurrentVWAP  float64 `json:"current_vwap"`
 	CurrentRSI7  float64 `json:"current_rsi7"`
 	CurrentMACD  float64 `json:"current_macd"`
+	FundingRate  float64 `json:"funding_rate"` // 资金费率（每8小时结算一次，旧记录为0）
 }
 
 // AccountSnapshot 账户状态快照
@@ -69,12 +118,60 @@ type DecisionAction struct {
 	Timestamp time.Time `json:"timestamp"` // 执行时间
 	Success   bool      `json:"success"`   // 是否成功
 	Error     string    `json:"error"`     // 错误信息
+
+	IntendedQuantity float64 `json:"intended_quantity,omitempty"` // 计划数量（开仓时，仓位大小/决策时价格，用于滑点分析）
+	ClosePercent     float64 `json:"close_percent,omitempty"`     // 部分平仓比例（1-100，0或100表示全部平仓）
+}
+
+// DecisionStore 决策记录存储（文件日志与SQLite存储都实现该接口，调用方可以互换）
+type DecisionStore interface {
+	LogDecision(record *DecisionRecord) error
+	GetLatestRecords(n int) ([]*DecisionRecord, error)
+	GetRecordByDate(date time.Time) ([]*DecisionRecord, error)
+	AnalyzePerformance(lookbackCycles int) (*PerformanceAnalysis, error)
+	GetStatistics() (*Statistics, error)
+	GetStatisticsRange(from, to time.Time) (*Statistics, error)
+	GetOpenCountsByDate(date time.Time) (map[string]int, error)
+	GetValidatorAccuracy(lookbackCycles int) (map[string]float64, error)
+	FlushNotifications(timeout time.Duration) bool
+	Close() error
+}
+
+// recordStore 决策记录的底层存储后端（替代默认的每周期一个JSON文件）
+type recordStore interface {
+	save(record *DecisionRecord, data []byte) error   // 保存一条记录（data为序列化后的JSON）
+	latest(n int) ([]*DecisionRecord, error)          // 最近N条记录（从旧到新）
+	byDate(date time.Time) ([]*DecisionRecord, error) // 指定日期的所有记录
+	all() ([]*DecisionRecord, error)                  // 全部记录
+	deleteBefore(cutoff time.Time) (int, error)       // 删除早于cutoff的记录，返回删除数量
 }
 
 // DecisionLogger 决策日志记录器
 type DecisionLogger struct {
 	logDir      string
 	cycleNumber int
+	store       recordStore // 可选的存储后端（为nil时每个周期写一个JSON文件到logDir）
+
+	sharpeResampleInterval time.Duration // 夏普比率重采样窗口（0表示按周期计算）
+	baseCurrency           string        // 计价货币（默认USDT）
+	scratchBandPct         float64       // 打平区间（盈亏百分比绝对值不超过该值视为打平，0表示关闭）
+	scratchAsLoss          bool          // 计算盈亏比时将打平/零盈亏交易按微小亏损计入
+	roundDecimals          int           // 金额类浮点数保留的小数位数（0表示不取整）
+	markToMarketEquity     bool          // 净值曲线是否按市场数据快照对持仓盯市
+	periodsPerYear         float64       // 每年的收益周期数（用于年化波动率，0表示按重采样窗口推算）
+	feeRatePct             float64       // 单边手续费率（%，用于记录每笔交易的手续费，0表示不计算）
+
+	notifiers     []DecisionNotifier   // 决策记录保存成功后依次调用的通知器
+	notifyMu      sync.Mutex           // 保护notifyQueue的创建与关闭
+	notifyQueue   chan *DecisionRecord // 待发送的通知（后台goroutine逐条发送，避免慢速Webhook阻塞交易周期）
+	notifyClosed  bool                 // Close后不再接收新通知
+	notifyPending sync.WaitGroup       // 已排队但尚未发送完成的通知
+
+	classifyCloses bool          // 是否将"Strategy"平仓细分为 vwap_reversal / time_stop / manual
+	timeStop       time.Duration // 持仓时长达到该值的平仓归为time_stop（0表示不判断）
+
+	maxCoTChars   int  // 保存时思维链的最大字符数（超出时保留首尾摘录，0表示不截断）
+	keepFailedCoT bool // 失败周期保留完整思维链
 }
 
 // NewDecisionLogger 创建决策日志记录器
@@ -89,16 +186,190 @@ func NewDecisionLogger(logDir string) *DecisionLogger {
 	}
 
 	return &DecisionLogger{
-		logDir:      logDir,
-		cycleNumber: 0,
+		logDir:       logDir,
+		cycleNumber:  0,
+		baseCurrency: "USDT",
+	}
+}
+
+// SetSharpeResampleInterval 设置夏普比率的重采样窗口（如1小时）
+// 周期间隔较短时，先将净值按固定时间窗口重采样可以降低噪音；0表示按周期计算
+func (l *DecisionLogger) SetSharpeResampleInterval(interval time.Duration) {
+	l.sharpeResampleInterval = interval
+}
+
+// SetPeriodsPerYear 设置每年的收益周期数（如3分钟周期为175200），用于年化波动率
+// 0表示按夏普重采样窗口推算；两者都未设置时不做年化
+func (l *DecisionLogger) SetPeriodsPerYear(periods float64) {
+	l.periodsPerYear = periods
+}
+
+// SetNotifiers 设置决策通知器，每条决策记录保存成功后在后台依次调用（通知失败只打印日志，不影响记录保存）
+// 应在开始记录前设置，之后不要再修改
+func (l *DecisionLogger) SetNotifiers(notifiers []DecisionNotifier) {
+	l.notifiers = notifiers
+}
+
+// SetCloseClassification 设置是否细分"Strategy"平仓原因（未触及止盈止损的平仓）:
+// manual(本周期AI决策中没有该平仓) > vwap_reversal(平仓价回到入场VWAP另一侧) > time_stop(持仓时长≥timeStop)，都不满足时仍为"Strategy"
+func (l *DecisionLogger) SetCloseClassification(enabled bool, timeStop time.Duration) {
+	l.classifyCloses = enabled
+	l.timeStop = timeStop
+}
+
+// SetMaxCoTChars 设置保存时思维链的最大字符数，超出时只保留首尾摘录并标注截断的字符数（决策JSON不受影响）
+// keepFailed为true时失败周期仍保存完整思维链，便于排查；maxChars<=0表示不截断（默认）
+func (l *DecisionLogger) SetMaxCoTChars(maxChars int, keepFailed bool) {
+	l.maxCoTChars = maxChars
+	l.keepFailedCoT = keepFailed
+}
+
+// SetFeeRatePct 设置单边手续费率（%，如0.04），用于在交易记录中列出开平仓手续费
+// 手续费仅作记录，不从交易盈亏中扣除；0表示不计算（默认）
+func (l *DecisionLogger) SetFeeRatePct(pct float64) {
+	l.feeRatePct = pct
+}
+
+// SetBaseCurrency 设置计价货币（如USDC），用于标注表现分析中的金额类指标
+// 账户快照本身以计价货币记录，因此无需换算
+func (l *DecisionLogger) SetBaseCurrency(currency string) {
+	if currency == "" {
+		currency = "USDT"
+	}
+	l.baseCurrency = currency
+}
+
+// SetScratchBandPct 设置打平区间：盈亏百分比（相对保证金）绝对值不超过该值的交易视为打平，
+// 不计入盈利/亏损次数和胜率；0表示关闭（默认：盈亏>0为盈利，<0为亏损，=0均不计）
+func (l *DecisionLogger) SetScratchBandPct(bandPct float64) {
+	l.scratchBandPct = bandPct
+}
+
+// SetScratchAsLoss 设置盈亏比是否将打平交易（含零盈亏交易）按亏损计入（取盈亏绝对值）
+// 默认关闭：盈亏比=总盈利/总亏损，打平和零盈亏交易不计入分子分母；开启后结果更保守
+func (l *DecisionLogger) SetScratchAsLoss(enabled bool) {
+	l.scratchAsLoss = enabled
+}
+
+// SetRoundDecimals 设置记录和分析结果中金额类浮点数（净值、盈亏、保证金等）保留的小数位数
+// 价格和数量不做取整，以保证开平仓匹配和盈亏计算不受影响；0表示不取整（默认）
+func (l *DecisionLogger) SetRoundDecimals(decimals int) {
+	if decimals < 0 {
+		decimals = 0
+	}
+	l.roundDecimals = decimals
+}
+
+// roundTo 按指定小数位数四舍五入
+func roundTo(value float64, decimals int) float64 {
+	factor := math.Pow(10, float64(decimals))
+	return math.Round(value*factor) / factor
+}
+
+// roundedRecord 返回金额类字段已取整的记录副本（不修改原记录）
+func (l *DecisionLogger) roundedRecord(record *DecisionRecord) *DecisionRecord {
+	if l.roundDecimals <= 0 {
+		return record
+	}
+
+	rounded := *record
+	rounded.AccountState.TotalBalance = roundTo(record.AccountState.TotalBalance, l.roundDecimals)
+	rounded.AccountState.AvailableBalance = roundTo(record.AccountState.AvailableBalance, l.roundDecimals)
+	rounded.AccountState.TotalUnrealizedProfit = roundTo(record.AccountState.TotalUnrealizedProfit, l.roundDecimals)
+	rounded.Positions = make([]PositionSnapshot, len(record.Positions))
+	for i, pos := range record.Positions {
+		pos.UnrealizedProfit = roundTo(pos.UnrealizedProfit, l.roundDecimals)
+		rounded.Positions[i] = pos
+	}
+	return &rounded
+}
+
+// truncatedRecord 返回思维链已截断的记录副本（不修改原记录）
+func (l *DecisionLogger) truncatedRecord(record *DecisionRecord) *DecisionRecord {
+	if l.maxCoTChars <= 0 || (l.keepFailedCoT && !record.Success) {
+		return record
+	}
+	trace := truncateCoT(record.CoTTrace, l.maxCoTChars)
+	if trace == record.CoTTrace {
+		return record
+	}
+
+	truncated := *record
+	truncated.CoTTrace = trace
+	return &truncated
+}
+
+// truncateCoT 将超过maxChars个字符的思维链截为"首部…[truncated N chars]…尾部"，结果不超过maxChars个字符
+// maxChars小于标记本身的长度时只保留标记
+func truncateCoT(trace string, maxChars int) string {
+	runes := []rune(trace)
+	if len(runes) <= maxChars {
+		return trace
+	}
+
+	// 标记长度取决于省略的字符数，反复计算直到两者一致（省略数只增不减，必然收敛）
+	omitted := len(runes) - maxChars
+	marker := fmt.Sprintf("…[truncated %d chars]…", omitted)
+	for {
+		next := len(runes) - max(maxChars-len([]rune(marker)), 0)
+		if next == omitted {
+			break
+		}
+		omitted = next
+		marker = fmt.Sprintf("…[truncated %d chars]…", omitted)
+	}
+	keep := len(runes) - omitted
+	head := (keep + 1) / 2
+	return string(runes[:head]) + marker + string(runes[len(runes)-(keep-head):])
+}
+
+// roundAnalysis 对分析结果中的金额类字段取整（在所有统计完成后调用）
+func (l *DecisionLogger) roundAnalysis(analysis *PerformanceAnalysis) {
+	if l.roundDecimals <= 0 {
+		return
+	}
+
+	for i := range analysis.RecentTrades {
+		trade := &analysis.RecentTrades[i]
+		trade.PositionValue = roundTo(trade.PositionValue, l.roundDecimals)
+		trade.MarginUsed = roundTo(trade.MarginUsed, l.roundDecimals)
+		trade.PnL = roundTo(trade.PnL, l.roundDecimals)
+		trade.PnLPct = roundTo(trade.PnLPct, l.roundDecimals)
+		trade.Fees = roundTo(trade.Fees, l.roundDecimals)
+		trade.FundingCost = roundTo(trade.FundingCost, l.roundDecimals)
+	}
+	analysis.AvgWin = roundTo(analysis.AvgWin, l.roundDecimals)
+	analysis.AvgLoss = roundTo(analysis.AvgLoss, l.roundDecimals)
+	analysis.MaxDrawdownUSD = roundTo(analysis.MaxDrawdownUSD, l.roundDecimals)
+	for _, stats := range analysis.SymbolStats {
+		stats.TotalPnL = roundTo(stats.TotalPnL, l.roundDecimals)
+		stats.AvgPnL = roundTo(stats.AvgPnL, l.roundDecimals)
+	}
+	for _, stats := range analysis.RegimeStats {
+		stats.TotalPnL = roundTo(stats.TotalPnL, l.roundDecimals)
+		stats.AvgPnL = roundTo(stats.AvgPnL, l.roundDecimals)
+	}
+	for _, stats := range []*SymbolPerformance{analysis.LongStats, analysis.ShortStats} {
+		if stats != nil {
+			stats.TotalPnL = roundTo(stats.TotalPnL, l.roundDecimals)
+			stats.AvgPnL = roundTo(stats.AvgPnL, l.roundDecimals)
+		}
 	}
 }
 
-// LogDecision 记录决策
+// SetMarkToMarketEquity 设置净值曲线是否按记录中的市场数据快照对持仓重新盯市
+// 账户快照与市场数据快照的获取时间不同，盯市后可以捕捉持仓浮盈浮亏的波动；缺少行情时退回快照净值
+func (l *DecisionLogger) SetMarkToMarketEquity(enabled bool) {
+	l.markToMarketEquity = enabled
+}
+
+// LogDecision 记录决策（记录未设置时间戳时使用当前时间，回测等重放场景可传入模拟时间）
 func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 	l.cycleNumber++
 	record.CycleNumber = l.cycleNumber
-	record.Timestamp = time.Now()
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
 
 	// 生成文件名：decision_YYYYMMDD_HHMMSS_cycleN.json
 	filename := fmt.Sprintf("decision_%s_cycle%d.json",
@@ -107,8 +378,24 @@ func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 
 	filepath := filepath.Join(l.logDir, filename)
 
+	stored := l.truncatedRecord(l.roundedRecord(record))
+
+	if l.store != nil {
+		// 数据库中保存紧凑JSON
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return fmt.Errorf("序列化决策记录失败: %w", err)
+		}
+		if err := l.store.save(record, data); err != nil {
+			return err
+		}
+		fmt.Printf("📝 决策记录已保存: 周期 #%d\n", record.CycleNumber)
+		l.notify(record)
+		return nil
+	}
+
 	// 序列化为JSON（带缩进，方便阅读）
-	data, err := json.MarshalIndent(record, "", "  ")
+	data, err := json.MarshalIndent(stored, "", "  ")
 	if err != nil {
 		return fmt.Errorf("序列化决策记录失败: %w", err)
 	}
@@ -119,17 +406,106 @@ func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 	}
 
 	fmt.Printf("📝 决策记录已保存: %s\n", filename)
+	l.notify(record)
+	return nil
+}
+
+// notifyQueueSize 决策通知队列容量（队列满时丢弃新通知，不阻塞交易周期）
+const notifyQueueSize = 64
+
+// notify 将记录副本放入通知队列，由后台goroutine依次调用决策通知器（不阻塞LogDecision）
+// 只通知成功执行了开平仓的周期，风控暂停、构建上下文失败、只有hold/wait的周期不发送
+func (l *DecisionLogger) notify(record *DecisionRecord) {
+	if len(l.notifiers) == 0 || !hasExecutedTrade(record) {
+		return
+	}
+
+	l.notifyMu.Lock()
+	defer l.notifyMu.Unlock()
+	if l.notifyClosed {
+		return
+	}
+	if l.notifyQueue == nil {
+		l.notifyQueue = make(chan *DecisionRecord, notifyQueueSize)
+		go l.runNotifiers(l.notifyQueue)
+	}
+
+	snapshot := *record
+	l.notifyPending.Add(1)
+	select {
+	case l.notifyQueue <- &snapshot:
+	default:
+		l.notifyPending.Done()
+		fmt.Printf("⚠ 决策通知队列已满，丢弃周期 #%d 的通知\n", record.CycleNumber)
+	}
+}
+
+// hasExecutedTrade 记录中是否有成功执行的开仓/平仓动作
+func hasExecutedTrade(record *DecisionRecord) bool {
+	for _, action := range record.Decisions {
+		if action.Success && (strings.HasPrefix(action.Action, "open_") || strings.HasPrefix(action.Action, "close_")) {
+			return true
+		}
+	}
+	return false
+}
+
+// runNotifiers 逐条发送队列中的通知，失败时只打印警告
+func (l *DecisionLogger) runNotifiers(queue <-chan *DecisionRecord) {
+	for record := range queue {
+		for _, notifier := range l.notifiers {
+			if err := notifier.OnDecision(record); err != nil {
+				fmt.Printf("⚠ 决策通知失败: %v\n", err)
+			}
+		}
+		l.notifyPending.Done()
+	}
+}
+
+// Close 关闭通知队列（后台goroutine发送完已排队的通知后退出），之后的记录不再通知
+func (l *DecisionLogger) Close() error {
+	l.notifyMu.Lock()
+	defer l.notifyMu.Unlock()
+	if !l.notifyClosed {
+		l.notifyClosed = true
+		if l.notifyQueue != nil {
+			close(l.notifyQueue)
+		}
+	}
 	return nil
 }
 
+// FlushNotifications 等待已排队的决策通知发送完成（停止交易前调用，避免丢失最后几条通知）
+// 最多等待timeout，超时返回false（通知仍在后台继续发送）
+func (l *DecisionLogger) FlushNotifications(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		l.notifyPending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 // GetLatestRecords 获取最近N条记录（按时间正序：从旧到新）
 func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
+	if l.store != nil {
+		return l.store.latest(n)
+	}
+
 	files, err := ioutil.ReadDir(l.logDir)
 	if err != nil {
 		return nil, fmt.Errorf("读取日志目录失败: %w", err)
 	}
+	// ReadDir按文件名字典序返回，同一秒内cycle10会排在cycle2之前，需按时间和周期号重新排序
+	sortDecisionFiles(files)
 
-	// 先按修改时间倒序收集（最新的在前）
+	// 从最新的文件开始倒序收集（最新的在前）
 	var records []*DecisionRecord
 	count := 0
 	for i := len(files) - 1; i >= 0 && count < n; i-- {
@@ -161,8 +537,65 @@ func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
 	return records, nil
 }
 
+// sortDecisionFiles 按文件名中的时间戳和周期号从旧到新排序日志文件
+// 无法解析的文件名（非 decision_YYYYMMDD_HHMMSS_cycleN.json 格式）视为更早的记录，之间按文件名排序
+func sortDecisionFiles(files []os.FileInfo) {
+	type fileKey struct {
+		parsed    bool
+		timestamp time.Time
+		cycle     int
+	}
+	keys := make(map[string]fileKey, len(files))
+	for _, file := range files {
+		var key fileKey
+		key.timestamp, key.cycle, key.parsed = parseDecisionFilename(file.Name())
+		keys[file.Name()] = key
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := keys[files[i].Name()], keys[files[j].Name()]
+		if a.parsed != b.parsed {
+			return !a.parsed
+		}
+		if a.parsed {
+			if !a.timestamp.Equal(b.timestamp) {
+				return a.timestamp.Before(b.timestamp)
+			}
+			if a.cycle != b.cycle {
+				return a.cycle < b.cycle
+			}
+		}
+		return files[i].Name() < files[j].Name()
+	})
+}
+
+// parseDecisionFilename 解析 decision_YYYYMMDD_HHMMSS_cycleN.json 中的时间戳和周期号
+func parseDecisionFilename(name string) (time.Time, int, bool) {
+	if !strings.HasPrefix(name, "decision_") || !strings.HasSuffix(name, ".json") {
+		return time.Time{}, 0, false
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, "decision_"), ".json"), "_")
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "cycle") {
+		return time.Time{}, 0, false
+	}
+
+	timestamp, err := time.ParseInLocation("20060102_150405", parts[0]+"_"+parts[1], time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	var cycle int
+	if _, err := fmt.Sscanf(parts[2], "cycle%d", &cycle); err != nil {
+		return time.Time{}, 0, false
+	}
+	return timestamp, cycle, true
+}
+
 // GetRecordByDate 获取指定日期的所有记录
 func (l *DecisionLogger) GetRecordByDate(date time.Time) ([]*DecisionRecord, error) {
+	if l.store != nil {
+		return l.store.byDate(date)
+	}
+
 	dateStr := date.Format("20060102")
 	pattern := filepath.Join(l.logDir, fmt.Sprintf("decision_%s_*.json", dateStr))
 
@@ -192,6 +625,16 @@ func (l *DecisionLogger) GetRecordByDate(date time.Time) ([]*DecisionRecord, err
 // CleanOldRecords 清理N天前的旧记录
 func (l *DecisionLogger) CleanOldRecords(days int) error {
 	cutoffTime := time.Now().AddDate(0, 0, -days)
+	if l.store != nil {
+		removedCount, err := l.store.deleteBefore(cutoffTime)
+		if err != nil {
+			return fmt.Errorf("清理旧记录失败: %w", err)
+		}
+		if removedCount > 0 {
+			fmt.Printf("🗑️ 已清理 %d 条旧记录（%d天前）\n", removedCount, days)
+		}
+		return nil
+	}
 
 	files, err := ioutil.ReadDir(l.logDir)
 	if err != nil {
@@ -221,15 +664,37 @@ func (l *DecisionLogger) CleanOldRecords(days int) error {
 	return nil
 }
 
-// GetStatistics 获取统计信息
+// GetStatistics 获取全部记录的统计信息
 func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
+	return l.GetStatisticsRange(time.Time{}, time.Time{})
+}
+
+// GetStatisticsRange 获取时间戳落在[from, to]内的记录的统计信息（from/to为零值表示不限）
+// 按记录中的Timestamp过滤而不是文件修改时间，复制过的日志文件也能正确统计
+func (l *DecisionLogger) GetStatisticsRange(from, to time.Time) (*Statistics, error) {
+	inRange := func(record *DecisionRecord) bool {
+		return (from.IsZero() || !record.Timestamp.Before(from)) && (to.IsZero() || !record.Timestamp.After(to))
+	}
+
+	stats := &Statistics{}
+	if l.store != nil {
+		records, err := l.store.all()
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if inRange(record) {
+				stats.add(record)
+			}
+		}
+		return stats, nil
+	}
+
 	files, err := ioutil.ReadDir(l.logDir)
 	if err != nil {
 		return nil, fmt.Errorf("读取日志目录失败: %w", err)
 	}
 
-	stats := &Statistics{}
-
 	for _, file := range files {
 		if file.IsDir() {
 			continue
@@ -246,27 +711,34 @@ func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
 			continue
 		}
 
-		stats.TotalCycles++
-
-		for _, action := range record.Decisions {
-			if action.Success {
-				switch action.Action {
-				case "open_long", "open_short":
-					stats.TotalOpenPositions++
-				case "close_long", "close_short":
-					stats.TotalClosePositions++
-				}
-			}
+		if inRange(&record) {
+			stats.add(&record)
 		}
+	}
+
+	return stats, nil
+}
 
-		if record.Success {
-			stats.SuccessfulCycles++
-		} else {
-			stats.FailedCycles++
+// add 将一条记录计入统计
+func (stats *Statistics) add(record *DecisionRecord) {
+	stats.TotalCycles++
+
+	for _, action := range record.Decisions {
+		if action.Success {
+			switch action.Action {
+			case "open_long", "open_short":
+				stats.TotalOpenPositions++
+			case "close_long", "close_short":
+				stats.TotalClosePositions++
+			}
 		}
 	}
 
-	return stats, nil
+	if record.Success {
+		stats.SuccessfulCycles++
+	} else {
+		stats.FailedCycles++
+	}
 }
 
 // Statistics 统计信息
@@ -278,6 +750,179 @@ type Statistics struct {
 	TotalClosePositions int `json:"total_close_positions"`
 }
 
+// RejectionStats 被拒绝决策统计
+type RejectionStats struct {
+	TotalProposed int                `json:"total_proposed"` // 模型提出的决策总数（执行 + 被拒绝）
+	TotalRejected int                `json:"total_rejected"` // 被拒绝的决策数
+	RejectionRate float64            `json:"rejection_rate"` // 总拒绝率（%）
+	ByReason      map[string]int     `json:"by_reason"`      // 各原因的拒绝次数
+	RateByReason  map[string]float64 `json:"rate_by_reason"` // 各原因的拒绝率（占提出决策总数的%）
+	ByStage       map[string]int     `json:"by_stage"`       // 各阶段的拒绝次数
+}
+
+// GetRejectionStats 统计最近N个周期被拒绝决策的数量和原因分布
+func (l *DecisionLogger) GetRejectionStats(lookbackCycles int) (*RejectionStats, error) {
+	records, err := l.GetLatestRecords(lookbackCycles)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	stats := &RejectionStats{
+		ByReason:     make(map[string]int),
+		RateByReason: make(map[string]float64),
+		ByStage:      make(map[string]int),
+	}
+	for _, record := range records {
+		stats.TotalProposed += len(record.Decisions) + len(record.RejectedDecisions)
+		for _, rejected := range record.RejectedDecisions {
+			stats.TotalRejected++
+			stats.ByReason[rejected.Reason]++
+			stats.ByStage[rejected.Stage]++
+		}
+	}
+
+	if stats.TotalProposed > 0 {
+		stats.RejectionRate = float64(stats.TotalRejected) / float64(stats.TotalProposed) * 100
+		for reason, count := range stats.ByReason {
+			stats.RateByReason[reason] = float64(count) / float64(stats.TotalProposed) * 100
+		}
+	}
+	return stats, nil
+}
+
+// GetOpenCountsByDate 统计指定日期各币种成功开仓的次数
+func (l *DecisionLogger) GetOpenCountsByDate(date time.Time) (map[string]int, error) {
+	records, err := l.GetRecordByDate(date)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, record := range records {
+		for _, action := range record.Decisions {
+			if action.Success && getActionType(action.Action) == "open" {
+				counts[action.Symbol]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// GetValidatorAccuracy 统计最近N个周期各验证模型的历史准确率（0-1）
+// 只统计已执行且已平仓的开仓决策：同意且盈利、或反对且未盈利视为判断正确
+func (l *DecisionLogger) GetValidatorAccuracy(lookbackCycles int) (map[string]float64, error) {
+	records, err := l.GetLatestRecords(lookbackCycles)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	type openTrade struct {
+		side  string
+		price float64
+		votes []ValidatorVote
+	}
+	openTrades := make(map[string]openTrade)
+	correct := make(map[string]int)
+	total := make(map[string]int)
+
+	for _, record := range records {
+		for _, action := range record.Decisions {
+			if !action.Success {
+				continue
+			}
+			side := getSideFromAction(action.Action)
+			switch getActionType(action.Action) {
+			case "open":
+				var votes []ValidatorVote
+				for _, vote := range record.ValidatorVotes {
+					if vote.Symbol == action.Symbol && vote.Action == action.Action {
+						votes = append(votes, vote)
+					}
+				}
+				openTrades[action.Symbol] = openTrade{side: side, price: action.Price, votes: votes}
+			case "close":
+				trade, ok := openTrades[action.Symbol]
+				if !ok || trade.side != side {
+					continue
+				}
+				delete(openTrades, action.Symbol)
+
+				profitable := action.Price > trade.price
+				if side == "short" {
+					profitable = action.Price < trade.price
+				}
+				for _, vote := range trade.votes {
+					total[vote.Validator]++
+					if vote.Agree == profitable {
+						correct[vote.Validator]++
+					}
+				}
+			}
+		}
+	}
+
+	accuracy := make(map[string]float64)
+	for validator, count := range total {
+		accuracy[validator] = float64(correct[validator]) / float64(count)
+	}
+	return accuracy, nil
+}
+
+// TradeDossier 单笔交易的完整上下文（用于排查问题交易）
+type TradeDossier struct {
+	Symbol          string             `json:"symbol"`                 // 币种
+	Side            string             `json:"side"`                   // long/short
+	OpenRecord      *DecisionRecord    `json:"open_record"`            // 开仓周期的完整记录（prompt/思维链/决策JSON）
+	OpenAction      DecisionAction     `json:"open_action"`            // 开仓执行记录
+	EntryMarketData MarketDataSnapshot `json:"entry_market_data"`      // 入场时的市场数据快照
+	CloseRecord     *DecisionRecord    `json:"close_record,omitempty"` // 平仓周期的完整记录（仍持仓时为空）
+	CloseAction     *DecisionAction    `json:"close_action,omitempty"` // 平仓执行记录（仍持仓时为空）
+}
+
+// TradeDossier 查找指定币种在openTime开仓的交易，汇总开仓决策、入场行情快照和平仓记录
+// openTime可以是开仓执行时间或开仓周期的决策时间
+func (l *DecisionLogger) TradeDossier(symbol string, openTime time.Time) (*TradeDossier, error) {
+	records, err := l.GetLatestRecords(math.MaxInt)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	var dossier *TradeDossier
+	for _, record := range records {
+		for i := range record.Decisions {
+			action := record.Decisions[i]
+			if action.Symbol != symbol || !action.Success {
+				continue
+			}
+
+			if dossier == nil {
+				if getActionType(action.Action) == "open" &&
+					(action.Timestamp.Equal(openTime) || record.Timestamp.Equal(openTime)) {
+					dossier = &TradeDossier{
+						Symbol:          symbol,
+						Side:            getSideFromAction(action.Action),
+						OpenRecord:      record,
+						OpenAction:      action,
+						EntryMarketData: record.MarketData[symbol],
+					}
+				}
+				continue
+			}
+
+			if getActionType(action.Action) == "close" && getSideFromAction(action.Action) == dossier.Side {
+				dossier.CloseRecord = record
+				dossier.CloseAction = &action
+				return dossier, nil
+			}
+		}
+	}
+
+	if dossier == nil {
+		return nil, fmt.Errorf("未找到 %s 在 %s 的开仓记录", symbol, openTime.Format("2006-01-02 15:04:05"))
+	}
+	return dossier, nil
+}
+
 // TradeOutcome 单笔交易结果
 type TradeOutcome struct {
 	Symbol        string    `json:"symbol"`         // 币种
@@ -293,10 +938,21 @@ type TradeOutcome struct {
 	Duration      string    `json:"duration"`       // 持仓时长
 	OpenTime      time.Time `json:"open_time"`      // 开仓时间
 	CloseTime     time.Time `json:"close_time"`     // 平仓时间
-	CloseReason   string    `json:"close_reason"`   // 平仓原因 (e.g., "TP", "SL", "Strategy")
+	CloseReason   string    `json:"close_reason"`   // 平仓原因 (e.g., "TP", "SL", "Strategy"；开启细分后还有 "vwap_reversal"/"time_stop"/"manual")
 	EntryVWAP     float64   `json:"entry_vwap"`     // 入场时VWAP
 	EntryRSI      float64   `json:"entry_rsi"`      // 入场时RSI
 	EntryMACD     float64   `json:"entry_macd"`     // 入场时MACD
+	SetupScore    int       `json:"setup_score"`    // 入场条件评分（0-100，事后评估VWAP/RSI/MACD是否满足）
+	IntendedR     float64   `json:"intended_r"`     // 计划风险回报倍数（|止盈-开仓价| / |开仓价-止损|，无止损止盈时为0）
+	RealizedR     float64   `json:"realized_r"`     // 实际R倍数（平仓盈亏幅度 / 止损风险幅度，亏损为负，无止损时为0）
+	TargetFill    string    `json:"target_fill"`    // 止盈实现情况: "early"(盈利但未到止盈) / "target"(接近止盈) / "overshoot"(超过止盈)，亏损或无止盈时为空
+	EntryRegime   string    `json:"entry_regime"`   // 开仓时BTC市场状态（up/down/range，旧记录为空）
+	HoldCycles    int       `json:"hold_cycles"`    // 平仓前连续给出hold决策的周期数
+	MAEPct        float64   `json:"mae_pct"`        // 最大不利偏移：持仓期间行情快照相对开仓价的最大反向幅度（%，无中间快照时为0）
+	Fees          float64   `json:"fees"`           // 开平仓手续费（按配置的手续费率估算，未配置时为0，不计入PnL）
+	FundingCost   float64   `json:"funding_cost"`   // 资金费用（正数为支付，负数为收取；行情快照无资金费率时为0，不计入PnL）
+	StopLoss      float64   `json:"stop_loss"`      // 开仓时AI给出的止损价（未给出时为0）
+	TakeProfit    float64   `json:"take_profit"`    // 开仓时AI给出的止盈价（未给出时为0）
 }
 
 // PerformanceAnalysis 交易表现分析
@@ -304,45 +960,278 @@ type PerformanceAnalysis struct {
 	TotalTrades   int                           `json:"total_trades"`   // 总交易数
 	WinningTrades int                           `json:"winning_trades"` // 盈利交易数
 	LosingTrades  int                           `json:"losing_trades"`  // 亏损交易数
-	WinRate       float64                       `json:"win_rate"`       // 胜率
+	ScratchTrades int                           `json:"scratch_trades"` // 打平交易数（盈亏在抹平区间内，不计入胜负）
+	WinRate       float64                       `json:"win_rate"`       // 胜率（不含打平交易）
 	AvgWin        float64                       `json:"avg_win"`        // 平均盈利
 	AvgLoss       float64                       `json:"avg_loss"`       // 平均亏损
 	ProfitFactor  float64                       `json:"profit_factor"`  // 盈亏比
 	SharpeRatio   float64                       `json:"sharpe_ratio"`   // 夏普比率（风险调整后收益）
+	SortinoRatio  float64                       `json:"sortino_ratio"`  // 索提诺比率（只计下行波动的风险调整后收益）
 	RecentTrades  []TradeOutcome                `json:"recent_trades"`  // 最近N笔交易
 	SymbolStats   map[string]*SymbolPerformance `json:"symbol_stats"`   // 各币种表现
+	LongStats     *SymbolPerformance            `json:"long_stats"`     // 多头交易表现
+	ShortStats    *SymbolPerformance            `json:"short_stats"`    // 空头交易表现
 	BestSymbol    string                        `json:"best_symbol"`    // 表现最好的币种
 	WorstSymbol   string                        `json:"worst_symbol"`   // 表现最差的币种
-}
+	BaseCurrency  string                        `json:"base_currency"`  // 计价货币（所有金额类指标的单位）
+	Diagnostics   []string                      `json:"diagnostics"`    // 数据诊断信息（如重叠开仓等日志异常）
 
-// SymbolPerformance 币种表现统计
-type SymbolPerformance struct {
-	Symbol        string  `json:"symbol"`         // 币种
-	TotalTrades   int     `json:"total_trades"`   // 交易次数
-	WinningTrades int     `json:"winning_trades"` // 盈利次数
-	LosingTrades  int     `json:"losing_trades"`  // 亏损次数
-	WinRate       float64 `json:"win_rate"`       // 胜率
-	TotalPnL      float64 `json:"total_pn_l"`     // 总盈亏
-	AvgPnL        float64 `json:"avg_pn_l"`       // 平均盈亏
-}
+	// 统计所用的打平区间（%），滚动胜率、连胜连败等按交易列表计算的指标沿用同一口径
+	ScratchBandPct float64 `json:"scratch_band_pct"`
 
-// AnalyzePerformance 分析最近N个周期的交易表现
-func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAnalysis, error) {
-	// 扩大窗口以捕获更早的开仓记录，确保平仓能找到对应的开仓
-	records, err := l.GetLatestRecords(lookbackCycles * 5)
-	if err != nil {
-		return nil, fmt.Errorf("读取历史记录失败: %w", err)
-	}
+	// 入场价偏离VWAP的平均距离（|开仓价/VWAP-1|，百分比），用于验证靠近VWAP入场是否更有利
+	AvgWinnerVWAPDistancePct float64 `json:"avg_winner_vwap_distance_pct"` // 盈利交易
+	AvgLoserVWAPDistancePct  float64 `json:"avg_loser_vwap_distance_pct"`  // 亏损交易
 
-	if len(records) == 0 {
-		return &PerformanceAnalysis{
-			RecentTrades: []TradeOutcome{},
-			SymbolStats:  make(map[string]*SymbolPerformance),
-		}, nil
-	}
+	// 盈利集中度：盈利最多的3笔交易占全部盈利的百分比（越高说明收益越依赖少数交易）
+	TopTradesProfitSharePct float64 `json:"top_trades_profit_share_pct"`
 
-	// aiDecision 是 decision.Decision 的本地副本，以避免循环依赖
-	type aiDecision struct {
+	// 按当前平均盈亏计算的盈亏平衡胜率（%），以及实际胜率高出的百分点（负数说明胜率不足以盈利）
+	BreakEvenWinRate float64 `json:"break_even_win_rate"`
+	WinRateMargin    float64 `json:"win_rate_margin"`
+
+	// 最大回撤：净值从历史高点到后续低点的最大跌幅（百分比相对当时高点，金额为绝对跌幅）
+	MaxDrawdownPct float64 `json:"max_drawdown_pct"`
+	MaxDrawdownUSD float64 `json:"max_drawdown_usd"`
+
+	// 卡玛比率：区间总收益率 / 最大回撤比例（无回撤且收益为正时为999）
+	CalmarRatio float64 `json:"calmar_ratio"`
+
+	// 盈利交易在反弹前的平均最大不利偏移（%），接近止损距离说明止损过紧、可能扼杀潜在盈利（无行情快照时为0）
+	AvgWinnerMAE float64 `json:"avg_winner_mae"`
+
+	// 回看窗口结束时仍未匹配到平仓记录的币种（如强平未记录平仓），这些交易不计入统计；
+	// 最新记录中有对应持仓快照时一并给出其当前浮动盈亏状态
+	UnclosedPositions      []string           `json:"unclosed_positions"`
+	UnclosedPositionStates []PositionSnapshot `json:"unclosed_position_states,omitempty"`
+
+	// 按开仓时BTC市场状态（up/down/range）分组的交易表现，未记录市场状态的交易不计入
+	RegimeStats map[string]*SymbolPerformance `json:"regime_stats"`
+
+	// 连胜/连败（按时间顺序）：当前连续次数（正数为连胜，负数为连败，打平交易清零）及最长连胜、连败
+	CurrentStreak int `json:"current_streak"`
+	MaxWinStreak  int `json:"max_win_streak"`
+	MaxLossStreak int `json:"max_loss_streak"`
+
+	// 平均持仓时长（分钟）：全部交易、盈利交易、亏损交易，用于发现"截断盈利、让亏损奔跑"的处置效应
+	AvgHoldingMinutes float64 `json:"avg_holding_minutes"`
+	AvgWinnerMinutes  float64 `json:"avg_winner_minutes"`
+	AvgLoserMinutes   float64 `json:"avg_loser_minutes"`
+
+	// 反复开平：同一币种在相邻周期内开仓、平仓又同向开仓（模型犹豫不决、白白消耗手续费）
+	ActionChurn []ActionChurn `json:"action_churn,omitempty"`
+
+	// 持仓时间占比（%）：分析区间（首条到末条记录）内至少持有一个仓位的时间比例，重叠持仓不重复计算
+	TimeInMarketPct float64 `json:"time_in_market_pct"`
+}
+
+// ActionChurn 一次反复开平：OpenCycle开仓、CloseCycle平仓、ReopenCycle又同向开仓
+type ActionChurn struct {
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"` // long/short
+	OpenCycle   int    `json:"open_cycle"`
+	CloseCycle  int    `json:"close_cycle"`
+	ReopenCycle int    `json:"reopen_cycle"`
+}
+
+// RollingWinRate 按时间顺序（从旧到新）对最近交易计算滑动窗口胜率（%），用于观察表现趋势
+// 与总体胜率口径一致：打平交易占窗口位置但不计入分母，窗口内全是打平时为0
+// 窗口大于交易数量时返回全部交易的胜率；没有交易或window<=0时返回nil
+func (a *PerformanceAnalysis) RollingWinRate(window int) []float64 {
+	n := len(a.RecentTrades)
+	if n == 0 || window <= 0 {
+		return nil
+	}
+	if window > n {
+		window = n
+	}
+
+	// RecentTrades按最新在前排列，先转为时间正序（1盈利，-1亏损，0打平）
+	results := make([]int, n)
+	for i, trade := range a.RecentTrades {
+		results[n-1-i] = tradeResult(trade, a.ScratchBandPct)
+	}
+
+	rates := make([]float64, 0, n-window+1)
+	wins, losses := 0, 0
+	for i, result := range results {
+		if result > 0 {
+			wins++
+		} else if result < 0 {
+			losses++
+		}
+		if i >= window {
+			if old := results[i-window]; old > 0 {
+				wins--
+			} else if old < 0 {
+				losses--
+			}
+		}
+		if i >= window-1 {
+			rates = append(rates, decisiveWinRate(wins, losses))
+		}
+	}
+	return rates
+}
+
+// RollingProfitFactor 按时间顺序（从旧到新）对最近交易计算滑动窗口盈亏比，用于观察策略优势是否在改善
+// 窗口内没有亏损时与整体盈亏比一致取999；窗口大于交易数量时按全部交易计算；没有交易或window<=0时返回nil
+func (a *PerformanceAnalysis) RollingProfitFactor(window int) []float64 {
+	n := len(a.RecentTrades)
+	if n == 0 || window <= 0 {
+		return nil
+	}
+	if window > n {
+		window = n
+	}
+
+	// RecentTrades按最新在前排列，先转为时间正序
+	pnls := make([]float64, n)
+	for i, trade := range a.RecentTrades {
+		pnls[n-1-i] = trade.PnL
+	}
+
+	factors := make([]float64, 0, n-window+1)
+	for end := window; end <= n; end++ {
+		var totalWin, totalLoss float64
+		for _, pnl := range pnls[end-window : end] {
+			if pnl > 0 {
+				totalWin += pnl
+			} else if pnl < 0 {
+				totalLoss += pnl
+			}
+		}
+		factors = append(factors, profitFactor(totalWin, totalLoss))
+	}
+	return factors
+}
+
+// LosingSetup 亏损交易的入场条件组合（方向、价格相对VWAP的位置、RSI区间）
+type LosingSetup struct {
+	Side      string  `json:"side"`       // long/short
+	VWAP      string  `json:"vwap"`       // 开仓价相对入场VWAP: "above" / "below"
+	RSIBand   string  `json:"rsi_band"`   // 入场RSI区间: "<40" / "40-60" / ">60"
+	Count     int     `json:"count"`      // 该组合的亏损交易数
+	TotalLoss float64 `json:"total_loss"` // 该组合的亏损合计（负数）
+}
+
+// TopLosingSetup 按（方向, VWAP位置, RSI区间）对亏损交易分组，返回出现次数最多的组合
+// 次数相同时取亏损合计更大的组合；打平交易和没有入场快照（VWAP为0）的交易不计入，没有可分组的亏损交易时返回nil
+func (a *PerformanceAnalysis) TopLosingSetup() *LosingSetup {
+	setups := make(map[string]*LosingSetup)
+	var top *LosingSetup
+	for _, trade := range a.RecentTrades {
+		if tradeResult(trade, a.ScratchBandPct) >= 0 || trade.EntryVWAP <= 0 {
+			continue
+		}
+
+		vwap := "below"
+		if trade.OpenPrice > trade.EntryVWAP {
+			vwap = "above"
+		}
+		band := "40-60"
+		if trade.EntryRSI < 40 {
+			band = "<40"
+		} else if trade.EntryRSI > 60 {
+			band = ">60"
+		}
+
+		key := trade.Side + "|" + vwap + "|" + band
+		setup, ok := setups[key]
+		if !ok {
+			setup = &LosingSetup{Side: trade.Side, VWAP: vwap, RSIBand: band}
+			setups[key] = setup
+		}
+		setup.Count++
+		setup.TotalLoss += trade.PnL
+
+		if top == nil || setup.Count > top.Count || (setup.Count == top.Count && setup.TotalLoss < top.TotalLoss) {
+			top = setup
+		}
+	}
+	return top
+}
+
+// BreakEvenWinRate 按平均盈利和平均亏损计算不亏钱所需的最低胜率（%）: |avgLoss| / (avgWin + |avgLoss|)
+// 没有亏损时返回0（任何胜率都不亏），有亏损但没有盈利时返回100
+func BreakEvenWinRate(avgWin, avgLoss float64) float64 {
+	loss := math.Abs(avgLoss)
+	if loss == 0 {
+		return 0
+	}
+	if avgWin <= 0 {
+		return 100
+	}
+	return loss / (avgWin + loss) * 100
+}
+
+// tradeResult 按打平区间判定交易结果：1盈利，-1亏损，0打平（盈亏百分比在区间内或零盈亏）
+func tradeResult(trade TradeOutcome, scratchBandPct float64) int {
+	if scratchBandPct > 0 && math.Abs(trade.PnLPct) <= scratchBandPct {
+		return 0
+	}
+	if trade.PnL > 0 {
+		return 1
+	}
+	if trade.PnL < 0 {
+		return -1
+	}
+	return 0
+}
+
+// decisiveWinRate 按盈利+亏损交易计算胜率（%），打平交易不计入分母，与总体胜率口径一致
+func decisiveWinRate(wins, losses int) float64 {
+	if wins+losses == 0 {
+		return 0
+	}
+	return float64(wins) / float64(wins+losses) * 100
+}
+
+// profitFactor 根据总盈利与总亏损（负数）计算盈亏比；没有亏损但有盈利时返回999表示无穷大
+func profitFactor(totalWin, totalLoss float64) float64 {
+	if totalLoss != 0 {
+		return totalWin / math.Abs(totalLoss)
+	}
+	if totalWin > 0 {
+		return 999.0 // Infinite profit factor
+	}
+	return 0
+}
+
+// SymbolPerformance 币种表现统计
+type SymbolPerformance struct {
+	Symbol        string  `json:"symbol"`         // 币种
+	TotalTrades   int     `json:"total_trades"`   // 交易次数
+	WinningTrades int     `json:"winning_trades"` // 盈利次数
+	LosingTrades  int     `json:"losing_trades"`  // 亏损次数
+	WinRate       float64 `json:"win_rate"`       // 胜率
+	TotalPnL      float64 `json:"total_pn_l"`     // 总盈亏
+	AvgPnL        float64 `json:"avg_pn_l"`       // 平均盈亏
+}
+
+// AnalyzePerformance 分析最近N个周期的交易表现
+func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAnalysis, error) {
+	// 扩大窗口以捕获更早的开仓记录，确保平仓能找到对应的开仓
+	records, err := l.GetLatestRecords(lookbackCycles * 5)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	if len(records) == 0 {
+		return &PerformanceAnalysis{
+			RecentTrades: []TradeOutcome{},
+			SymbolStats:  make(map[string]*SymbolPerformance),
+			LongStats:    &SymbolPerformance{Symbol: "long"},
+			ShortStats:   &SymbolPerformance{Symbol: "short"},
+			BaseCurrency: l.baseCurrency,
+			RegimeStats:  make(map[string]*SymbolPerformance),
+
+			ScratchBandPct: l.scratchBandPct,
+		}, nil
+	}
+
+	// aiDecision 是 decision.Decision 的本地副本，以避免循环依赖
+	type aiDecision struct {
 		Symbol     string  `json:"symbol"`
 		Action     string  `json:"action"`
 		StopLoss   float64 `json:"stop_loss,omitempty"`
@@ -358,6 +1247,12 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 		StopLoss   float64
 		TakeProfit float64
 		MarketData MarketDataSnapshot
+		Regime     string
+		HoldCycles int     // 开仓后连续hold的周期数（出现非hold周期时清零）
+		WorstPrice float64 // 开仓后行情快照中最不利的价格（0表示没有快照）
+
+		FundingRateSum   float64 // 持仓期间（含开仓周期）行情快照中资金费率之和
+		FundingRateCount int     // 持仓期间带资金费率的行情快照数
 	}
 	// 追踪持仓状态: symbol -> openPositionInfo
 	openPositions := make(map[string]openPositionInfo)
@@ -365,7 +1260,16 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 	analysis := &PerformanceAnalysis{
 		RecentTrades: []TradeOutcome{},
 		SymbolStats:  make(map[string]*SymbolPerformance),
+		LongStats:    &SymbolPerformance{Symbol: "long"},
+		ShortStats:   &SymbolPerformance{Symbol: "short"},
+		BaseCurrency: l.baseCurrency,
+		RegimeStats:  make(map[string]*SymbolPerformance),
+
+		ScratchBandPct: l.scratchBandPct,
 	}
+	var scratchLossAmount float64 // 打平/零盈亏交易的盈亏绝对值合计（用于保守盈亏比）
+	var winnerMAESum float64      // 有行情快照的盈利交易的最大不利偏移合计
+	var winnerMAECount int
 
 	// 按时间顺序从旧到新遍历所有记录
 	for _, record := range records {
@@ -373,9 +1277,37 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 		var decisions []aiDecision
 		_ = json.Unmarshal([]byte(record.DecisionJSON), &decisions)
 		decisionMap := make(map[string]aiDecision)
+		held := make(map[string]bool)
+		closing := make(map[string]bool)
 		for _, d := range decisions {
 			key := d.Symbol + "_" + getSideFromAction(d.Action)
 			decisionMap[key] = d
+			if d.Action == "hold" {
+				held[d.Symbol] = true
+			}
+			if getActionType(d.Action) == "close" {
+				closing[d.Symbol] = true
+			}
+		}
+
+		// 统计未平仓持仓在本周期是否继续hold（连续hold周期数用于复盘平仓时机，平仓周期本身不清零），
+		// 并用本周期的行情快照更新持仓期间最不利的价格
+		for symbol, pos := range openPositions {
+			if held[symbol] {
+				pos.HoldCycles++
+			} else if !closing[symbol] {
+				pos.HoldCycles = 0
+			}
+			if price := record.MarketData[symbol].CurrentPrice; price > 0 {
+				if pos.WorstPrice == 0 || (pos.Side == "long" && price < pos.WorstPrice) || (pos.Side == "short" && price > pos.WorstPrice) {
+					pos.WorstPrice = price
+				}
+			}
+			if rate := record.MarketData[symbol].FundingRate; rate != 0 {
+				pos.FundingRateSum += rate
+				pos.FundingRateCount++
+			}
+			openPositions[symbol] = pos
 		}
 
 		// 2. 遍历该记录中实际执行的动作
@@ -401,7 +1333,15 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					tp = aiDecision.TakeProfit
 				}
 
-				openPositions[posKey] = openPositionInfo{
+				// 单向持仓模式下，同一币种在平仓前不应再次开仓；出现重叠说明日志中缺失了平仓记录
+				if prev, exists := openPositions[posKey]; exists {
+					analysis.Diagnostics = append(analysis.Diagnostics, fmt.Sprintf(
+						"重叠开仓: %s 在 %s 已有未平仓的%s仓位（开仓价%.4f），又于 %s 开%s仓，可能缺失平仓记录",
+						action.Symbol, prev.OpenTime.Format("2006-01-02 15:04:05"), prev.Side, prev.OpenPrice,
+						action.Timestamp.Format("2006-01-02 15:04:05"), side))
+				}
+
+				info := openPositionInfo{
 					OpenTime:   action.Timestamp,
 					OpenPrice:  action.Price,
 					Quantity:   action.Quantity,
@@ -410,7 +1350,12 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					StopLoss:   sl,
 					TakeProfit: tp,
 					MarketData: record.MarketData[action.Symbol],
+					Regime:     record.MarketRegime,
+				}
+				if rate := record.MarketData[action.Symbol].FundingRate; rate != 0 {
+					info.FundingRateSum, info.FundingRateCount = rate, 1
 				}
+				openPositions[posKey] = info
 
 			case "close":
 				if openPos, exists := openPositions[posKey]; exists {
@@ -420,14 +1365,20 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					}
 
 					// --- 计算交易结果 ---
+					// 部分平仓只结算平掉的数量，剩余数量继续持有
+					quantity := openPos.Quantity
+					partial := action.ClosePercent > 0 && action.ClosePercent < 100
+					if partial {
+						quantity = openPos.Quantity * action.ClosePercent / 100
+					}
 					var pnl float64
 					if side == "long" {
-						pnl = openPos.Quantity * (action.Price - openPos.OpenPrice)
+						pnl = quantity * (action.Price - openPos.OpenPrice)
 					} else {
-						pnl = openPos.Quantity * (openPos.OpenPrice - action.Price)
+						pnl = quantity * (openPos.OpenPrice - action.Price)
 					}
 
-					positionValue := openPos.Quantity * openPos.OpenPrice
+					positionValue := quantity * openPos.OpenPrice
 					marginUsed := 0.0
 					if openPos.Leverage > 0 {
 						marginUsed = positionValue / float64(openPos.Leverage)
@@ -455,10 +1406,15 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						}
 					}
 
+					if closeReason == "Strategy" && l.classifyCloses {
+						closeReason = l.classifyStrategyClose(side, action.Price, openPos.MarketData.CurrentVWAP,
+							action.Timestamp.Sub(openPos.OpenTime), record.DecisionJSON != "" && !closing[action.Symbol])
+					}
+
 					outcome := TradeOutcome{
 						Symbol:        action.Symbol,
 						Side:          side,
-						Quantity:      openPos.Quantity,
+						Quantity:      quantity,
 						Leverage:      openPos.Leverage,
 						OpenPrice:     openPos.OpenPrice,
 						ClosePrice:    action.Price,
@@ -473,15 +1429,50 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						EntryVWAP:     openPos.MarketData.CurrentVWAP,
 						EntryRSI:      openPos.MarketData.CurrentRSI7,
 						EntryMACD:     openPos.MarketData.CurrentMACD,
+						SetupScore: calculateSetupScore(side, openPos.OpenPrice,
+							openPos.MarketData.CurrentVWAP, openPos.MarketData.CurrentRSI7, openPos.MarketData.CurrentMACD),
+					}
+					outcome.IntendedR, outcome.RealizedR = calculateRMultiples(side, openPos.OpenPrice, action.Price, openPos.StopLoss, openPos.TakeProfit)
+					outcome.TargetFill = classifyTargetFill(side, action.Price, openPos.TakeProfit, pnl)
+					outcome.EntryRegime = openPos.Regime
+					outcome.StopLoss, outcome.TakeProfit = openPos.StopLoss, openPos.TakeProfit
+					outcome.HoldCycles = openPos.HoldCycles
+					if openPos.WorstPrice > 0 && openPos.OpenPrice > 0 {
+						adverse := openPos.OpenPrice - openPos.WorstPrice
+						if side == "short" {
+							adverse = openPos.WorstPrice - openPos.OpenPrice
+						}
+						outcome.MAEPct = math.Max(adverse, 0) / openPos.OpenPrice * 100
+					}
+					// 手续费和资金费用仅作记录，不从PnL中扣除
+					outcome.Fees = (positionValue + quantity*action.Price) * l.feeRatePct / 100
+					if openPos.FundingRateCount > 0 {
+						// 按持仓期间的平均资金费率和经过的8小时结算次数估算；资金费率为正时多头支付、空头收取
+						settlements := action.Timestamp.Sub(openPos.OpenTime).Hours() / 8
+						outcome.FundingCost = positionValue * openPos.FundingRateSum / float64(openPos.FundingRateCount) * settlements
+						if side == "short" {
+							outcome.FundingCost = -outcome.FundingCost
+						}
 					}
 
 					analysis.RecentTrades = append(analysis.RecentTrades, outcome)
 					
 					// --- 更新统计数据 ---
+					// 盈亏百分比落在抹平区间内的交易视为打平(scratch)，不计入盈亏次数
 					analysis.TotalTrades++
-					if pnl > 0 {
+					isScratch := l.scratchBandPct > 0 && math.Abs(pnlPct) <= l.scratchBandPct
+					if isScratch || pnl == 0 {
+						scratchLossAmount += math.Abs(pnl)
+					}
+					if isScratch {
+						analysis.ScratchTrades++
+					} else if pnl > 0 {
 						analysis.WinningTrades++
 						analysis.AvgWin += pnl
+						if openPos.WorstPrice > 0 {
+							winnerMAESum += outcome.MAEPct
+							winnerMAECount++
+						}
 					} else if pnl < 0 {
 						analysis.LosingTrades++
 						analysis.AvgLoss += pnl
@@ -490,17 +1481,54 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					if _, ok := analysis.SymbolStats[action.Symbol]; !ok {
 						analysis.SymbolStats[action.Symbol] = &SymbolPerformance{Symbol: action.Symbol}
 					}
-					stats := analysis.SymbolStats[action.Symbol]
-					stats.TotalTrades++
-					stats.TotalPnL += pnl
-					if pnl > 0 {
-						stats.WinningTrades++
-					} else if pnl < 0 {
-						stats.LosingTrades++
+					sideStats := analysis.LongStats
+					if side == "short" {
+						sideStats = analysis.ShortStats
+					}
+					// 币种统计、多空统计与市场状态统计使用相同的计数规则
+					groups := []*SymbolPerformance{analysis.SymbolStats[action.Symbol], sideStats}
+					if openPos.Regime != "" {
+						if _, ok := analysis.RegimeStats[openPos.Regime]; !ok {
+							analysis.RegimeStats[openPos.Regime] = &SymbolPerformance{Symbol: openPos.Regime}
+						}
+						groups = append(groups, analysis.RegimeStats[openPos.Regime])
+					}
+					for _, stats := range groups {
+						stats.TotalTrades++
+						stats.TotalPnL += pnl
+						if !isScratch && pnl > 0 {
+							stats.WinningTrades++
+						} else if !isScratch && pnl < 0 {
+							stats.LosingTrades++
+						}
 					}
 
-					// 交易完成，从未平仓map中删除
-					delete(openPositions, posKey)
+					// 交易完成，从未平仓map中删除；部分平仓时减少剩余数量
+					if partial {
+						openPos.Quantity -= quantity
+						openPositions[posKey] = openPos
+					} else {
+						delete(openPositions, posKey)
+					}
+				}
+			}
+		}
+	}
+
+	// 时间戳异常会导致开平仓匹配出错，一并报告
+	analysis.Diagnostics = append(analysis.Diagnostics, detectTimestampAnomalies(records, time.Now())...)
+
+	// 未匹配到平仓的持仓（通常是仍在持有的仓位，不打印警告）：列出币种，并从最新记录的持仓快照中取当前状态
+	if len(openPositions) > 0 {
+		for symbol := range openPositions {
+			analysis.UnclosedPositions = append(analysis.UnclosedPositions, symbol)
+		}
+		sort.Strings(analysis.UnclosedPositions)
+		latest := records[len(records)-1]
+		for _, symbol := range analysis.UnclosedPositions {
+			for _, pos := range latest.Positions {
+				if pos.Symbol == symbol && pos.Side == openPositions[symbol].Side {
+					analysis.UnclosedPositionStates = append(analysis.UnclosedPositionStates, pos)
 				}
 			}
 		}
@@ -508,27 +1536,31 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 	// --- Finalize aggregate statistics ---
 	if analysis.TotalTrades > 0 {
-		analysis.WinRate = (float64(analysis.WinningTrades) / float64(analysis.TotalTrades)) * 100
+		// 胜率排除打平交易
+		if decisiveTrades := analysis.TotalTrades - analysis.ScratchTrades; decisiveTrades > 0 {
+			analysis.WinRate = (float64(analysis.WinningTrades) / float64(decisiveTrades)) * 100
+		}
 		totalWinAmount := analysis.AvgWin
 		totalLossAmount := analysis.AvgLoss // This is a negative value
+		if l.scratchAsLoss {
+			totalLossAmount -= scratchLossAmount // 打平交易按微小亏损计入（更保守）
+		}
 		if analysis.WinningTrades > 0 {
 			analysis.AvgWin /= float64(analysis.WinningTrades)
 		}
 		if analysis.LosingTrades > 0 {
 			analysis.AvgLoss /= float64(analysis.LosingTrades)
 		}
-		if totalLossAmount != 0 {
-			analysis.ProfitFactor = totalWinAmount / math.Abs(totalLossAmount)
-		} else if totalWinAmount > 0 {
-			analysis.ProfitFactor = 999.0 // Infinite profit factor
-		}
+		analysis.ProfitFactor = profitFactor(totalWinAmount, totalLossAmount)
+		analysis.BreakEvenWinRate = BreakEvenWinRate(analysis.AvgWin, analysis.AvgLoss)
+		analysis.WinRateMargin = analysis.WinRate - analysis.BreakEvenWinRate
 	}
 
 	bestPnL := -1e9
 	worstPnL := 1e9
 	for symbol, stats := range analysis.SymbolStats {
 		if stats.TotalTrades > 0 {
-			stats.WinRate = (float64(stats.WinningTrades) / float64(stats.TotalTrades)) * 100
+			stats.WinRate = decisiveWinRate(stats.WinningTrades, stats.LosingTrades)
 			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
 			if stats.TotalPnL > bestPnL {
 				bestPnL = stats.TotalPnL
@@ -540,6 +1572,39 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 			}
 		}
 	}
+	for _, stats := range []*SymbolPerformance{analysis.LongStats, analysis.ShortStats} {
+		if stats.TotalTrades > 0 {
+			stats.WinRate = decisiveWinRate(stats.WinningTrades, stats.LosingTrades)
+			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
+		}
+	}
+	for _, stats := range analysis.RegimeStats {
+		if stats.TotalTrades > 0 {
+			stats.WinRate = decisiveWinRate(stats.WinningTrades, stats.LosingTrades)
+			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
+		}
+	}
+
+	// 在截断最近交易之前，基于全部已匹配交易计算VWAP偏离
+	analysis.AvgWinnerVWAPDistancePct, analysis.AvgLoserVWAPDistancePct = calculateVWAPDistances(analysis.RecentTrades, l.scratchBandPct)
+	analysis.TopTradesProfitSharePct = calculateProfitConcentration(analysis.RecentTrades, 3)
+	if winnerMAECount > 0 {
+		analysis.AvgWinnerMAE = winnerMAESum / float64(winnerMAECount)
+	}
+	analysis.CurrentStreak, analysis.MaxWinStreak, analysis.MaxLossStreak = calculateStreaks(analysis.RecentTrades, l.scratchBandPct)
+	analysis.AvgHoldingMinutes, analysis.AvgWinnerMinutes, analysis.AvgLoserMinutes = calculateHoldingMinutes(analysis.RecentTrades, l.scratchBandPct)
+	analysis.ActionChurn = detectActionChurn(records)
+	if len(records) > 0 {
+		intervals := make([][2]time.Time, 0, len(analysis.RecentTrades)+len(openPositions))
+		for _, trade := range analysis.RecentTrades {
+			intervals = append(intervals, [2]time.Time{trade.OpenTime, trade.CloseTime})
+		}
+		periodEnd := records[len(records)-1].Timestamp
+		for _, pos := range openPositions {
+			intervals = append(intervals, [2]time.Time{pos.OpenTime, periodEnd})
+		}
+		analysis.TimeInMarketPct = calculateTimeInMarketPct(intervals, records[0].Timestamp, periodEnd)
+	}
 
 	// 反转，让最新的交易在前
 	if len(analysis.RecentTrades) > 0 {
@@ -554,10 +1619,189 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 	}
 
 	analysis.SharpeRatio = l.calculateSharpeRatio(records)
+	analysis.SortinoRatio = l.calculateSortinoRatio(records)
+	equityPoints := l.equityCurve(records)
+	analysis.MaxDrawdownPct, analysis.MaxDrawdownUSD = calculateMaxDrawdown(equityPoints)
+	analysis.CalmarRatio = calculateCalmarRatio(equityPoints, analysis.MaxDrawdownPct)
+	l.roundAnalysis(analysis)
 
 	return analysis, nil
 }
 
+// calculateStreaks 按时间顺序（从旧到新）统计连胜连败: 当前连续次数（连胜为正，连败为负）、最长连胜、最长连败
+// 打平交易（盈亏百分比在打平区间内或零盈亏）将当前连续次数清零
+func calculateStreaks(trades []TradeOutcome, scratchBandPct float64) (current, maxWin, maxLoss int) {
+	for _, trade := range trades {
+		switch tradeResult(trade, scratchBandPct) {
+		case 1:
+			if current < 0 {
+				current = 0
+			}
+			current++
+		case -1:
+			if current > 0 {
+				current = 0
+			}
+			current--
+		default:
+			current = 0
+		}
+		if current > maxWin {
+			maxWin = current
+		}
+		if -current > maxLoss {
+			maxLoss = -current
+		}
+	}
+	return current, maxWin, maxLoss
+}
+
+// churnWindowCycles 开仓→平仓、平仓→再开仓之间最多间隔的记录数，超过则不视为反复开平
+const churnWindowCycles = 2
+
+// detectActionChurn 按时间顺序（从旧到新）检测各币种的开仓→平仓→同向再开仓，相邻两个动作的间隔不超过churnWindowCycles条记录
+// 只看模型给出的开平仓动作（无论是否执行成功），一次反复开平的再开仓可以作为下一次的开仓
+func detectActionChurn(records []*DecisionRecord) []ActionChurn {
+	type step struct {
+		action string // open/close
+		side   string
+		index  int
+		cycle  int
+	}
+	var churns []ActionChurn
+	history := make(map[string][]step)
+	for i, record := range records {
+		for _, action := range record.Decisions {
+			actionType, side := getActionType(action.Action), getSideFromAction(action.Action)
+			if (actionType != "open" && actionType != "close") || side == "" {
+				continue
+			}
+			steps := append(history[action.Symbol], step{action: actionType, side: side, index: i, cycle: record.CycleNumber})
+			if n := len(steps); n >= 3 {
+				open, closing, reopen := steps[n-3], steps[n-2], steps[n-1]
+				if open.action == "open" && closing.action == "close" && reopen.action == "open" &&
+					open.side == side && closing.side == side && reopen.side == side &&
+					closing.index-open.index <= churnWindowCycles && reopen.index-closing.index <= churnWindowCycles {
+					churns = append(churns, ActionChurn{Symbol: action.Symbol, Side: side,
+						OpenCycle: open.cycle, CloseCycle: closing.cycle, ReopenCycle: reopen.cycle})
+				}
+			}
+			history[action.Symbol] = steps
+		}
+	}
+	return churns
+}
+
+// calculateTimeInMarketPct 计算[start, end]区间内被持仓区间覆盖的时间占比（%）
+// 持仓区间先裁剪到分析区间内，再按开始时间排序合并重叠部分，避免同时持有多个仓位时重复计算
+func calculateTimeInMarketPct(intervals [][2]time.Time, start, end time.Time) float64 {
+	period := end.Sub(start)
+	if period <= 0 {
+		return 0
+	}
+
+	var clipped [][2]time.Time
+	for _, interval := range intervals {
+		from, to := interval[0], interval[1]
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			clipped = append(clipped, [2]time.Time{from, to})
+		}
+	}
+	sort.Slice(clipped, func(i, j int) bool { return clipped[i][0].Before(clipped[j][0]) })
+
+	var covered time.Duration
+	var current [2]time.Time
+	for i, interval := range clipped {
+		if i > 0 && !interval[0].After(current[1]) {
+			if interval[1].After(current[1]) {
+				current[1] = interval[1]
+			}
+			continue
+		}
+		if i > 0 {
+			covered += current[1].Sub(current[0])
+		}
+		current = interval
+	}
+	if len(clipped) > 0 {
+		covered += current[1].Sub(current[0])
+	}
+	return float64(covered) / float64(period) * 100
+}
+
+// dispositionHoldRatio 亏损交易平均持仓时长超过盈利交易的多少倍时提示处置效应
+const dispositionHoldRatio = 1.5
+
+// calculateHoldingMinutes 计算平均持仓时长（分钟）: 全部交易、盈利交易、亏损交易
+// 盈亏分组与VWAP偏离一致，打平区间内的交易只计入全部交易
+func calculateHoldingMinutes(trades []TradeOutcome, scratchBandPct float64) (all, winner, loser float64) {
+	var winnerSum, loserSum float64
+	var winners, losers int
+	for _, trade := range trades {
+		minutes := trade.CloseTime.Sub(trade.OpenTime).Minutes()
+		all += minutes
+		if scratchBandPct > 0 && math.Abs(trade.PnLPct) <= scratchBandPct {
+			continue
+		}
+		if trade.PnL > 0 {
+			winnerSum += minutes
+			winners++
+		} else if trade.PnL < 0 {
+			loserSum += minutes
+			losers++
+		}
+	}
+
+	if len(trades) > 0 {
+		all /= float64(len(trades))
+	}
+	if winners > 0 {
+		winner = winnerSum / float64(winners)
+	}
+	if losers > 0 {
+		loser = loserSum / float64(losers)
+	}
+	return all, winner, loser
+}
+
+// timestampFutureTolerance 记录时间超过当前时间多久才视为未来时间（容忍轻微的时钟偏差）
+const timestampFutureTolerance = time.Minute
+
+// TimestampAnomalies 检查最近N条记录的时间戳，报告时间倒退或处于未来的记录
+func (l *DecisionLogger) TimestampAnomalies(lookbackCycles int) ([]string, error) {
+	records, err := l.GetLatestRecords(lookbackCycles)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+	return detectTimestampAnomalies(records, time.Now()), nil
+}
+
+// detectTimestampAnomalies 按日志顺序扫描记录，报告时间早于上一条记录或晚于now的记录
+func detectTimestampAnomalies(records []*DecisionRecord, now time.Time) []string {
+	var anomalies []string
+	var previous time.Time
+	for _, record := range records {
+		if record.Timestamp.After(now.Add(timestampFutureTolerance)) {
+			anomalies = append(anomalies, fmt.Sprintf(
+				"时间戳异常: 周期#%d 的时间 %s 晚于当前时间 %s，可能存在时钟偏差或记录被手动修改",
+				record.CycleNumber, record.Timestamp.Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05")))
+		}
+		if !previous.IsZero() && record.Timestamp.Before(previous) {
+			anomalies = append(anomalies, fmt.Sprintf(
+				"时间戳异常: 周期#%d 的时间 %s 早于上一条记录 %s，记录顺序可能错乱",
+				record.CycleNumber, record.Timestamp.Format("2006-01-02 15:04:05"), previous.Format("2006-01-02 15:04:05")))
+		}
+		previous = record.Timestamp
+	}
+	return anomalies
+}
+
 // --- Helper functions for AnalyzePerformance ---
 func getSideFromAction(action string) string {
 	if action == "open_long" || action == "close_long" {
@@ -577,38 +1821,142 @@ func getActionType(action string) string {
 	return ""
 }
 
-// calculateSharpeRatio 计算夏普比率
-// 基于账户净值的变化计算风险调整后收益
-func (l *DecisionLogger) calculateSharpeRatio(records []*DecisionRecord) float64 {
-	if len(records) < 2 {
-		return 0.0
+// classifyStrategyClose 细分未触及止盈止损的平仓原因（manual表示本周期AI决策中没有该平仓，如手动或外部平仓）
+func (l *DecisionLogger) classifyStrategyClose(side string, closePrice, entryVWAP float64, held time.Duration, manual bool) string {
+	switch {
+	case manual:
+		return "manual"
+	case entryVWAP > 0 && side == "long" && closePrice < entryVWAP,
+		entryVWAP > 0 && side == "short" && closePrice > entryVWAP:
+		return "vwap_reversal"
+	case l.timeStop > 0 && held >= l.timeStop:
+		return "time_stop"
 	}
+	return "Strategy"
+}
 
-	// 提取每个周期的账户净值
-	// 注意：TotalBalance字段实际存储的是TotalEquity（账户总净值）
-	// TotalUnrealizedProfit字段实际存储的是TotalPnL（相对初始余额的盈亏）
-	var equities []float64
-	for _, record := range records {
-		// 直接使用TotalBalance，因为它已经是完整的账户净值
-		equity := record.AccountState.TotalBalance
-		if equity > 0 {
-			equities = append(equities, equity)
+// calculateRMultiples 以开仓价到止损的距离为1R，计算计划与实际的R倍数
+func calculateRMultiples(side string, openPrice, closePrice, stopLoss, takeProfit float64) (intendedR, realizedR float64) {
+	risk := math.Abs(openPrice - stopLoss)
+	if stopLoss <= 0 || risk == 0 {
+		return 0, 0
+	}
+
+	move := closePrice - openPrice
+	if side == "short" {
+		move = -move
+	}
+	realizedR = move / risk
+	if takeProfit > 0 {
+		intendedR = math.Abs(takeProfit-openPrice) / risk
+	}
+	return intendedR, realizedR
+}
+
+// classifyTargetFill 对比平仓价与计划止盈价，判断盈利平仓是提前离场、达到目标还是超过目标
+// 与平仓原因判断一致，止盈价±0.1%以内视为达到目标；亏损或未设置止盈的交易不分类
+func classifyTargetFill(side string, closePrice, takeProfit, pnl float64) string {
+	if takeProfit <= 0 || pnl <= 0 {
+		return ""
+	}
+	if math.Abs(closePrice-takeProfit) <= takeProfit*0.001 {
+		return "target"
+	}
+	if (side == "long" && closePrice > takeProfit) || (side == "short" && closePrice < takeProfit) {
+		return "overshoot"
+	}
+	return "early"
+}
+
+// calculateProfitConcentration 计算盈利最多的topN笔交易占全部盈利交易总盈利的百分比（无盈利交易时为0）
+func calculateProfitConcentration(trades []TradeOutcome, topN int) float64 {
+	var profits []float64
+	var totalProfit float64
+	for _, trade := range trades {
+		if trade.PnL > 0 {
+			profits = append(profits, trade.PnL)
+			totalProfit += trade.PnL
 		}
 	}
+	if totalProfit == 0 {
+		return 0
+	}
 
-	if len(equities) < 2 {
-		return 0.0
+	sort.Sort(sort.Reverse(sort.Float64Slice(profits)))
+	if len(profits) > topN {
+		profits = profits[:topN]
+	}
+	var topProfit float64
+	for _, p := range profits {
+		topProfit += p
+	}
+	return topProfit / totalProfit * 100
+}
+
+// calculateSetupScore 按VWAP策略规则对入场条件打分（0-100）
+// VWAP方向一致占40分，RSI未进入超买/超卖区占30分，MACD方向一致占30分
+func calculateSetupScore(side string, openPrice, vwap, rsi, macd float64) int {
+	if vwap <= 0 {
+		return 0 // 缺少入场快照，无法评估
 	}
 
-	// 计算周期收益率（period returns）
-	var returns []float64
-	for i := 1; i < len(equities); i++ {
-		if equities[i-1] > 0 {
-			periodReturn := (equities[i] - equities[i-1]) / equities[i-1]
-			returns = append(returns, periodReturn)
+	score := 0
+	if side == "long" {
+		if openPrice > vwap {
+			score += 40
+		}
+		if rsi < 70 {
+			score += 30
+		}
+		if macd > 0 {
+			score += 30
+		}
+	} else if side == "short" {
+		if openPrice < vwap {
+			score += 40
+		}
+		if rsi > 30 {
+			score += 30
+		}
+		if macd < 0 {
+			score += 30
+		}
+	}
+	return score
+}
+
+// calculateVWAPDistances 分别计算盈利和亏损交易入场价偏离VWAP的平均距离（百分比）
+// 缺少入场VWAP的交易和打平交易不参与计算
+func calculateVWAPDistances(trades []TradeOutcome, scratchBandPct float64) (winnerPct, loserPct float64) {
+	var winnerSum, loserSum float64
+	var winners, losers int
+	for _, trade := range trades {
+		if trade.EntryVWAP <= 0 || (scratchBandPct > 0 && math.Abs(trade.PnLPct) <= scratchBandPct) {
+			continue
+		}
+		distance := math.Abs(trade.OpenPrice/trade.EntryVWAP-1) * 100
+		if trade.PnL > 0 {
+			winnerSum += distance
+			winners++
+		} else if trade.PnL < 0 {
+			loserSum += distance
+			losers++
 		}
 	}
 
+	if winners > 0 {
+		winnerPct = winnerSum / float64(winners)
+	}
+	if losers > 0 {
+		loserPct = loserSum / float64(losers)
+	}
+	return winnerPct, loserPct
+}
+
+// calculateSharpeRatio 计算夏普比率
+// 基于账户净值的变化计算风险调整后收益
+func (l *DecisionLogger) calculateSharpeRatio(records []*DecisionRecord) float64 {
+	returns := l.ratioReturns(records)
 	if len(returns) == 0 {
 		return 0.0
 	}
@@ -645,8 +1993,348 @@ func (l *DecisionLogger) calculateSharpeRatio(records []*DecisionRecord) float64
 	return sharpeRatio
 }
 
+// calculateMaxDrawdown 计算净值曲线的最大回撤（百分比相对当时的历史高点，金额为绝对跌幅，两者分别取最大值）
+func calculateMaxDrawdown(points []equityPoint) (pct, usd float64) {
+	peak := 0.0
+	for _, p := range points {
+		if p.Equity > peak {
+			peak = p.Equity
+			continue
+		}
+		drop := peak - p.Equity
+		if drop > usd {
+			usd = drop
+		}
+		if peak > 0 && drop/peak*100 > pct {
+			pct = drop / peak * 100
+		}
+	}
+	return pct, usd
+}
+
+// calculateCalmarRatio 计算卡玛比率：区间总收益率（末净值/初净值-1）除以最大回撤比例
+func calculateCalmarRatio(points []equityPoint, maxDrawdownPct float64) float64 {
+	if len(points) < 2 || points[0].Equity <= 0 {
+		return 0
+	}
+	totalReturn := points[len(points)-1].Equity/points[0].Equity - 1
+	if maxDrawdownPct <= 0 {
+		if totalReturn > 0 {
+			return 999.0 // 无回撤的正收益
+		}
+		return 0
+	}
+	return totalReturn / (maxDrawdownPct / 100)
+}
+
+// ratioReturns 提取夏普/索提诺比率使用的周期收益率（净值曲线可选按时间窗口重采样）
+func (l *DecisionLogger) ratioReturns(records []*DecisionRecord) []float64 {
+	if len(records) < 2 {
+		return nil
+	}
+	points := l.equityCurve(records)
+	if l.sharpeResampleInterval > 0 {
+		points = resampleEquityCurve(points, l.sharpeResampleInterval)
+	}
+	return periodReturns(points)
+}
+
+// calculateSortinoRatio 计算索提诺比率
+// 与夏普比率相同的收益序列，但分母只使用下行偏差（负收益的均方根），不惩罚上涨波动
+func (l *DecisionLogger) calculateSortinoRatio(records []*DecisionRecord) float64 {
+	returns := l.ratioReturns(records)
+	if len(returns) == 0 {
+		return 0.0
+	}
+
+	sumReturns := 0.0
+	sumSquaredDownside := 0.0
+	for _, r := range returns {
+		sumReturns += r
+		if r < 0 {
+			sumSquaredDownside += r * r
+		}
+	}
+	meanReturn := sumReturns / float64(len(returns))
+	downsideDev := math.Sqrt(sumSquaredDownside / float64(len(returns)))
+
+	// 没有负收益时与夏普比率的约定一致
+	if downsideDev == 0 {
+		if meanReturn > 0 {
+			return 999.0
+		}
+		return 0.0
+	}
+	return meanReturn / downsideDev
+}
+
+// equityPoint 净值曲线上的一个点
+type equityPoint struct {
+	CycleNumber int
+	Timestamp   time.Time
+	Equity      float64
+}
+
+// extractEquityCurve 从记录中提取净值曲线（按记录顺序，跳过无效净值）
+// 注意：TotalBalance字段实际存储的是TotalEquity（账户总净值）
+func extractEquityCurve(records []*DecisionRecord) []equityPoint {
+	var points []equityPoint
+	for _, record := range records {
+		if record.AccountState.TotalBalance > 0 {
+			points = append(points, equityPoint{
+				CycleNumber: record.CycleNumber,
+				Timestamp:   record.Timestamp,
+				Equity:      record.AccountState.TotalBalance,
+			})
+		}
+	}
+	return points
+}
+
+// equityCurve 按配置提取净值曲线（快照净值或盯市净值）
+func (l *DecisionLogger) equityCurve(records []*DecisionRecord) []equityPoint {
+	if l.markToMarketEquity {
+		return extractMarkToMarketEquityCurve(records)
+	}
+	return extractEquityCurve(records)
+}
+
+// extractMarkToMarketEquityCurve 按市场数据快照对持仓盯市，得到包含浮盈浮亏波动的净值曲线
+// 净值 = 快照净值 + Σ 持仓数量 × (行情价 - 标记价)（空仓取反），缺少行情快照的持仓不做调整
+func extractMarkToMarketEquityCurve(records []*DecisionRecord) []equityPoint {
+	points := extractEquityCurve(records)
+	if len(points) == 0 {
+		return points
+	}
+
+	i := 0
+	for _, record := range records {
+		if record.AccountState.TotalBalance <= 0 {
+			continue
+		}
+		for _, pos := range record.Positions {
+			snapshot, ok := record.MarketData[pos.Symbol]
+			if !ok || snapshot.CurrentPrice <= 0 || pos.MarkPrice <= 0 {
+				continue
+			}
+			move := math.Abs(pos.PositionAmt) * (snapshot.CurrentPrice - pos.MarkPrice)
+			if pos.Side == "short" {
+				move = -move
+			}
+			points[i].Equity += move
+		}
+		i++
+	}
+	return points
+}
+
+// resampleEquityCurve 按固定时间窗口重采样净值曲线，每个窗口取最后一个净值
+func resampleEquityCurve(points []equityPoint, interval time.Duration) []equityPoint {
+	if interval <= 0 || len(points) == 0 {
+		return points
+	}
+
+	var resampled []equityPoint
+	var currentBucket time.Time
+	for _, p := range points {
+		bucket := p.Timestamp.Truncate(interval)
+		if len(resampled) > 0 && bucket.Equal(currentBucket) {
+			resampled[len(resampled)-1] = p
+			continue
+		}
+		currentBucket = bucket
+		resampled = append(resampled, p)
+	}
+	return resampled
+}
+
+// CycleEquityChange 单个周期相对上一周期的净值变化
+type CycleEquityChange struct {
+	CycleNumber int       `json:"cycle_number"` // 周期编号
+	Timestamp   time.Time `json:"timestamp"`    // 决策时间
+	Equity      float64   `json:"equity"`       // 周期净值
+	Delta       float64   `json:"delta"`        // 相对上一周期的净值变化
+	DeltaPct    float64   `json:"delta_pct"`    // 相对上一周期的净值变化百分比
+}
+
+// GetCycleLeaderboard 获取最近N个周期按净值变化排序的排行榜（涨幅最大的在前，跌幅最大的在后）
+func (l *DecisionLogger) GetCycleLeaderboard(lookbackCycles int) ([]CycleEquityChange, error) {
+	records, err := l.GetLatestRecords(lookbackCycles)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	points := l.equityCurve(records)
+	var changes []CycleEquityChange
+	for i := 1; i < len(points); i++ {
+		delta := points[i].Equity - points[i-1].Equity
+		changes = append(changes, CycleEquityChange{
+			CycleNumber: points[i].CycleNumber,
+			Timestamp:   points[i].Timestamp,
+			Equity:      points[i].Equity,
+			Delta:       delta,
+			DeltaPct:    delta / points[i-1].Equity * 100,
+		})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Delta > changes[j].Delta
+	})
+	return changes, nil
+}
+
+// ReturnPoint 累计收益曲线上的一个点
+type ReturnPoint struct {
+	Timestamp     time.Time `json:"timestamp"`      // 决策时间
+	CumulativePct float64   `json:"cumulative_pct"` // 相对第一个净值点的累计收益率（%）
+}
+
+// CumulativeReturns 获取最近N个周期的累计收益率曲线（由周期收益率复利累乘，用于图表展示）
+// 第一个点为基准（0%）；没有有效净值或读取记录失败时返回nil
+func (l *DecisionLogger) CumulativeReturns(lookbackCycles int) []ReturnPoint {
+	records, err := l.GetLatestRecords(lookbackCycles)
+	if err != nil {
+		return nil
+	}
+	return cumulativeReturns(l.equityCurve(records))
+}
+
+// cumulativeReturns 将净值曲线转换为累计收益率曲线
+func cumulativeReturns(points []equityPoint) []ReturnPoint {
+	if len(points) == 0 {
+		return nil
+	}
+
+	result := []ReturnPoint{{Timestamp: points[0].Timestamp}}
+	growth := 1.0
+	for i := 1; i < len(points); i++ {
+		growth *= 1 + (points[i].Equity-points[i-1].Equity)/points[i-1].Equity
+		result = append(result, ReturnPoint{Timestamp: points[i].Timestamp, CumulativePct: (growth - 1) * 100})
+	}
+	return result
+}
+
+// StalePosition 标记价格在连续多个周期内未变化的持仓（行情数据可能已停止更新）
+type StalePosition struct {
+	Symbol       string    `json:"symbol"`        // 币种
+	Side         string    `json:"side"`          // long/short
+	MarkPrice    float64   `json:"mark_price"`    // 冻结的标记价格
+	FrozenCycles int       `json:"frozen_cycles"` // 标记价格不变的连续周期数
+	Since        time.Time `json:"since"`         // 首次出现该价格的周期时间
+}
+
+// GetStalePositions 检查最近frozenCycles个周期，返回标记价格始终不变的当前持仓（frozenCycles最小为2）
+func (l *DecisionLogger) GetStalePositions(frozenCycles int) ([]StalePosition, error) {
+	if frozenCycles < 2 {
+		frozenCycles = 2
+	}
+	records, err := l.GetLatestRecords(frozenCycles)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+	return detectStalePositions(records, frozenCycles), nil
+}
+
+// detectStalePositions 以最新记录的持仓为准，向前比较持仓快照，连续frozenCycles个周期标记价格相同则视为冻结
+func detectStalePositions(records []*DecisionRecord, frozenCycles int) []StalePosition {
+	if len(records) < frozenCycles || len(records) == 0 {
+		return nil
+	}
+
+	latest := records[len(records)-1]
+	var stale []StalePosition
+	for _, pos := range latest.Positions {
+		frozen := 1
+		since := latest.Timestamp
+		for i := len(records) - 2; i >= 0 && frozen < frozenCycles; i-- {
+			prev, ok := findPositionSnapshot(records[i].Positions, pos.Symbol, pos.Side)
+			if !ok || prev.MarkPrice != pos.MarkPrice {
+				break
+			}
+			frozen++
+			since = records[i].Timestamp
+		}
+		if frozen >= frozenCycles {
+			stale = append(stale, StalePosition{
+				Symbol:       pos.Symbol,
+				Side:         pos.Side,
+				MarkPrice:    pos.MarkPrice,
+				FrozenCycles: frozen,
+				Since:        since,
+			})
+		}
+	}
+	return stale
+}
+
+// findPositionSnapshot 在持仓快照中查找指定币种和方向的持仓
+func findPositionSnapshot(positions []PositionSnapshot, symbol, side string) (PositionSnapshot, bool) {
+	for _, pos := range positions {
+		if pos.Symbol == symbol && pos.Side == side {
+			return pos, true
+		}
+	}
+	return PositionSnapshot{}, false
+}
+
+// RealizedVolatility 计算最近N个周期账户收益率的年化波动率（样本标准差 × √每年周期数）
+// 收益率与夏普比率使用相同的净值曲线和重采样窗口；收益率少于2个时返回错误
+func (l *DecisionLogger) RealizedVolatility(lookbackCycles int) (float64, error) {
+	records, err := l.GetLatestRecords(lookbackCycles)
+	if err != nil {
+		return 0, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	points := l.equityCurve(records)
+	if l.sharpeResampleInterval > 0 {
+		points = resampleEquityCurve(points, l.sharpeResampleInterval)
+	}
+	returns := periodReturns(points)
+	if len(returns) < 2 {
+		return 0, fmt.Errorf("收益率样本不足（需要至少2个，实际%d个）", len(returns))
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	sumSquaredDiff := 0.0
+	for _, r := range returns {
+		sumSquaredDiff += (r - mean) * (r - mean)
+	}
+	stdDev := math.Sqrt(sumSquaredDiff / float64(len(returns)-1))
+
+	periodsPerYear := l.periodsPerYear
+	if periodsPerYear <= 0 && l.sharpeResampleInterval > 0 {
+		periodsPerYear = float64(365*24*time.Hour) / float64(l.sharpeResampleInterval)
+	}
+	if periodsPerYear > 0 {
+		stdDev *= math.Sqrt(periodsPerYear)
+	}
+	return stdDev, nil
+}
+
+// periodReturns 计算净值曲线的周期收益率
+func periodReturns(points []equityPoint) []float64 {
+	var returns []float64
+	for i := 1; i < len(points); i++ {
+		if points[i-1].Equity > 0 {
+			returns = append(returns, (points[i].Equity-points[i-1].Equity)/points[i-1].Equity)
+		}
+	}
+	return returns
+}
+
 // GenerateTradingInsights 生成交易洞察
 func GenerateTradingInsights(analysis *PerformanceAnalysis) string {
+	return GenerateTradingInsightsWithHoldStreak(analysis, 0)
+}
+
+// GenerateTradingInsightsWithHoldStreak 生成交易洞察，并对平仓前连续hold至少minHoldCycles个周期的交易
+// 复盘持仓耐心：盈利说明耐心持有得到回报，亏损说明在走势恶化时仍在持有（minHoldCycles<=0表示不分析）
+func GenerateTradingInsightsWithHoldStreak(analysis *PerformanceAnalysis, minHoldCycles int) string {
 	if analysis == nil || len(analysis.RecentTrades) == 0 {
 		return "没有足够的历史交易来进行复盘。"
 	}
@@ -661,7 +2349,39 @@ func GenerateTradingInsights(analysis *PerformanceAnalysis) string {
 
 	recentTrades := analysis.RecentTrades[:numTradesToAnalyze]
 
+	// 反复开平属于高危行为，最先提示
+	for _, churn := range analysis.ActionChurn {
+		insight := fmt.Sprintf("🚨 反复开平[%s %s]: 周期#%d开仓、#%d平仓、#%d又同向开仓，决策摇摆且白白消耗手续费。建议: 平仓后至少观察几个周期，确认信号改变再重新入场。",
+			churn.Symbol, churn.Side, churn.OpenCycle, churn.CloseCycle, churn.ReopenCycle)
+		insights = append(insights, insight)
+	}
+
+	// 高频亏损模式优先提示（至少2笔亏损属于同一入场条件组合才算规律）
+	if setup := analysis.TopLosingSetup(); setup != nil && setup.Count >= 2 {
+		side, vwap := "开多仓", "高于"
+		if setup.Side == "short" {
+			side = "开空仓"
+		}
+		if setup.VWAP == "below" {
+			vwap = "低于"
+		}
+		insight := fmt.Sprintf("⚠️ 高频亏损模式: 亏损交易中最常见的是价格%sVWAP、RSI%s时%s（%d笔，合计亏损%.2f）。建议: 避免在该条件下开仓。",
+			vwap, setup.RSIBand, side, setup.Count, setup.TotalLoss)
+		insights = append(insights, insight)
+	}
+
 	for _, trade := range recentTrades {
+		// 分析平仓前的连续hold
+		if minHoldCycles > 0 && trade.HoldCycles >= minHoldCycles {
+			if trade.PnL < 0 {
+				insight := fmt.Sprintf("复盘亏损交易[%s %s]: 连续hold %d个周期后亏损平仓，属于持仓恶化仍继续持有。建议: 持仓走弱时及时止损或减仓，不要被动等待。", trade.Symbol, trade.Side, trade.HoldCycles)
+				insights = append(insights, insight)
+			} else if trade.PnL > 0 {
+				insight := fmt.Sprintf("复盘盈利交易[%s %s]: 连续hold %d个周期后盈利平仓，耐心持有得到回报。启示: 趋势未被破坏时坚持持有。", trade.Symbol, trade.Side, trade.HoldCycles)
+				insights = append(insights, insight)
+			}
+		}
+
 		// 分析亏损交易
 		if trade.PnL < 0 {
 			// 1. 分析止损交易
@@ -702,6 +2422,27 @@ func GenerateTradingInsights(analysis *PerformanceAnalysis) string {
 		}
 	}
 
+	// 连胜连败
+	if analysis.CurrentStreak <= -3 {
+		insight := fmt.Sprintf("⚠️ 连败提示: 当前已连续亏损%d笔（最长连败%d笔）。建议: 降低后续开仓的仓位，等待状态恢复后再恢复正常仓位。", -analysis.CurrentStreak, analysis.MaxLossStreak)
+		insights = append(insights, insight)
+	} else if analysis.CurrentStreak >= 3 {
+		insight := fmt.Sprintf("当前连续盈利%d笔（最长连胜%d笔）。启示: 保持纪律，不要因连胜而放大仓位。", analysis.CurrentStreak, analysis.MaxWinStreak)
+		insights = append(insights, insight)
+	}
+
+	// 处置效应：亏损单拿得比盈利单久
+	if analysis.AvgWinnerMinutes > 0 && analysis.AvgLoserMinutes > analysis.AvgWinnerMinutes*dispositionHoldRatio {
+		insight := fmt.Sprintf("⚠️ 处置效应: 亏损交易平均持仓%.0f分钟，明显长于盈利交易的%.0f分钟，存在截断盈利、让亏损奔跑的倾向。建议: 严格执行止损，给盈利单更多空间。", analysis.AvgLoserMinutes, analysis.AvgWinnerMinutes)
+		insights = append(insights, insight)
+	}
+
+	// 收益是否足以补偿回撤
+	if analysis.MaxDrawdownPct > 0 && analysis.CalmarRatio < 0.5 {
+		insight := fmt.Sprintf("⚠️ 风险警告: 卡玛比率仅为 %.2f（区间收益 / %.2f%%最大回撤），收益不足以补偿所承受的回撤。建议: 降低仓位或杠杆、收紧止损。", analysis.CalmarRatio, analysis.MaxDrawdownPct)
+		insights = append(insights, insight)
+	}
+
 	if len(insights) == 0 {
 		return "最近的交易没有明显的、可供总结的规律。请继续观察。"
 	}
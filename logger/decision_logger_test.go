@@ -3,9 +3,12 @@ package logger
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -159,4 +162,1447 @@ func TestAnalyzePerformance(t *testing.T) {
 	if btcTrade.EntryVWAP != 60000 {
 		t.Errorf("Expected BTC EntryVWAP to be 60000, but got %.2f", btcTrade.EntryVWAP)
 	}
+
+	// Break-even win rate = |avgLoss| / (avgWin + |avgLoss|)
+	expectedBreakEven := math.Abs(expectedEthPnl) / (expectedBtcPnl + math.Abs(expectedEthPnl)) * 100
+	if math.Abs(analysis.BreakEvenWinRate-expectedBreakEven) > 0.01 {
+		t.Errorf("Expected BreakEvenWinRate %.2f, but got %.2f", expectedBreakEven, analysis.BreakEvenWinRate)
+	}
+	if math.Abs(analysis.WinRateMargin-(50-expectedBreakEven)) > 0.01 {
+		t.Errorf("Expected WinRateMargin %.2f, but got %.2f", 50-expectedBreakEven, analysis.WinRateMargin)
+	}
+}
+
+func TestGetLatestRecordsOrdersByCycleWithinSameSecond(t *testing.T) {
+	logDir := t.TempDir()
+	// Lexically cycle10 and cycle11 sort before cycle2
+	for _, cycle := range []int{2, 10, 11} {
+		data, _ := json.Marshal(DecisionRecord{CycleNumber: cycle})
+		createTestLogFile(t, logDir, fmt.Sprintf("decision_20250101_120000_cycle%d.json", cycle), data)
+	}
+	// An earlier second must stay older regardless of its cycle number
+	data, _ := json.Marshal(DecisionRecord{CycleNumber: 1})
+	createTestLogFile(t, logDir, "decision_20250101_115959_cycle1.json", data)
+
+	records, err := NewDecisionLogger(logDir).GetLatestRecords(2)
+	if err != nil {
+		t.Fatalf("GetLatestRecords failed: %v", err)
+	}
+	if len(records) != 2 || records[0].CycleNumber != 10 || records[1].CycleNumber != 11 {
+		t.Fatalf("Expected cycles 10 and 11 with 11 newest, but got %v", cycleNumbers(records))
+	}
+
+	records, err = NewDecisionLogger(logDir).GetLatestRecords(10)
+	if err != nil {
+		t.Fatalf("GetLatestRecords failed: %v", err)
+	}
+	if got := cycleNumbers(records); fmt.Sprint(got) != "[1 2 10 11]" {
+		t.Errorf("Expected chronological order [1 2 10 11], but got %v", got)
+	}
+}
+
+func cycleNumbers(records []*DecisionRecord) []int {
+	cycles := make([]int, 0, len(records))
+	for _, record := range records {
+		cycles = append(cycles, record.CycleNumber)
+	}
+	return cycles
+}
+
+func TestBreakEvenWinRate(t *testing.T) {
+	if rate := BreakEvenWinRate(20, -10); math.Abs(rate-100.0/3) > 1e-9 {
+		t.Errorf("Expected 2:1 payoff to break even at 33.33%%, but got %.4f", rate)
+	}
+	if rate := BreakEvenWinRate(20, 0); rate != 0 {
+		t.Errorf("Expected no losses to need a 0%% win rate, but got %.2f", rate)
+	}
+	if rate := BreakEvenWinRate(0, -10); rate != 100 {
+		t.Errorf("Expected no wins to need a 100%% win rate, but got %.2f", rate)
+	}
+}
+
+func TestSharpeRatioHourlyResampling(t *testing.T) {
+	// 3 hours of 3-minute cycles: equity trends up by 1 per cycle, with
+	// alternating +/-3 noise that makes raw per-cycle returns flip sign.
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var records []*DecisionRecord
+	for i := 0; i < 60; i++ {
+		equity := 1000.0 + float64(i)
+		if i%2 == 1 {
+			equity -= 3
+		}
+		records = append(records, &DecisionRecord{
+			Timestamp:    start.Add(time.Duration(i*3) * time.Minute),
+			AccountState: AccountSnapshot{TotalBalance: equity},
+		})
+	}
+
+	points := extractEquityCurve(records)
+	rawReturns := periodReturns(points)
+	hourlyReturns := periodReturns(resampleEquityCurve(points, time.Hour))
+
+	if len(hourlyReturns) >= len(rawReturns) {
+		t.Fatalf("Expected hourly resampling to produce fewer returns than raw cycles, got %d vs %d", len(hourlyReturns), len(rawReturns))
+	}
+	if len(hourlyReturns) != 2 {
+		t.Errorf("Expected 2 hourly returns over 3 hourly buckets, but got %d", len(hourlyReturns))
+	}
+
+	hasNegativeRaw := false
+	for _, r := range rawReturns {
+		if r < 0 {
+			hasNegativeRaw = true
+		}
+	}
+	if !hasNegativeRaw {
+		t.Errorf("Expected raw per-cycle returns to contain noisy negative periods")
+	}
+	for _, r := range hourlyReturns {
+		if r <= 0 {
+			t.Errorf("Expected hourly returns to follow the upward trend, but got %.6f", r)
+		}
+	}
+
+	// Default (no resampling) and hourly Sharpe should differ, with hourly smoother
+	logger := &DecisionLogger{}
+	rawSharpe := logger.calculateSharpeRatio(records)
+	logger.SetSharpeResampleInterval(time.Hour)
+	hourlySharpe := logger.calculateSharpeRatio(records)
+	if hourlySharpe <= rawSharpe {
+		t.Errorf("Expected hourly Sharpe (%.4f) to exceed noisy per-cycle Sharpe (%.4f)", hourlySharpe, rawSharpe)
+	}
+}
+
+// writeTestRecords writes records to dir in chronological order, one file per record.
+func writeTestRecords(t *testing.T, dir string, records []DecisionRecord) {
+	t.Helper()
+	for i, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			t.Fatalf("Failed to marshal test record %d: %v", i, err)
+		}
+		createTestLogFile(t, dir, fmt.Sprintf("log_%03d.json", i), data)
+	}
+}
+
+// newTestLogger creates a DecisionLogger over a temporary directory containing records.
+func newTestLogger(t *testing.T, records []DecisionRecord) *DecisionLogger {
+	t.Helper()
+	logDir := t.TempDir()
+	writeTestRecords(t, logDir, records)
+	return NewDecisionLogger(logDir)
+}
+
+// roundTripRecords builds an open and a close record for a single trade.
+func roundTripRecords(symbol, side string, openPrice, closePrice float64, openTime, closeTime time.Time, entry MarketDataSnapshot) []DecisionRecord {
+	return []DecisionRecord{
+		{
+			Timestamp: openTime,
+			Decisions: []DecisionAction{
+				{Action: "open_" + side, Symbol: symbol, Quantity: 1, Leverage: 10, Price: openPrice, Timestamp: openTime, Success: true},
+			},
+			MarketData: map[string]MarketDataSnapshot{symbol: entry},
+		},
+		{
+			Timestamp: closeTime,
+			Decisions: []DecisionAction{
+				{Action: "close_" + side, Symbol: symbol, Quantity: 1, Price: closePrice, Timestamp: closeTime, Success: true},
+			},
+		},
+	}
+}
+
+func TestSetupScore(t *testing.T) {
+	base := time.Now().Add(-2 * time.Hour)
+
+	// On-rule long: price above VWAP, RSI below 70, MACD positive
+	var records []DecisionRecord
+	records = append(records, roundTripRecords("BTCUSDT", "long", 60100, 61000, base, base.Add(10*time.Minute),
+		MarketDataSnapshot{CurrentPrice: 60100, CurrentVWAP: 60000, CurrentRSI7: 55, CurrentMACD: 10})...)
+	// Against-VWAP long: price below VWAP, RSI overbought
+	records = append(records, roundTripRecords("SOLUSDT", "long", 95, 94, base.Add(20*time.Minute), base.Add(30*time.Minute),
+		MarketDataSnapshot{CurrentPrice: 95, CurrentVWAP: 100, CurrentRSI7: 75, CurrentMACD: 0.5})...)
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.RecentTrades) != 2 {
+		t.Fatalf("Expected 2 trades, but got %d", len(analysis.RecentTrades))
+	}
+
+	offRule := analysis.RecentTrades[0]
+	onRule := analysis.RecentTrades[1]
+	if onRule.SetupScore != 100 {
+		t.Errorf("Expected on-rule long SetupScore to be 100, but got %d", onRule.SetupScore)
+	}
+	if offRule.SetupScore != 30 {
+		t.Errorf("Expected against-VWAP long SetupScore to be 30, but got %d", offRule.SetupScore)
+	}
+}
+
+func TestAnalyzePerformanceBaseCurrency(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	logger := newTestLogger(t, roundTripRecords("BTCUSDC", "long", 60000, 61000, base, base.Add(10*time.Minute), MarketDataSnapshot{}))
+
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if analysis.BaseCurrency != "USDT" {
+		t.Errorf("Expected default BaseCurrency to be USDT, but got %s", analysis.BaseCurrency)
+	}
+
+	logger.SetBaseCurrency("USDC")
+	analysis, err = logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if analysis.BaseCurrency != "USDC" {
+		t.Errorf("Expected BaseCurrency to be USDC, but got %s", analysis.BaseCurrency)
+	}
+}
+
+func TestScratchTrades(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	var records []DecisionRecord
+	// +0.05% on margin: 10x leverage with a 0.005% price move
+	records = append(records, roundTripRecords("BTCUSDT", "long", 60000, 60003, base, base.Add(5*time.Minute), MarketDataSnapshot{})...)
+	records = append(records, roundTripRecords("ETHUSDT", "long", 3000, 3030, base.Add(10*time.Minute), base.Add(15*time.Minute), MarketDataSnapshot{})...)
+	records = append(records, roundTripRecords("SOLUSDT", "long", 100, 99, base.Add(20*time.Minute), base.Add(25*time.Minute), MarketDataSnapshot{})...)
+	logger := newTestLogger(t, records)
+
+	// Default: the tiny winner still counts as a win
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if analysis.WinningTrades != 2 || analysis.ScratchTrades != 0 {
+		t.Errorf("Expected 2 wins and 0 scratches by default, but got %d wins and %d scratches", analysis.WinningTrades, analysis.ScratchTrades)
+	}
+
+	logger.SetScratchBandPct(0.1)
+	analysis, err = logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if analysis.ScratchTrades != 1 {
+		t.Errorf("Expected 1 scratch trade under a 0.1%% band, but got %d", analysis.ScratchTrades)
+	}
+	if analysis.WinningTrades != 1 || analysis.LosingTrades != 1 {
+		t.Errorf("Expected 1 win and 1 loss, but got %d wins and %d losses", analysis.WinningTrades, analysis.LosingTrades)
+	}
+	if analysis.WinRate != 50.0 {
+		t.Errorf("Expected WinRate excluding scratches to be 50.0, but got %.2f", analysis.WinRate)
+	}
+	// Group win rates use the same denominator as the headline figure
+	if analysis.LongStats.WinRate != 50.0 {
+		t.Errorf("Expected the long-side WinRate excluding scratches to be 50.0, but got %.2f", analysis.LongStats.WinRate)
+	}
+	if btc := analysis.SymbolStats["BTCUSDT"]; btc == nil || btc.WinRate != 0 || btc.TotalTrades != 1 {
+		t.Errorf("Expected a scratch-only symbol to have a 0 win rate over 1 trade, but got %+v", btc)
+	}
+	// Trade-series metrics carry the band along with the analysis
+	if rates := analysis.RollingWinRate(3); len(rates) != 1 || rates[0] != 50.0 {
+		t.Errorf("Expected a rolling win rate of 50.0 excluding the scratch, but got %v", rates)
+	}
+}
+
+func TestScratchTradesInTradeSeries(t *testing.T) {
+	// Chronological sequence: W, L, scratch loser, L, scratch winner, W (band 0.5%)
+	sequence := []TradeOutcome{
+		{PnL: 10, PnLPct: 5},
+		{PnL: -10, PnLPct: -5, Side: "long", EntryVWAP: 100, OpenPrice: 101, EntryRSI: 50},
+		{PnL: -1, PnLPct: -0.2, Side: "long", EntryVWAP: 100, OpenPrice: 101, EntryRSI: 45},
+		{PnL: -10, PnLPct: -5, Side: "long", EntryVWAP: 100, OpenPrice: 102, EntryRSI: 55},
+		{PnL: 1, PnLPct: 0.3},
+		{PnL: 10, PnLPct: 5},
+	}
+	analysis := &PerformanceAnalysis{ScratchBandPct: 0.5}
+	for i := len(sequence) - 1; i >= 0; i-- {
+		analysis.RecentTrades = append(analysis.RecentTrades, sequence[i])
+	}
+
+	// Windows of 3: {W,L,S}=50, {L,S,L}=0, {S,L,S}=0, {L,S,W}=50
+	rates := analysis.RollingWinRate(3)
+	expected := []float64{50, 0, 0, 50}
+	if len(rates) != len(expected) {
+		t.Fatalf("Expected %d rolling values, but got %v", len(expected), rates)
+	}
+	for i := range expected {
+		if math.Abs(rates[i]-expected[i]) > 1e-9 {
+			t.Errorf("Expected rolling win rate %.2f at %d, but got %.2f", expected[i], i, rates[i])
+		}
+	}
+
+	// Scratches reset the streak: without the band the two losers would form a 3-loss streak
+	if current, maxWin, maxLoss := calculateStreaks(sequence, 0.5); current != 1 || maxWin != 1 || maxLoss != 1 {
+		t.Errorf("Expected scratches to reset streaks (current 1, max win 1, max loss 1), but got %d, %d, %d", current, maxWin, maxLoss)
+	}
+	if _, _, maxLoss := calculateStreaks(sequence, 0); maxLoss != 3 {
+		t.Errorf("Expected a 3-loss streak without a band, but got %d", maxLoss)
+	}
+
+	// The scratch loser shares the setup but is not counted as a loss
+	setup := analysis.TopLosingSetup()
+	if setup == nil || setup.Side != "long" || setup.Count != 2 {
+		t.Errorf("Expected the long above-VWAP setup with 2 losses, but got %+v", setup)
+	}
+}
+
+func TestOverlappingOpensDiagnostics(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	records := []DecisionRecord{
+		{
+			Timestamp: base,
+			Decisions: []DecisionAction{{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 10, Price: 60000, Timestamp: base, Success: true}},
+		},
+		{
+			Timestamp: base.Add(3 * time.Minute),
+			Decisions: []DecisionAction{{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 10, Price: 60500, Timestamp: base.Add(3 * time.Minute), Success: true}},
+		},
+	}
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.Diagnostics) != 1 {
+		t.Fatalf("Expected 1 overlap diagnostic, but got %d: %v", len(analysis.Diagnostics), analysis.Diagnostics)
+	}
+	if !strings.Contains(analysis.Diagnostics[0], "BTCUSDT") || !strings.Contains(analysis.Diagnostics[0], "重叠开仓") {
+		t.Errorf("Expected overlap diagnostic for BTCUSDT, but got %s", analysis.Diagnostics[0])
+	}
+}
+
+func TestVWAPDistanceByOutcome(t *testing.T) {
+	base := time.Now().Add(-2 * time.Hour)
+	var records []DecisionRecord
+	// Winners entered 0.5% and 1.5% from VWAP (avg 1%)
+	records = append(records, roundTripRecords("BTCUSDT", "long", 100.5, 102, base, base.Add(5*time.Minute), MarketDataSnapshot{CurrentVWAP: 100})...)
+	records = append(records, roundTripRecords("ETHUSDT", "short", 98.5, 97, base.Add(10*time.Minute), base.Add(15*time.Minute), MarketDataSnapshot{CurrentVWAP: 100})...)
+	// Losers entered 3% and 5% from VWAP (avg 4%)
+	records = append(records, roundTripRecords("SOLUSDT", "long", 103, 101, base.Add(20*time.Minute), base.Add(25*time.Minute), MarketDataSnapshot{CurrentVWAP: 100})...)
+	records = append(records, roundTripRecords("BNBUSDT", "short", 95, 96, base.Add(30*time.Minute), base.Add(35*time.Minute), MarketDataSnapshot{CurrentVWAP: 100})...)
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+
+	if math.Abs(analysis.AvgWinnerVWAPDistancePct-1.0) > 1e-9 {
+		t.Errorf("Expected winners' average VWAP distance to be 1.00%%, but got %.4f%%", analysis.AvgWinnerVWAPDistancePct)
+	}
+	if math.Abs(analysis.AvgLoserVWAPDistancePct-4.0) > 1e-9 {
+		t.Errorf("Expected losers' average VWAP distance to be 4.00%%, but got %.4f%%", analysis.AvgLoserVWAPDistancePct)
+	}
+}
+
+func TestCycleLeaderboard(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	equities := []float64{1000, 1010, 980, 1050, 1045}
+	var records []DecisionRecord
+	for i, equity := range equities {
+		records = append(records, DecisionRecord{
+			Timestamp:    base.Add(time.Duration(i) * 3 * time.Minute),
+			CycleNumber:  i + 1,
+			AccountState: AccountSnapshot{TotalBalance: equity},
+		})
+	}
+
+	leaderboard, err := newTestLogger(t, records).GetCycleLeaderboard(10)
+	if err != nil {
+		t.Fatalf("GetCycleLeaderboard failed: %v", err)
+	}
+	if len(leaderboard) != 4 {
+		t.Fatalf("Expected 4 cycle changes, but got %d", len(leaderboard))
+	}
+
+	best := leaderboard[0]
+	if best.CycleNumber != 4 || best.Delta != 70 {
+		t.Errorf("Expected cycle 4 with +70 to be the biggest gain, but got cycle %d with %+.2f", best.CycleNumber, best.Delta)
+	}
+	worst := leaderboard[len(leaderboard)-1]
+	if worst.CycleNumber != 3 || worst.Delta != -30 {
+		t.Errorf("Expected cycle 3 with -30 to be the biggest loss, but got cycle %d with %+.2f", worst.CycleNumber, worst.Delta)
+	}
+	if !worst.Timestamp.Equal(records[2].Timestamp) {
+		t.Errorf("Expected the biggest-loss timestamp to match cycle 3, but got %v", worst.Timestamp)
+	}
+}
+
+func TestProfitFactorScratchAsLoss(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	var records []DecisionRecord
+	// +3 USDT scratch (0.05% on margin), +30 USDT winner, -1 USDT loser
+	records = append(records, roundTripRecords("BTCUSDT", "long", 60000, 60003, base, base.Add(5*time.Minute), MarketDataSnapshot{})...)
+	records = append(records, roundTripRecords("ETHUSDT", "long", 3000, 3030, base.Add(10*time.Minute), base.Add(15*time.Minute), MarketDataSnapshot{})...)
+	records = append(records, roundTripRecords("SOLUSDT", "long", 100, 99, base.Add(20*time.Minute), base.Add(25*time.Minute), MarketDataSnapshot{})...)
+	logger := newTestLogger(t, records)
+	logger.SetScratchBandPct(0.1)
+
+	// Default: the scratch trade is ignored, 30 / 1
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if math.Abs(analysis.ProfitFactor-30.0) > 1e-9 {
+		t.Errorf("Expected ProfitFactor to be 30.00 by default, but got %.4f", analysis.ProfitFactor)
+	}
+
+	// Scratch counted as a loss of its absolute PnL: 30 / (1 + 3)
+	logger.SetScratchAsLoss(true)
+	analysis, err = logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if math.Abs(analysis.ProfitFactor-7.5) > 1e-9 {
+		t.Errorf("Expected ProfitFactor to be 7.50 with scratch-as-loss, but got %.4f", analysis.ProfitFactor)
+	}
+}
+
+func TestRoundDecimals(t *testing.T) {
+	logger := NewDecisionLogger(t.TempDir())
+	logger.SetRoundDecimals(2)
+
+	record := &DecisionRecord{
+		AccountState: AccountSnapshot{TotalBalance: 1012.345678, TotalUnrealizedProfit: 12.345678},
+		Positions:    []PositionSnapshot{{Symbol: "BTCUSDT", Side: "long", EntryPrice: 60000.123456, UnrealizedProfit: -3.14159}},
+	}
+	if err := logger.LogDecision(record); err != nil {
+		t.Fatalf("LogDecision failed: %v", err)
+	}
+	if record.AccountState.TotalUnrealizedProfit != 12.345678 {
+		t.Errorf("Expected the caller's record to be left unrounded, but got %v", record.AccountState.TotalUnrealizedProfit)
+	}
+
+	logged, err := logger.GetLatestRecords(1)
+	if err != nil || len(logged) != 1 {
+		t.Fatalf("Expected 1 logged record, but got %d (err: %v)", len(logged), err)
+	}
+	if logged[0].AccountState.TotalUnrealizedProfit != 12.35 {
+		t.Errorf("Expected logged unrealized PnL to be 12.35, but got %v", logged[0].AccountState.TotalUnrealizedProfit)
+	}
+	if logged[0].Positions[0].UnrealizedProfit != -3.14 {
+		t.Errorf("Expected logged position PnL to be -3.14, but got %v", logged[0].Positions[0].UnrealizedProfit)
+	}
+	if logged[0].Positions[0].EntryPrice != 60000.123456 {
+		t.Errorf("Expected prices to keep full precision, but got %v", logged[0].Positions[0].EntryPrice)
+	}
+
+	// Trade PnL in the analysis is rounded without affecting matching
+	base := time.Now().Add(-time.Hour)
+	tradeLogger := newTestLogger(t, roundTripRecords("BTCUSDT", "long", 60000, 60001.23456, base, base.Add(5*time.Minute), MarketDataSnapshot{}))
+	tradeLogger.SetRoundDecimals(2)
+	analysis, err := tradeLogger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.RecentTrades) != 1 {
+		t.Fatalf("Expected 1 matched trade, but got %d", len(analysis.RecentTrades))
+	}
+	if analysis.RecentTrades[0].PnL != 1.23 {
+		t.Errorf("Expected trade PnL to be rounded to 1.23, but got %v", analysis.RecentTrades[0].PnL)
+	}
+}
+
+func TestRejectionStats(t *testing.T) {
+	logger := NewDecisionLogger(t.TempDir())
+	records := []*DecisionRecord{
+		{
+			Decisions: []DecisionAction{{Action: "open_long", Symbol: "BTCUSDT"}, {Action: "wait", Symbol: "ETHUSDT"}},
+			RejectedDecisions: []RejectedDecision{
+				{Symbol: "SOLUSDT", Action: "open_long", Stage: "risk", Reason: "组合热度超限"},
+				{Symbol: "DOGEUSDT", Action: "open_short", Stage: "cross_validation", Reason: "交叉验证未通过"},
+			},
+		},
+		{
+			RejectedDecisions: []RejectedDecision{
+				{Symbol: "XRPUSDT", Action: "open_long", Stage: "risk", Reason: "组合热度超限", Detail: "- 风控 XRPUSDT open_long: ..."},
+			},
+		},
+		{Decisions: []DecisionAction{{Action: "hold", Symbol: "BTCUSDT"}}},
+	}
+	for _, record := range records {
+		if err := logger.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision failed: %v", err)
+		}
+	}
+
+	logged, err := logger.GetLatestRecords(10)
+	if err != nil {
+		t.Fatalf("GetLatestRecords failed: %v", err)
+	}
+	persisted := 0
+	for _, record := range logged {
+		persisted += len(record.RejectedDecisions)
+	}
+	if persisted != 3 {
+		t.Errorf("Expected 3 rejected decisions to be persisted, but got %d", persisted)
+	}
+
+	stats, err := logger.GetRejectionStats(10)
+	if err != nil {
+		t.Fatalf("GetRejectionStats failed: %v", err)
+	}
+	if stats.TotalProposed != 6 || stats.TotalRejected != 3 {
+		t.Errorf("Expected 3 of 6 proposed decisions rejected, but got %d of %d", stats.TotalRejected, stats.TotalProposed)
+	}
+	if stats.ByReason["组合热度超限"] != 2 || stats.ByReason["交叉验证未通过"] != 1 {
+		t.Errorf("Expected counts by reason {heat: 2, cross: 1}, but got %v", stats.ByReason)
+	}
+	if math.Abs(stats.RateByReason["组合热度超限"]-100.0/3) > 1e-9 {
+		t.Errorf("Expected heat rejection rate to be 33.33%%, but got %.2f%%", stats.RateByReason["组合热度超限"])
+	}
+	if stats.ByStage["risk"] != 2 {
+		t.Errorf("Expected 2 risk-stage rejections, but got %d", stats.ByStage["risk"])
+	}
+}
+
+func TestMarkToMarketEquityCurve(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	held := func(mark float64) []PositionSnapshot {
+		return []PositionSnapshot{{Symbol: "SOLUSDT", Side: "long", PositionAmt: 10, EntryPrice: 100, MarkPrice: mark}}
+	}
+	records := []*DecisionRecord{
+		// Market snapshot agrees with the account snapshot
+		{Timestamp: base, AccountState: AccountSnapshot{TotalBalance: 1000}, Positions: held(100),
+			MarketData: map[string]MarketDataSnapshot{"SOLUSDT": {CurrentPrice: 100}}},
+		// Price rallied to 110 after the account snapshot was taken: +100 unrealized
+		{Timestamp: base.Add(3 * time.Minute), AccountState: AccountSnapshot{TotalBalance: 1000}, Positions: held(100),
+			MarketData: map[string]MarketDataSnapshot{"SOLUSDT": {CurrentPrice: 110}}},
+		// No market snapshot: falls back to the account balance
+		{Timestamp: base.Add(6 * time.Minute), AccountState: AccountSnapshot{TotalBalance: 1020}, Positions: held(102)},
+	}
+
+	balanceOnly := extractEquityCurve(records)
+	enriched := extractMarkToMarketEquityCurve(records)
+
+	if len(enriched) != 3 {
+		t.Fatalf("Expected 3 equity points, but got %d", len(enriched))
+	}
+	if balanceOnly[1].Equity != 1000 {
+		t.Errorf("Expected balance-only curve to miss the swing at 1000, but got %.2f", balanceOnly[1].Equity)
+	}
+	if enriched[1].Equity != 1100 {
+		t.Errorf("Expected enriched curve to reflect the unrealized swing at 1100, but got %.2f", enriched[1].Equity)
+	}
+	if enriched[2].Equity != 1020 {
+		t.Errorf("Expected enriched curve to fall back to the balance 1020 without market data, but got %.2f", enriched[2].Equity)
+	}
+}
+
+func TestTradeDossier(t *testing.T) {
+	openTime := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	closeTime := openTime.Add(30 * time.Minute)
+
+	records := roundTripRecords("BTCUSDT", "long", 60100, 61000, openTime, closeTime,
+		MarketDataSnapshot{CurrentPrice: 60100, CurrentVWAP: 60000, CurrentRSI7: 55, CurrentMACD: 10})
+	records[0].InputPrompt = "BTC prompt"
+	records[0].CoTTrace = "BTC breaking above VWAP"
+	records[0].DecisionJSON = `[{"symbol": "BTCUSDT", "action": "open_long", "leverage": 10, "position_size_usd": 1000, "stop_loss": 60000, "take_profit": 62000}]`
+	records = append(records, roundTripRecords("ETHUSDT", "short", 3020, 3050, openTime.Add(5*time.Minute), openTime.Add(10*time.Minute), MarketDataSnapshot{})...)
+	logger := newTestLogger(t, records)
+
+	dossier, err := logger.TradeDossier("BTCUSDT", openTime)
+	if err != nil {
+		t.Fatalf("TradeDossier failed: %v", err)
+	}
+	if dossier.Side != "long" || dossier.OpenAction.Price != 60100 {
+		t.Errorf("Expected long open at 60100, but got %s at %.2f", dossier.Side, dossier.OpenAction.Price)
+	}
+	if dossier.OpenRecord.InputPrompt != "BTC prompt" || dossier.OpenRecord.CoTTrace != "BTC breaking above VWAP" {
+		t.Errorf("Expected open record prompt and CoT to be included, but got %q / %q", dossier.OpenRecord.InputPrompt, dossier.OpenRecord.CoTTrace)
+	}
+	if dossier.EntryMarketData.CurrentVWAP != 60000 {
+		t.Errorf("Expected entry VWAP 60000, but got %.2f", dossier.EntryMarketData.CurrentVWAP)
+	}
+	if dossier.CloseAction == nil || dossier.CloseAction.Price != 61000 {
+		t.Fatalf("Expected close action at 61000, but got %+v", dossier.CloseAction)
+	}
+	if !dossier.CloseRecord.Timestamp.Equal(closeTime) {
+		t.Errorf("Expected close record at %v, but got %v", closeTime, dossier.CloseRecord.Timestamp)
+	}
+
+	if _, err := logger.TradeDossier("BTCUSDT", openTime.Add(time.Minute)); err == nil {
+		t.Errorf("Expected an error for an unknown open time")
+	}
+}
+
+func TestRealizedVsIntendedR(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	records := roundTripRecords("BTCUSDT", "long", 60000, 61990, base, base.Add(10*time.Minute), MarketDataSnapshot{})
+	records[0].DecisionJSON = `[{"symbol": "BTCUSDT", "action": "open_long", "stop_loss": 59500, "take_profit": 62000}]`
+	records = append(records, roundTripRecords("ETHUSDT", "short", 3000, 3030, base.Add(20*time.Minute), base.Add(30*time.Minute), MarketDataSnapshot{})...)
+	records[2].DecisionJSON = `[{"symbol": "ETHUSDT", "action": "open_short", "stop_loss": 3030, "take_profit": 2910}]`
+	logger := newTestLogger(t, records)
+
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.RecentTrades) != 2 {
+		t.Fatalf("Expected 2 trades, but got %d", len(analysis.RecentTrades))
+	}
+
+	btc := analysis.RecentTrades[1]
+	if btc.CloseReason != "TP" {
+		t.Errorf("Expected BTC trade to hit TP, but got %s", btc.CloseReason)
+	}
+	if math.Abs(btc.IntendedR-4) > 1e-9 {
+		t.Errorf("Expected BTC IntendedR 4, but got %.4f", btc.IntendedR)
+	}
+	if math.Abs(btc.RealizedR-btc.IntendedR) > 0.05 {
+		t.Errorf("Expected BTC RealizedR near IntendedR %.2f, but got %.4f", btc.IntendedR, btc.RealizedR)
+	}
+
+	eth := analysis.RecentTrades[0]
+	if math.Abs(eth.IntendedR-3) > 1e-9 || math.Abs(eth.RealizedR+1) > 1e-9 {
+		t.Errorf("Expected ETH stop-out at -1R of a planned 3R, but got realized %.4f intended %.4f", eth.RealizedR, eth.IntendedR)
+	}
+}
+
+func TestStalePositions(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	var records []DecisionRecord
+	for i := 0; i < 4; i++ {
+		records = append(records, DecisionRecord{
+			Timestamp: base.Add(time.Duration(i) * 3 * time.Minute),
+			Positions: []PositionSnapshot{
+				{Symbol: "BTCUSDT", Side: "long", MarkPrice: 60000},                    // frozen feed
+				{Symbol: "ETHUSDT", Side: "short", MarkPrice: 3000 + float64(i)},       // updating normally
+				{Symbol: "SOLUSDT", Side: "long", MarkPrice: 150 + float64(min(i, 1))}, // frozen for the last 3 cycles only
+			},
+		})
+	}
+	logger := newTestLogger(t, records)
+
+	stale, err := logger.GetStalePositions(4)
+	if err != nil {
+		t.Fatalf("GetStalePositions failed: %v", err)
+	}
+	if len(stale) != 1 || stale[0].Symbol != "BTCUSDT" {
+		t.Fatalf("Expected only BTCUSDT to be flagged across 4 cycles, but got %+v", stale)
+	}
+	if stale[0].FrozenCycles != 4 || !stale[0].Since.Equal(base) {
+		t.Errorf("Expected BTCUSDT frozen for 4 cycles since %v, but got %d since %v", base, stale[0].FrozenCycles, stale[0].Since)
+	}
+
+	stale, _ = logger.GetStalePositions(3)
+	if len(stale) != 2 {
+		t.Errorf("Expected BTCUSDT and SOLUSDT to be flagged across 3 cycles, but got %+v", stale)
+	}
+}
+
+func TestProfitConcentration(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	build := func(bigWin float64) []DecisionRecord {
+		var records []DecisionRecord
+		records = append(records, roundTripRecords("BTCUSDT", "long", 60000, 60000+bigWin, base, base.Add(5*time.Minute), MarketDataSnapshot{})...)
+		for i := 1; i <= 5; i++ {
+			open := base.Add(time.Duration(i) * 10 * time.Minute)
+			records = append(records, roundTripRecords("ETHUSDT", "long", 3000, 3010, open, open.Add(5*time.Minute), MarketDataSnapshot{})...)
+		}
+		records = append(records, roundTripRecords("SOLUSDT", "long", 150, 140, base.Add(time.Hour), base.Add(65*time.Minute), MarketDataSnapshot{})...)
+		return records
+	}
+
+	// One +1000 trade among five +10 trades: top 3 = 1020 of 1050
+	analysis, err := newTestLogger(t, build(1000)).AnalyzePerformance(20)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if math.Abs(analysis.TopTradesProfitSharePct-1020.0/1050*100) > 1e-9 {
+		t.Errorf("Expected top-3 profit share %.2f%%, but got %.2f%%", 1020.0/1050*100, analysis.TopTradesProfitSharePct)
+	}
+
+	// Six equal +10 trades: top 3 = half of profits
+	analysis, _ = newTestLogger(t, build(10)).AnalyzePerformance(20)
+	if math.Abs(analysis.TopTradesProfitSharePct-50) > 1e-9 {
+		t.Errorf("Expected broad-based profits to give a 50%% share, but got %.2f%%", analysis.TopTradesProfitSharePct)
+	}
+}
+
+func TestValidatorAccuracy(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	winner := roundTripRecords("BTCUSDT", "long", 60000, 61000, base, base.Add(5*time.Minute), MarketDataSnapshot{})
+	winner[0].ValidatorVotes = []ValidatorVote{
+		{Validator: "sharp", Symbol: "BTCUSDT", Action: "open_long", Agree: true},
+		{Validator: "noisy", Symbol: "BTCUSDT", Action: "open_long", Agree: false},
+	}
+	loser := roundTripRecords("ETHUSDT", "short", 3000, 3100, base.Add(10*time.Minute), base.Add(15*time.Minute), MarketDataSnapshot{})
+	loser[0].ValidatorVotes = []ValidatorVote{
+		{Validator: "sharp", Symbol: "ETHUSDT", Action: "open_short", Agree: false},
+		{Validator: "noisy", Symbol: "ETHUSDT", Action: "open_short", Agree: false},
+	}
+	logger := newTestLogger(t, append(winner, loser...))
+
+	accuracy, err := logger.GetValidatorAccuracy(10)
+	if err != nil {
+		t.Fatalf("GetValidatorAccuracy failed: %v", err)
+	}
+	if accuracy["sharp"] != 1 {
+		t.Errorf("Expected sharp to be right on both trades, but got %.2f", accuracy["sharp"])
+	}
+	if accuracy["noisy"] != 0.5 {
+		t.Errorf("Expected noisy to be right on one of two trades, but got %.2f", accuracy["noisy"])
+	}
+}
+
+func TestRealizedVolatility(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	var records []DecisionRecord
+	for i, equity := range []float64{100, 110, 99, 108.9} { // returns +10%, -10%, +10%
+		records = append(records, DecisionRecord{
+			Timestamp:    base.Add(time.Duration(i) * time.Hour),
+			AccountState: AccountSnapshot{TotalBalance: equity},
+		})
+	}
+	logger := newTestLogger(t, records)
+	logger.SetPeriodsPerYear(252)
+
+	// mean = 1/30, sample variance = (2×(1/15)² + (2/15)²) / 2 = 1/75
+	expected := math.Sqrt(1.0/75) * math.Sqrt(252)
+	vol, err := logger.RealizedVolatility(10)
+	if err != nil {
+		t.Fatalf("RealizedVolatility failed: %v", err)
+	}
+	if math.Abs(vol-expected) > 1e-9 {
+		t.Errorf("Expected annualized volatility %.6f, but got %.6f", expected, vol)
+	}
+
+	if _, err := newTestLogger(t, records[:2]).RealizedVolatility(10); err == nil {
+		t.Errorf("Expected an error with only one return")
+	}
+}
+
+func TestTimestampAnomalies(t *testing.T) {
+	now := time.Now()
+	logger := newTestLogger(t, []DecisionRecord{
+		{CycleNumber: 1, Timestamp: now.Add(-30 * time.Minute)},
+		{CycleNumber: 2, Timestamp: now.Add(-27 * time.Minute)},
+		{CycleNumber: 3, Timestamp: now.Add(24 * time.Hour)}, // future-dated
+		{CycleNumber: 4, Timestamp: now.Add(-21 * time.Minute)},
+	})
+
+	anomalies, err := logger.TimestampAnomalies(10)
+	if err != nil {
+		t.Fatalf("TimestampAnomalies failed: %v", err)
+	}
+	if len(anomalies) != 2 {
+		t.Fatalf("Expected a future timestamp and a backwards step to be reported, but got %v", anomalies)
+	}
+	if !strings.Contains(anomalies[0], "周期#3") || !strings.Contains(anomalies[0], "晚于当前时间") {
+		t.Errorf("Expected cycle 3 to be reported as future-dated, but got %s", anomalies[0])
+	}
+	if !strings.Contains(anomalies[1], "周期#4") || !strings.Contains(anomalies[1], "早于上一条记录") {
+		t.Errorf("Expected cycle 4 to be reported as going backwards, but got %s", anomalies[1])
+	}
+}
+
+func TestRollingWinRate(t *testing.T) {
+	// Chronological sequence W W L W L L; RecentTrades is newest first
+	sequence := []float64{10, 10, -10, 10, -10, -10}
+	analysis := &PerformanceAnalysis{}
+	for i := len(sequence) - 1; i >= 0; i-- {
+		analysis.RecentTrades = append(analysis.RecentTrades, TradeOutcome{PnL: sequence[i]})
+	}
+
+	rates := analysis.RollingWinRate(3)
+	expected := []float64{200.0 / 3, 200.0 / 3, 100.0 / 3, 100.0 / 3}
+	if len(rates) != len(expected) {
+		t.Fatalf("Expected %d rolling values, but got %v", len(expected), rates)
+	}
+	for i := range expected {
+		if math.Abs(rates[i]-expected[i]) > 1e-9 {
+			t.Errorf("Expected rolling win rate %.2f at %d, but got %.2f", expected[i], i, rates[i])
+		}
+	}
+
+	if rates := analysis.RollingWinRate(10); len(rates) != 1 || rates[0] != 50 {
+		t.Errorf("Expected a single 50%% value for a window larger than the trade count, but got %v", rates)
+	}
+	if rates := (&PerformanceAnalysis{}).RollingWinRate(3); rates != nil {
+		t.Errorf("Expected nil with no trades, but got %v", rates)
+	}
+}
+
+func TestLongShortStats(t *testing.T) {
+	// Same fixture as TestAnalyzePerformance: winning BTC long, losing ETH short
+	base := time.Now().Add(-1 * time.Hour)
+	records := roundTripRecords("BTCUSDT", "long", 60100, 61000, base, base.Add(30*time.Minute), MarketDataSnapshot{})
+	records = append(records, roundTripRecords("ETHUSDT", "short", 3020, 3050, base.Add(40*time.Minute), base.Add(50*time.Minute), MarketDataSnapshot{})...)
+	l := newTestLogger(t, records)
+
+	analysis, err := l.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+
+	long, short := analysis.LongStats, analysis.ShortStats
+	if long.TotalTrades != 1 || long.WinningTrades != 1 || long.LosingTrades != 0 {
+		t.Errorf("Expected long bucket to hold the winning BTC trade, but got %+v", long)
+	}
+	if math.Abs(long.TotalPnL-900) > 1e-9 || long.WinRate != 100 {
+		t.Errorf("Expected long PnL 900 with 100%% win rate, but got %+v", long)
+	}
+	if short.TotalTrades != 1 || short.WinningTrades != 0 || short.LosingTrades != 1 {
+		t.Errorf("Expected short bucket to hold the losing ETH trade, but got %+v", short)
+	}
+	if math.Abs(short.TotalPnL+30) > 1e-9 || short.WinRate != 0 {
+		t.Errorf("Expected short PnL -30 with 0%% win rate, but got %+v", short)
+	}
+}
+
+func TestRegimeStats(t *testing.T) {
+	base := time.Now().Add(-2 * time.Hour)
+	tagged := func(regime string, records []DecisionRecord) []DecisionRecord {
+		records[0].MarketRegime = regime
+		records[1].MarketRegime = "range" // 平仓时的状态不影响分组
+		return records
+	}
+
+	// Up regime: two winners, one loser; down regime: one winner, one loser; one untagged trade
+	var records []DecisionRecord
+	records = append(records, tagged("up", roundTripRecords("BTCUSDT", "long", 60000, 60500, base, base.Add(5*time.Minute), MarketDataSnapshot{}))...)
+	records = append(records, tagged("up", roundTripRecords("ETHUSDT", "long", 3000, 3030, base.Add(10*time.Minute), base.Add(15*time.Minute), MarketDataSnapshot{}))...)
+	records = append(records, tagged("up", roundTripRecords("SOLUSDT", "long", 100, 98, base.Add(20*time.Minute), base.Add(25*time.Minute), MarketDataSnapshot{}))...)
+	records = append(records, tagged("down", roundTripRecords("BTCUSDT", "short", 60000, 59800, base.Add(30*time.Minute), base.Add(35*time.Minute), MarketDataSnapshot{}))...)
+	records = append(records, tagged("down", roundTripRecords("ETHUSDT", "long", 3000, 2990, base.Add(40*time.Minute), base.Add(45*time.Minute), MarketDataSnapshot{}))...)
+	records = append(records, roundTripRecords("SOLUSDT", "short", 100, 99, base.Add(50*time.Minute), base.Add(55*time.Minute), MarketDataSnapshot{})...)
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(20)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+
+	if len(analysis.RegimeStats) != 2 {
+		t.Fatalf("Expected stats for the up and down regimes only, but got %v", analysis.RegimeStats)
+	}
+	up, down := analysis.RegimeStats["up"], analysis.RegimeStats["down"]
+	if up == nil || up.TotalTrades != 3 || up.WinningTrades != 2 || math.Abs(up.WinRate-200.0/3) > 1e-9 {
+		t.Errorf("Expected up regime with 2 of 3 winners, but got %+v", up)
+	}
+	if down == nil || down.TotalTrades != 2 || down.WinningTrades != 1 || down.WinRate != 50 {
+		t.Errorf("Expected down regime with 1 of 2 winners, but got %+v", down)
+	}
+	if analysis.RecentTrades[0].EntryRegime != "" || analysis.RecentTrades[1].EntryRegime != "down" {
+		t.Errorf("Expected trades to carry the regime at entry, but got %q and %q",
+			analysis.RecentTrades[0].EntryRegime, analysis.RecentTrades[1].EntryRegime)
+	}
+}
+
+func TestHoldStreakInsight(t *testing.T) {
+	base := time.Now().Add(-2 * time.Hour)
+	open := roundTripRecords("SOLUSDT", "long", 100, 92, base, base.Add(time.Hour), MarketDataSnapshot{CurrentVWAP: 99})
+	records := []DecisionRecord{open[0]}
+	// Four cycles holding the deteriorating position, then the losing close
+	for i := 1; i <= 4; i++ {
+		records = append(records, DecisionRecord{
+			Timestamp:    base.Add(time.Duration(i) * 10 * time.Minute),
+			DecisionJSON: `[{"symbol": "SOLUSDT", "action": "hold"}]`,
+		})
+	}
+	open[1].DecisionJSON = `[{"symbol": "SOLUSDT", "action": "close_long"}]`
+	records = append(records, open[1])
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(20)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.RecentTrades) != 1 || analysis.RecentTrades[0].HoldCycles != 4 {
+		t.Fatalf("Expected one trade held for 4 cycles, but got %+v", analysis.RecentTrades)
+	}
+
+	insights := GenerateTradingInsightsWithHoldStreak(analysis, 3)
+	if !strings.Contains(insights, "连续hold 4个周期后亏损平仓") || !strings.Contains(insights, "持仓恶化仍继续持有") {
+		t.Errorf("Expected a held-through-deterioration insight, but got:\n%s", insights)
+	}
+	if strings.Contains(GenerateTradingInsights(analysis), "连续hold") {
+		t.Errorf("Expected no hold-streak insight when the analysis is disabled")
+	}
+	if strings.Contains(GenerateTradingInsightsWithHoldStreak(analysis, 5), "连续hold") {
+		t.Errorf("Expected no hold-streak insight below the configured streak")
+	}
+}
+
+func TestAvgWinnerMAE(t *testing.T) {
+	base := time.Now().Add(-2 * time.Hour)
+	// Long from 100 dips to 97 and 96 before rallying to a close at 110: 4% adverse excursion
+	records := roundTripRecords("SOLUSDT", "long", 100, 110, base, base.Add(40*time.Minute), MarketDataSnapshot{CurrentPrice: 100})
+	path := []DecisionRecord{}
+	for i, price := range []float64{97, 96, 104} {
+		path = append(path, DecisionRecord{
+			Timestamp:  base.Add(time.Duration(i+1) * 10 * time.Minute),
+			MarketData: map[string]MarketDataSnapshot{"SOLUSDT": {CurrentPrice: price}},
+		})
+	}
+	records = append([]DecisionRecord{records[0]}, append(path, records[1])...)
+	// A short winner without intervening snapshots does not count
+	records = append(records, roundTripRecords("ETHUSDT", "short", 3000, 2900, base.Add(50*time.Minute), base.Add(60*time.Minute), MarketDataSnapshot{})...)
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if math.Abs(analysis.AvgWinnerMAE-4) > 1e-9 {
+		t.Errorf("Expected an average winner MAE of 4%%, but got %.4f", analysis.AvgWinnerMAE)
+	}
+	if sol := analysis.RecentTrades[1]; sol.Symbol != "SOLUSDT" || math.Abs(sol.MAEPct-4) > 1e-9 {
+		t.Errorf("Expected the SOL trade to record a 4%% MAE, but got %+v", sol)
+	}
+
+	noPath, err := newTestLogger(t, roundTripRecords("BTCUSDT", "long", 100, 110, base, base.Add(time.Minute), MarketDataSnapshot{})).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if noPath.AvgWinnerMAE != 0 {
+		t.Errorf("Expected 0 without snapshot data, but got %.4f", noPath.AvgWinnerMAE)
+	}
+}
+
+func TestUnclosedPositions(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	records := roundTripRecords("ETHUSDT", "short", 3000, 2950, base, base.Add(10*time.Minute), MarketDataSnapshot{})
+	// BTC is opened but its close (e.g. a liquidation) was never logged
+	openTime := base.Add(20 * time.Minute)
+	records = append(records, DecisionRecord{
+		Timestamp: openTime,
+		Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 10, Price: 60000, Timestamp: openTime, Success: true},
+		},
+	}, DecisionRecord{
+		Timestamp: base.Add(30 * time.Minute),
+		Positions: []PositionSnapshot{{Symbol: "BTCUSDT", Side: "long", EntryPrice: 60000, MarkPrice: 55000, UnrealizedProfit: -5000}},
+	})
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.UnclosedPositions) != 1 || analysis.UnclosedPositions[0] != "BTCUSDT" {
+		t.Errorf("Expected BTCUSDT to be reported as unclosed, but got %v", analysis.UnclosedPositions)
+	}
+	if len(analysis.UnclosedPositionStates) != 1 || analysis.UnclosedPositionStates[0].UnrealizedProfit != -5000 {
+		t.Errorf("Expected the latest BTCUSDT snapshot to be exposed, but got %+v", analysis.UnclosedPositionStates)
+	}
+	if analysis.TotalTrades != 1 {
+		t.Errorf("Expected only the closed ETH trade in the stats, but got %d trades", analysis.TotalTrades)
+	}
+}
+
+func TestRollingProfitFactor(t *testing.T) {
+	// Chronological sequence: +30 -10 +20 +10 -20; RecentTrades is newest first
+	sequence := []float64{30, -10, 20, 10, -20}
+	analysis := &PerformanceAnalysis{}
+	for i := len(sequence) - 1; i >= 0; i-- {
+		analysis.RecentTrades = append(analysis.RecentTrades, TradeOutcome{PnL: sequence[i]})
+	}
+
+	factors := analysis.RollingProfitFactor(2)
+	expected := []float64{3, 2, 999, 0.5}
+	if len(factors) != len(expected) {
+		t.Fatalf("Expected %d rolling values, but got %v", len(expected), factors)
+	}
+	for i, want := range expected {
+		if math.Abs(factors[i]-want) > 1e-9 {
+			t.Errorf("Window %d: expected profit factor %.2f, but got %.2f", i, want, factors[i])
+		}
+	}
+
+	if all := analysis.RollingProfitFactor(10); len(all) != 1 || math.Abs(all[0]-2) > 1e-9 {
+		t.Errorf("Expected oversized window to cover all trades with PF 2, but got %v", all)
+	}
+}
+
+func TestTargetFill(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	// Long 100 → TP 110, closed at 108 (80% of the way)
+	records := roundTripRecords("SOLUSDT", "long", 100, 108, base, base.Add(10*time.Minute), MarketDataSnapshot{})
+	records[0].DecisionJSON = `[{"symbol": "SOLUSDT", "action": "open_long", "stop_loss": 95, "take_profit": 110}]`
+	// Short 100 → TP 90, closed at 88 (beyond target)
+	records = append(records, roundTripRecords("BNBUSDT", "short", 100, 88, base.Add(20*time.Minute), base.Add(30*time.Minute), MarketDataSnapshot{})...)
+	records[2].DecisionJSON = `[{"symbol": "BNBUSDT", "action": "open_short", "stop_loss": 105, "take_profit": 90}]`
+	logger := newTestLogger(t, records)
+
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if len(analysis.RecentTrades) != 2 {
+		t.Fatalf("Expected 2 trades, but got %d", len(analysis.RecentTrades))
+	}
+	if fill := analysis.RecentTrades[1].TargetFill; fill != "early" {
+		t.Errorf("Expected a close at 80%% of the way to TP to be early, but got %q", fill)
+	}
+	if fill := analysis.RecentTrades[0].TargetFill; fill != "overshoot" {
+		t.Errorf("Expected a short closed below TP to overshoot, but got %q", fill)
+	}
+
+	if fill := classifyTargetFill("long", 110.05, 110, 10); fill != "target" {
+		t.Errorf("Expected a close within 0.1%% of TP to hit target, but got %q", fill)
+	}
+	if fill := classifyTargetFill("long", 95, 110, -5); fill != "" {
+		t.Errorf("Expected losing trades to be unclassified, but got %q", fill)
+	}
+}
+
+func TestCandidateRecordCompatibility(t *testing.T) {
+	record := DecisionRecord{
+		CandidateCoins: []CandidateRecord{
+			{Symbol: "BTCUSDT", Sources: []string{"ai500", "oi_top"}, Score: 87.5},
+			{Symbol: "SOLUSDT", Sources: []string{"oi_top"}},
+		},
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded DecisionRecord
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(decoded.CandidateCoins) != 2 {
+		t.Fatalf("Expected 2 candidates, but got %+v", decoded.CandidateCoins)
+	}
+	btc := decoded.CandidateCoins[0]
+	if btc.Symbol != "BTCUSDT" || btc.Score != 87.5 || strings.Join(btc.Sources, ",") != "ai500,oi_top" {
+		t.Errorf("Expected structured candidate to round-trip, but got %+v", btc)
+	}
+
+	// Records written before candidates were structured stored plain symbols
+	var legacy DecisionRecord
+	if err := json.Unmarshal([]byte(`{"candidate_coins": ["ETHUSDT", "DOGEUSDT"]}`), &legacy); err != nil {
+		t.Fatalf("Unmarshal of legacy record failed: %v", err)
+	}
+	if len(legacy.CandidateCoins) != 2 || legacy.CandidateCoins[1].Symbol != "DOGEUSDT" || legacy.CandidateCoins[1].Sources != nil {
+		t.Errorf("Expected legacy string candidates to load as symbols, but got %+v", legacy.CandidateCoins)
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	var records []DecisionRecord
+	for i, equity := range []float64{100, 120, 90, 110} {
+		records = append(records, DecisionRecord{
+			Timestamp:    base.Add(time.Duration(i) * 3 * time.Minute),
+			CycleNumber:  i + 1,
+			AccountState: AccountSnapshot{TotalBalance: equity},
+		})
+	}
+	logger := newTestLogger(t, records)
+
+	analysis, err := logger.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if math.Abs(analysis.MaxDrawdownPct-25) > 1e-9 {
+		t.Errorf("Expected a 25%% max drawdown from 120 to 90, but got %.4f", analysis.MaxDrawdownPct)
+	}
+	if math.Abs(analysis.MaxDrawdownUSD-30) > 1e-9 {
+		t.Errorf("Expected a 30 max drawdown, but got %.4f", analysis.MaxDrawdownUSD)
+	}
+}
+
+func TestCalmarRatio(t *testing.T) {
+	// 1000 -> 1200 -> 900 -> 1100: total return 10%, max drawdown 25% -> Calmar 0.4
+	base := time.Now().Add(-time.Hour)
+	var records []DecisionRecord
+	for i, equity := range []float64{1000, 1200, 900, 1100} {
+		records = append(records, DecisionRecord{
+			Timestamp:    base.Add(time.Duration(i) * 3 * time.Minute),
+			CycleNumber:  i + 1,
+			AccountState: AccountSnapshot{TotalBalance: equity},
+		})
+	}
+	records = append(records, roundTripRecords("BTCUSDT", "long", 100, 101, base.Add(20*time.Minute), base.Add(30*time.Minute), MarketDataSnapshot{})...)
+	records[4].AccountState.TotalBalance = 1100
+	records[5].AccountState.TotalBalance = 1100
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if math.Abs(analysis.CalmarRatio-0.4) > 1e-9 {
+		t.Errorf("Expected a Calmar ratio of 0.4, but got %.4f", analysis.CalmarRatio)
+	}
+	if insights := GenerateTradingInsights(analysis); !strings.Contains(insights, "卡玛比率仅为 0.40") {
+		t.Errorf("Expected a low-Calmar warning, but got:\n%s", insights)
+	}
+
+	rising := []equityPoint{{Equity: 1000}, {Equity: 1050}}
+	if calmar := calculateCalmarRatio(rising, 0); calmar != 999.0 {
+		t.Errorf("Expected 999 with no drawdown, but got %.4f", calmar)
+	}
+}
+
+func TestSortinoRatio(t *testing.T) {
+	// Steady gains with a couple of losing periods and one large win
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var records []*DecisionRecord
+	for i, equity := range []float64{1000, 1010, 1005, 1015, 1060, 1055, 1065} {
+		records = append(records, &DecisionRecord{
+			Timestamp:    start.Add(time.Duration(i*3) * time.Minute),
+			AccountState: AccountSnapshot{TotalBalance: equity},
+		})
+	}
+	logger := NewDecisionLogger(t.TempDir())
+
+	sharpe := logger.calculateSharpeRatio(records)
+	sortino := logger.calculateSortinoRatio(records)
+	if sharpe <= 0 {
+		t.Fatalf("Expected a positive Sharpe ratio, but got %.4f", sharpe)
+	}
+	if sortino <= sharpe {
+		t.Errorf("Expected Sortino (%.4f) to exceed Sharpe (%.4f) when upside volatility dominates", sortino, sharpe)
+	}
+
+	// No losing periods mirrors the Sharpe 999 convention
+	rising := []*DecisionRecord{
+		{Timestamp: start, AccountState: AccountSnapshot{TotalBalance: 1000}},
+		{Timestamp: start.Add(3 * time.Minute), AccountState: AccountSnapshot{TotalBalance: 1010}},
+		{Timestamp: start.Add(6 * time.Minute), AccountState: AccountSnapshot{TotalBalance: 1030}},
+	}
+	if sortino := logger.calculateSortinoRatio(rising); sortino != 999.0 {
+		t.Errorf("Expected 999 with no negative returns, but got %.4f", sortino)
+	}
+}
+
+func TestCumulativeReturns(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	var records []DecisionRecord
+	for i, equity := range []float64{1000, 1050, 980, 1100, 1150} {
+		records = append(records, DecisionRecord{
+			Timestamp:    base.Add(time.Duration(i) * 3 * time.Minute),
+			CycleNumber:  i + 1,
+			AccountState: AccountSnapshot{TotalBalance: equity},
+		})
+	}
+	logger := newTestLogger(t, records)
+
+	points := logger.CumulativeReturns(10)
+	if len(points) != 5 {
+		t.Fatalf("Expected 5 return points, but got %d", len(points))
+	}
+	if points[0].CumulativePct != 0 {
+		t.Errorf("Expected the baseline to be 0%%, but got %.4f", points[0].CumulativePct)
+	}
+	if last := points[len(points)-1].CumulativePct; math.Abs(last-15) > 1e-9 {
+		t.Errorf("Expected cumulative return to match total growth of 15%%, but got %.6f", last)
+	}
+
+	if single := cumulativeReturns([]equityPoint{{Equity: 1000}}); len(single) != 1 || single[0].CumulativePct != 0 {
+		t.Errorf("Expected a single point to yield one 0%% baseline, but got %+v", single)
+	}
+	if empty := cumulativeReturns(nil); empty != nil {
+		t.Errorf("Expected no points for an empty curve, but got %+v", empty)
+	}
+}
+
+func TestTradeFeesAndFunding(t *testing.T) {
+	base := time.Now().Add(-20 * time.Hour)
+	records := roundTripRecords("BTCUSDT", "long", 60000, 61000, base, base.Add(16*time.Hour),
+		MarketDataSnapshot{CurrentPrice: 60000, FundingRate: 0.0001})
+
+	l := newTestLogger(t, records)
+	l.SetFeeRatePct(0.05)
+	analysis, err := l.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	trade := analysis.RecentTrades[0]
+	// (60000 + 61000) × 0.05%
+	if math.Abs(trade.Fees-60.5) > 1e-9 {
+		t.Errorf("Expected fees of 60.5, but got %.4f", trade.Fees)
+	}
+	// 60000 × 0.01% × 2 settlements
+	if math.Abs(trade.FundingCost-12) > 1e-9 {
+		t.Errorf("Expected a funding cost of 12, but got %.4f", trade.FundingCost)
+	}
+	if trade.PnL != 1000 {
+		t.Errorf("Expected fees and funding to be excluded from PnL, but got %.2f", trade.PnL)
+	}
+
+	// Without a fee rate or funding data the fields are still recorded as zero
+	unconfigured, err := newTestLogger(t, roundTripRecords("BTCUSDT", "short", 60000, 59000, base, base.Add(16*time.Hour), MarketDataSnapshot{})).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	data, _ := json.Marshal(unconfigured.RecentTrades[0])
+	if !strings.Contains(string(data), `"fees":0`) || !strings.Contains(string(data), `"funding_cost":0`) {
+		t.Errorf("Expected zero fees and funding_cost in the trade record, but got %s", data)
+	}
+}
+
+func TestTopLosingSetup(t *testing.T) {
+	base := time.Now().Add(-3 * time.Hour)
+	var records []DecisionRecord
+	// Three losing shorts opened below VWAP with RSI under 40
+	for i, symbol := range []string{"BTCUSDT", "ETHUSDT", "SOLUSDT"} {
+		start := base.Add(time.Duration(i) * 20 * time.Minute)
+		records = append(records, roundTripRecords(symbol, "short", 100, 103, start, start.Add(10*time.Minute),
+			MarketDataSnapshot{CurrentPrice: 100, CurrentVWAP: 101, CurrentRSI7: 35})...)
+	}
+	// One bigger losing long above VWAP with RSI over 60, and a winner in the same pattern as the shorts
+	records = append(records, roundTripRecords("BNBUSDT", "long", 100, 90, base.Add(80*time.Minute), base.Add(90*time.Minute),
+		MarketDataSnapshot{CurrentPrice: 100, CurrentVWAP: 99, CurrentRSI7: 65})...)
+	records = append(records, roundTripRecords("XRPUSDT", "short", 100, 95, base.Add(100*time.Minute), base.Add(110*time.Minute),
+		MarketDataSnapshot{CurrentPrice: 100, CurrentVWAP: 101, CurrentRSI7: 35})...)
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	setup := analysis.TopLosingSetup()
+	if setup == nil || setup.Side != "short" || setup.VWAP != "below" || setup.RSIBand != "<40" || setup.Count != 3 {
+		t.Fatalf("Expected shorts below VWAP with RSI<40 as the top losing setup, but got %+v", setup)
+	}
+	if math.Abs(setup.TotalLoss-(-9)) > 1e-9 {
+		t.Errorf("Expected a total loss of -9, but got %.4f", setup.TotalLoss)
+	}
+
+	insights := GenerateTradingInsights(analysis)
+	if !strings.Contains(insights, "高频亏损模式: 亏损交易中最常见的是价格低于VWAP、RSI<40时开空仓（3笔") {
+		t.Errorf("Expected the top losing setup as an insight, but got %s", insights)
+	}
+	if lines := strings.Split(insights, "\n"); len(lines) < 3 || !strings.HasPrefix(lines[2], "⚠️ 高频亏损模式") {
+		t.Errorf("Expected the losing-setup insight to come first, but got %s", insights)
+	}
+}
+
+func TestGetStatisticsRange(t *testing.T) {
+	day1 := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	l := newTestLogger(t, []DecisionRecord{
+		{Timestamp: day1, Success: true, Decisions: []DecisionAction{{Action: "open_long", Symbol: "BTCUSDT", Success: true}}},
+		{Timestamp: day1.Add(6 * time.Hour), Success: false},
+		{Timestamp: day2, Success: true, Decisions: []DecisionAction{{Action: "close_long", Symbol: "BTCUSDT", Success: true}}},
+	})
+
+	from := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	stats, err := l.GetStatisticsRange(from, from.Add(24*time.Hour-time.Nanosecond))
+	if err != nil {
+		t.Fatalf("GetStatisticsRange failed: %v", err)
+	}
+	if stats.TotalCycles != 2 || stats.SuccessfulCycles != 1 || stats.FailedCycles != 1 || stats.TotalOpenPositions != 1 || stats.TotalClosePositions != 0 {
+		t.Errorf("Expected only the first day's two cycles, but got %+v", stats)
+	}
+
+	all, err := l.GetStatistics()
+	if err != nil {
+		t.Fatalf("GetStatistics failed: %v", err)
+	}
+	if all.TotalCycles != 3 || all.TotalClosePositions != 1 {
+		t.Errorf("Expected GetStatistics to cover both days, but got %+v", all)
+	}
+}
+
+func TestStrategyCloseClassification(t *testing.T) {
+	base := time.Now().Add(-5 * time.Hour)
+	entry := MarketDataSnapshot{CurrentPrice: 100, CurrentVWAP: 99}
+	// Long closed at 98, back below its entry VWAP of 99
+	records := roundTripRecords("BTCUSDT", "long", 100, 98, base, base.Add(20*time.Minute), entry)
+	// Long held for two hours and closed above VWAP
+	records = append(records, roundTripRecords("ETHUSDT", "long", 100, 101, base.Add(30*time.Minute), base.Add(150*time.Minute), entry)...)
+	// Long closed in a cycle whose AI decisions did not ask for the close
+	manual := roundTripRecords("SOLUSDT", "long", 100, 101, base.Add(160*time.Minute), base.Add(170*time.Minute), entry)
+	manual[1].DecisionJSON = `[{"symbol": "SOLUSDT", "action": "hold"}]`
+	records = append(records, manual...)
+
+	l := newTestLogger(t, records)
+	l.SetCloseClassification(true, time.Hour)
+	analysis, err := l.AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	reasons := map[string]string{}
+	for _, trade := range analysis.RecentTrades {
+		reasons[trade.Symbol] = trade.CloseReason
+	}
+	expected := map[string]string{"BTCUSDT": "vwap_reversal", "ETHUSDT": "time_stop", "SOLUSDT": "manual"}
+	for symbol, reason := range expected {
+		if reasons[symbol] != reason {
+			t.Errorf("Expected %s to close as %q, but got %q", symbol, reason, reasons[symbol])
+		}
+	}
+
+	// Disabled by default: all three stay "Strategy"
+	plain, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	for _, trade := range plain.RecentTrades {
+		if trade.CloseReason != "Strategy" {
+			t.Errorf("Expected %s to keep the Strategy reason without classification, but got %q", trade.Symbol, trade.CloseReason)
+		}
+	}
+}
+
+func TestWinLossStreaks(t *testing.T) {
+	base := time.Now().Add(-3 * time.Hour)
+	var records []DecisionRecord
+	// W-W-L-L-L
+	for i, closePrice := range []float64{110, 105, 95, 90, 98} {
+		start := base.Add(time.Duration(i) * 20 * time.Minute)
+		records = append(records, roundTripRecords("BTCUSDT", "long", 100, closePrice, start, start.Add(10*time.Minute), MarketDataSnapshot{})...)
+	}
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if analysis.CurrentStreak != -3 || analysis.MaxLossStreak != 3 || analysis.MaxWinStreak != 2 {
+		t.Errorf("Expected current -3, max loss 3 and max win 2, but got %d, %d and %d",
+			analysis.CurrentStreak, analysis.MaxLossStreak, analysis.MaxWinStreak)
+	}
+	if insights := GenerateTradingInsights(analysis); !strings.Contains(insights, "当前已连续亏损3笔") || !strings.Contains(insights, "降低后续开仓的仓位") {
+		t.Errorf("Expected a losing-streak insight suggesting smaller size, but got %s", insights)
+	}
+
+	// A break-even trade resets the current streak
+	if current, _, maxLoss := calculateStreaks([]TradeOutcome{{PnL: -1}, {PnL: -2}, {PnL: 0}}, 0); current != 0 || maxLoss != 2 {
+		t.Errorf("Expected a tie to reset the streak, but got current %d and max loss %d", current, maxLoss)
+	}
+}
+
+func TestHoldingDurations(t *testing.T) {
+	// Same fixture as TestAnalyzePerformance: BTC long wins after 30 minutes, ETH short loses after 10 minutes
+	base := time.Now().Add(-1 * time.Hour)
+	records := roundTripRecords("BTCUSDT", "long", 60100, 61000, base, base.Add(30*time.Minute), MarketDataSnapshot{})
+	records = append(records, roundTripRecords("ETHUSDT", "short", 3020, 3050, base.Add(40*time.Minute), base.Add(50*time.Minute), MarketDataSnapshot{})...)
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if analysis.AvgWinnerMinutes != 30 || analysis.AvgLoserMinutes != 10 || analysis.AvgHoldingMinutes != 20 {
+		t.Errorf("Expected winner 30, loser 10 and overall 20 minutes, but got %.2f, %.2f and %.2f",
+			analysis.AvgWinnerMinutes, analysis.AvgLoserMinutes, analysis.AvgHoldingMinutes)
+	}
+	if insights := GenerateTradingInsights(analysis); strings.Contains(insights, "处置效应") {
+		t.Errorf("Expected no disposition warning when winners are held longer, but got %s", insights)
+	}
+
+	// Losers held three times as long as winners trigger the warning
+	analysis.AvgWinnerMinutes, analysis.AvgLoserMinutes = 10, 30
+	if insights := GenerateTradingInsights(analysis); !strings.Contains(insights, "处置效应") {
+		t.Errorf("Expected a disposition-effect warning, but got %s", insights)
+	}
+}
+
+func TestPartialCloses(t *testing.T) {
+	base := time.Now().Add(-1 * time.Hour)
+	records := []DecisionRecord{
+		{
+			Timestamp: base,
+			Decisions: []DecisionAction{{Action: "open_long", Symbol: "BTCUSDT", Quantity: 2, Leverage: 10, Price: 100, Timestamp: base, Success: true}},
+		},
+		{
+			Timestamp: base.Add(10 * time.Minute),
+			Decisions: []DecisionAction{{Action: "close_long", Symbol: "BTCUSDT", Price: 110, ClosePercent: 50, Timestamp: base.Add(10 * time.Minute), Success: true}},
+		},
+		{
+			Timestamp: base.Add(20 * time.Minute),
+			Decisions: []DecisionAction{{Action: "close_long", Symbol: "BTCUSDT", Price: 120, Timestamp: base.Add(20 * time.Minute), Success: true}},
+		},
+	}
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if analysis.TotalTrades != 2 || len(analysis.RecentTrades) != 2 || len(analysis.UnclosedPositions) != 0 {
+		t.Fatalf("Expected two outcomes and no unclosed position, but got %d trades and unclosed %v", analysis.TotalTrades, analysis.UnclosedPositions)
+	}
+
+	// Newest first: the remaining half closed at 120, then the first half at 110
+	rest, first := analysis.RecentTrades[0], analysis.RecentTrades[1]
+	if first.Quantity != 1 || first.PnL != 10 {
+		t.Errorf("Expected the 50%% close to settle 1 unit for 10, but got %.2f units for %.2f", first.Quantity, first.PnL)
+	}
+	if rest.Quantity != 1 || rest.PnL != 20 {
+		t.Errorf("Expected the final close to settle the remaining 1 unit for 20, but got %.2f units for %.2f", rest.Quantity, rest.PnL)
+	}
+}
+
+func TestActionChurn(t *testing.T) {
+	base := time.Now().Add(-1 * time.Hour)
+	// BTC: open, close on the next cycle, reopen long on the cycle after
+	records := roundTripRecords("BTCUSDT", "long", 100, 99, base, base.Add(3*time.Minute), MarketDataSnapshot{})
+	records = append(records, roundTripRecords("BTCUSDT", "long", 99, 101, base.Add(6*time.Minute), base.Add(30*time.Minute), MarketDataSnapshot{})...)
+	for i := range records {
+		records[i].CycleNumber = i + 1
+	}
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	expected := ActionChurn{Symbol: "BTCUSDT", Side: "long", OpenCycle: 1, CloseCycle: 2, ReopenCycle: 3}
+	if len(analysis.ActionChurn) != 1 || analysis.ActionChurn[0] != expected {
+		t.Fatalf("Expected a single churn %+v, but got %+v", expected, analysis.ActionChurn)
+	}
+	insights := GenerateTradingInsights(analysis)
+	if !strings.HasPrefix(insights, "\n# 📈 复盘纪要与进化建议\n🚨 反复开平[BTCUSDT long]: 周期#1开仓、#2平仓、#3又同向开仓") {
+		t.Errorf("Expected the churn insight to be listed first, but got %s", insights)
+	}
+
+	// A reopen after a long pause is not churn
+	if churns := detectActionChurn([]*DecisionRecord{&records[0], &records[1], {}, {}, &records[2]}); len(churns) != 0 {
+		t.Errorf("Expected no churn when the reopen comes much later, but got %+v", churns)
+	}
+}
+
+func TestTimeInMarket(t *testing.T) {
+	base := time.Now().Add(-2 * time.Hour)
+	// BTC held 0-40 min and ETH held 20-60 min overlap; the window runs to a final record at 100 min
+	records := roundTripRecords("BTCUSDT", "long", 100, 101, base, base.Add(40*time.Minute), MarketDataSnapshot{})
+	eth := roundTripRecords("ETHUSDT", "short", 200, 199, base.Add(20*time.Minute), base.Add(60*time.Minute), MarketDataSnapshot{})
+	records = []DecisionRecord{records[0], eth[0], records[1], eth[1], {Timestamp: base.Add(100 * time.Minute)}}
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	if math.Abs(analysis.TimeInMarketPct-60) > 1e-9 {
+		t.Errorf("Expected 60%% time in market without double counting the overlap, but got %.4f", analysis.TimeInMarketPct)
+	}
+}
+
+func TestCoTTruncation(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir())
+	l.SetMaxCoTChars(500, true)
+
+	long := strings.Repeat("a", 5000) + strings.Repeat("z", 5000)
+	if err := l.LogDecision(&DecisionRecord{Success: true, CoTTrace: long, DecisionJSON: `[{"symbol":"BTCUSDT","action":"wait"}]`}); err != nil {
+		t.Fatalf("LogDecision failed: %v", err)
+	}
+	if err := l.LogDecision(&DecisionRecord{Success: true, CoTTrace: "short trace"}); err != nil {
+		t.Fatalf("LogDecision failed: %v", err)
+	}
+	if err := l.LogDecision(&DecisionRecord{Success: false, CoTTrace: long}); err != nil {
+		t.Fatalf("LogDecision failed: %v", err)
+	}
+
+	records, err := l.GetLatestRecords(3)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("Expected 3 records, but got %d (err: %v)", len(records), err)
+	}
+
+	truncated := records[0].CoTTrace
+	if n := len([]rune(truncated)); n != 500 {
+		t.Errorf("Expected the 10k-char trace to be truncated to 500 chars, but got %d", n)
+	}
+	if !strings.HasPrefix(truncated, "aaa") || !strings.HasSuffix(truncated, "zzz") || !strings.Contains(truncated, "…[truncated 9") {
+		t.Errorf("Expected a head+tail excerpt with a truncation marker, but got %q", truncated)
+	}
+	if records[0].DecisionJSON != `[{"symbol":"BTCUSDT","action":"wait"}]` {
+		t.Errorf("Expected the decision JSON to be kept in full, but got %q", records[0].DecisionJSON)
+	}
+	if records[1].CoTTrace != "short trace" {
+		t.Errorf("Expected a short trace to be untouched, but got %q", records[1].CoTTrace)
+	}
+	if records[2].CoTTrace != long {
+		t.Errorf("Expected the failed cycle to keep its full trace, but got %d chars", len([]rune(records[2].CoTTrace)))
+	}
 }
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DecisionNotifier 决策通知：每条决策记录保存成功后调用（如推送到Telegram/Discord）
+type DecisionNotifier interface {
+	OnDecision(record *DecisionRecord) error
+}
+
+// WebhookNotifier 将决策摘要以JSON POST到指定URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookNotifier 创建Webhook通知器（10秒超时）
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// webhookAction 通知中的单个执行动作
+type webhookAction struct {
+	Action  string  `json:"action"`
+	Symbol  string  `json:"symbol"`
+	Side    string  `json:"side"`
+	Price   float64 `json:"price"`
+	Success bool    `json:"success"`
+}
+
+// webhookPayload 决策通知的精简摘要
+type webhookPayload struct {
+	Cycle     int             `json:"cycle"`
+	Timestamp time.Time       `json:"timestamp"`
+	Success   bool            `json:"success"`
+	Actions   []webhookAction `json:"actions"`
+}
+
+// OnDecision 发送决策摘要（周期、时间、各动作的币种/方向/价格、是否成功）
+func (n *WebhookNotifier) OnDecision(record *DecisionRecord) error {
+	payload := webhookPayload{
+		Cycle:     record.CycleNumber,
+		Timestamp: record.Timestamp,
+		Success:   record.Success,
+		Actions:   []webhookAction{},
+	}
+	for _, action := range record.Decisions {
+		payload.Actions = append(payload.Actions, webhookAction{
+			Action:  action.Action,
+			Symbol:  action.Symbol,
+			Side:    getSideFromAction(action.Action),
+			Price:   action.Price,
+			Success: action.Success,
+		})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化决策通知失败: %w", err)
+	}
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("发送决策通知失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("决策通知返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
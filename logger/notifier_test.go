@@ -0,0 +1,162 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingNotifier always returns an error
+type failingNotifier struct{ calls int }
+
+func (n *failingNotifier) OnDecision(*DecisionRecord) error {
+	n.calls++
+	return errors.New("unreachable")
+}
+
+func TestWebhookNotifierPostsActions(t *testing.T) {
+	var payload webhookPayload
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON POST, but got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Expected a JSON body, but got %s", body)
+		}
+	}))
+	defer server.Close()
+
+	l := NewDecisionLogger(t.TempDir())
+	failing := &failingNotifier{}
+	l.SetNotifiers([]DecisionNotifier{failing, NewWebhookNotifier(server.URL)})
+
+	record := &DecisionRecord{
+		Success: true,
+		Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Price: 60000, Success: true},
+			{Action: "close_short", Symbol: "ETHUSDT", Price: 3000, Success: false},
+		},
+	}
+	if err := l.LogDecision(record); err != nil {
+		t.Fatalf("Expected a notifier failure not to fail LogDecision, but got %v", err)
+	}
+	if !l.FlushNotifications(2 * time.Second) {
+		t.Fatal("Expected queued notifications to flush")
+	}
+
+	if failing.calls != 1 || requests != 1 {
+		t.Fatalf("Expected every notifier to be called once, but got %d failing calls and %d webhook requests", failing.calls, requests)
+	}
+	if payload.Cycle != 1 || !payload.Success || payload.Timestamp.IsZero() {
+		t.Errorf("Expected cycle 1 with a timestamp and success, but got %+v", payload)
+	}
+	expected := []webhookAction{
+		{Action: "open_long", Symbol: "BTCUSDT", Side: "long", Price: 60000, Success: true},
+		{Action: "close_short", Symbol: "ETHUSDT", Side: "short", Price: 3000, Success: false},
+	}
+	if len(payload.Actions) != len(expected) {
+		t.Fatalf("Expected %d actions, but got %+v", len(expected), payload.Actions)
+	}
+	for i, action := range expected {
+		if payload.Actions[i] != action {
+			t.Errorf("Expected action %d to be %+v, but got %+v", i, action, payload.Actions[i])
+		}
+	}
+}
+
+// blockingNotifier waits until released, like a webhook endpoint that never answers
+type blockingNotifier struct{ release chan struct{} }
+
+func (n *blockingNotifier) OnDecision(*DecisionRecord) error {
+	<-n.release
+	return nil
+}
+
+func TestSlowNotifierDoesNotBlockLogDecision(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir())
+	blocking := &blockingNotifier{release: make(chan struct{})}
+	l.SetNotifiers([]DecisionNotifier{blocking})
+
+	record := &DecisionRecord{
+		Success:   true,
+		Decisions: []DecisionAction{{Action: "open_long", Symbol: "BTCUSDT", Success: true}},
+	}
+	done := make(chan error, 1)
+	go func() { done <- l.LogDecision(record) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("LogDecision failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected LogDecision to return while the notifier is still sending")
+	}
+
+	// The flush gives up at its deadline instead of hanging on the notifier
+	if l.FlushNotifications(50 * time.Millisecond) {
+		t.Error("Expected the flush to time out while the notifier is blocked")
+	}
+
+	close(blocking.release)
+	if !l.FlushNotifications(2 * time.Second) {
+		t.Error("Expected the flush to finish once the notifier is released")
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+// countingNotifier counts the records it receives
+type countingNotifier struct{ calls int }
+
+func (n *countingNotifier) OnDecision(*DecisionRecord) error {
+	n.calls++
+	return nil
+}
+
+func TestNotifiersSkipCyclesWithoutExecutedTrades(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir())
+	counting := &countingNotifier{}
+	l.SetNotifiers([]DecisionNotifier{counting})
+
+	records := []*DecisionRecord{
+		// Risk pause / context failure: nothing executed
+		{Success: false, ErrorMessage: "风控暂停"},
+		// Hold-only cycle
+		{Success: true, Decisions: []DecisionAction{{Action: "hold", Symbol: "BTCUSDT", Success: true}}},
+		// Failed order
+		{Success: true, Decisions: []DecisionAction{{Action: "open_long", Symbol: "BTCUSDT", Success: false}}},
+		// Executed close
+		{Success: true, Decisions: []DecisionAction{{Action: "close_long", Symbol: "BTCUSDT", Success: true}}},
+	}
+	for _, record := range records {
+		if err := l.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision failed: %v", err)
+		}
+	}
+	if !l.FlushNotifications(2 * time.Second) {
+		t.Fatal("Expected queued notifications to flush")
+	}
+	if counting.calls != 1 {
+		t.Errorf("Expected only the executed close to be notified, but got %d notifications", counting.calls)
+	}
+
+	// After Close new records are saved but not notified
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := l.LogDecision(records[3]); err != nil {
+		t.Fatalf("LogDecision after Close failed: %v", err)
+	}
+	l.FlushNotifications(2 * time.Second)
+	if counting.calls != 1 {
+		t.Errorf("Expected no notifications after Close, but got %d", counting.calls)
+	}
+}
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	reportInsightLimit = 3 // 报告中保留的洞察条数
+	reportTradeLimit   = 5 // 报告中列出的最近交易笔数
+)
+
+// PerformanceReport 交易表现报告：PerformanceAnalysis的扁平化展示版本，
+// 供Web界面和通知直接展示或序列化，字段保持稳定
+type PerformanceReport struct {
+	BaseCurrency string `json:"base_currency"` // 计价货币
+
+	// 核心指标
+	TotalTrades    int     `json:"total_trades"`     // 总交易数
+	WinRate        float64 `json:"win_rate"`         // 胜率（%）
+	TotalPnL       float64 `json:"total_pnl"`        // 已平仓交易的总盈亏
+	ProfitFactor   float64 `json:"profit_factor"`    // 盈亏比（999表示无亏损）
+	SharpeRatio    float64 `json:"sharpe_ratio"`     // 夏普比率
+	MaxDrawdownPct float64 `json:"max_drawdown_pct"` // 最大回撤（%）
+
+	// 最好/最差币种及其总盈亏
+	BestSymbol     string  `json:"best_symbol"`
+	BestSymbolPnL  float64 `json:"best_symbol_pnl"`
+	WorstSymbol    string  `json:"worst_symbol"`
+	WorstSymbolPnL float64 `json:"worst_symbol_pnl"`
+
+	TopInsights  []string `json:"top_insights"`  // 最重要的几条复盘洞察
+	RecentTrades []string `json:"recent_trades"` // 最近交易摘要（最新在前），如 "BTCUSDT long +900.00 USDT (TP)"
+}
+
+// Report 生成交易表现报告
+func (a *PerformanceAnalysis) Report() PerformanceReport {
+	report := PerformanceReport{
+		BaseCurrency:   a.BaseCurrency,
+		TotalTrades:    a.TotalTrades,
+		WinRate:        a.WinRate,
+		ProfitFactor:   a.ProfitFactor,
+		SharpeRatio:    a.SharpeRatio,
+		MaxDrawdownPct: a.MaxDrawdownPct,
+		BestSymbol:     a.BestSymbol,
+		WorstSymbol:    a.WorstSymbol,
+		TopInsights:    []string{},
+		RecentTrades:   []string{},
+	}
+
+	for _, stats := range a.SymbolStats {
+		report.TotalPnL += stats.TotalPnL
+	}
+	if stats, ok := a.SymbolStats[a.BestSymbol]; ok {
+		report.BestSymbolPnL = stats.TotalPnL
+	}
+	if stats, ok := a.SymbolStats[a.WorstSymbol]; ok {
+		report.WorstSymbolPnL = stats.TotalPnL
+	}
+
+	// 洞察文本按行拆分，去掉标题行
+	if len(a.RecentTrades) > 0 {
+		for _, line := range strings.Split(GenerateTradingInsights(a), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if len(report.TopInsights) == reportInsightLimit {
+				break
+			}
+			report.TopInsights = append(report.TopInsights, line)
+		}
+	}
+
+	for i, trade := range a.RecentTrades {
+		if i == reportTradeLimit {
+			break
+		}
+		report.RecentTrades = append(report.RecentTrades, fmt.Sprintf("%s %s %+.2f %s (%s)",
+			trade.Symbol, trade.Side, trade.PnL, a.BaseCurrency, trade.CloseReason))
+	}
+
+	return report
+}
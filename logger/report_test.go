@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPerformanceReport(t *testing.T) {
+	// Same fixture as TestAnalyzePerformance: winning BTC long, losing ETH short
+	base := time.Now().Add(-1 * time.Hour)
+	records := roundTripRecords("BTCUSDT", "long", 60100, 61000, base, base.Add(30*time.Minute),
+		MarketDataSnapshot{CurrentPrice: 60100, CurrentVWAP: 60000, CurrentRSI7: 55, CurrentMACD: 10})
+	records = append(records, roundTripRecords("ETHUSDT", "short", 3020, 3050, base.Add(40*time.Minute), base.Add(50*time.Minute),
+		MarketDataSnapshot{CurrentPrice: 3020, CurrentVWAP: 3010, CurrentRSI7: 45, CurrentMACD: -5})...)
+
+	analysis, err := newTestLogger(t, records).AnalyzePerformance(10)
+	if err != nil {
+		t.Fatalf("AnalyzePerformance failed: %v", err)
+	}
+	report := analysis.Report()
+
+	if report.TotalTrades != 2 || report.WinRate != 50 || report.BaseCurrency != "USDT" {
+		t.Errorf("Expected 2 trades at a 50%% win rate in USDT, but got %+v", report)
+	}
+	if math.Abs(report.TotalPnL-870) > 1e-9 {
+		t.Errorf("Expected a total PnL of 870, but got %.4f", report.TotalPnL)
+	}
+	if report.BestSymbol != "BTCUSDT" || math.Abs(report.BestSymbolPnL-900) > 1e-9 {
+		t.Errorf("Expected BTCUSDT as the best symbol with 900, but got %s %.2f", report.BestSymbol, report.BestSymbolPnL)
+	}
+	if report.WorstSymbol != "ETHUSDT" || math.Abs(report.WorstSymbolPnL+30) > 1e-9 {
+		t.Errorf("Expected ETHUSDT as the worst symbol with -30, but got %s %.2f", report.WorstSymbol, report.WorstSymbolPnL)
+	}
+
+	expectedTrades := []string{"ETHUSDT short -30.00 USDT (Strategy)", "BTCUSDT long +900.00 USDT (Strategy)"}
+	if len(report.RecentTrades) != 2 || report.RecentTrades[0] != expectedTrades[0] || report.RecentTrades[1] != expectedTrades[1] {
+		t.Errorf("Expected recent trades %v, but got %v", expectedTrades, report.RecentTrades)
+	}
+	if len(report.TopInsights) == 0 || len(report.TopInsights) > reportInsightLimit {
+		t.Errorf("Expected between 1 and %d insights, but got %v", reportInsightLimit, report.TopInsights)
+	}
+
+	// The report round-trips through JSON unchanged
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded PerformanceReport
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.BestSymbol != report.BestSymbol || len(decoded.RecentTrades) != 2 {
+		t.Errorf("Expected the report to round-trip through JSON, but got %+v (err: %v)", decoded, err)
+	}
+}
@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteDecisionStore 基于单个SQLite数据库文件的决策记录存储
+// 周期很多时每周期一个JSON文件会让目录非常庞大，读取最近记录需要扫描整个目录；
+// SQLite存储每条记录一次INSERT，按自增ID查询最近记录。分析、统计等方法与文件日志完全相同
+type SQLiteDecisionStore struct {
+	*DecisionLogger
+	db *sql.DB
+}
+
+// NewSQLiteDecisionStore 打开（不存在时创建）SQLite决策记录存储
+func NewSQLiteDecisionStore(dbPath string) (*SQLiteDecisionStore, error) {
+	if dbPath == "" {
+		dbPath = "decision_logs.db"
+	}
+	if dir := filepath.Dir(dbPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开决策数据库失败: %w", err)
+	}
+	db.SetMaxOpenConns(1) // SQLite单写者，避免并发写入时的锁冲突
+
+	schema := `
+CREATE TABLE IF NOT EXISTS decision_records (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	cycle_number INTEGER NOT NULL,
+	timestamp    INTEGER NOT NULL,
+	date         TEXT    NOT NULL,
+	data         TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_decision_records_date ON decision_records(date);
+CREATE INDEX IF NOT EXISTS idx_decision_records_timestamp ON decision_records(timestamp);`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化决策数据库失败: %w", err)
+	}
+
+	return &SQLiteDecisionStore{
+		DecisionLogger: &DecisionLogger{
+			baseCurrency: "USDT",
+			store:        sqliteRecordStore{db: db},
+		},
+		db: db,
+	}, nil
+}
+
+// Close 关闭数据库连接
+func (s *SQLiteDecisionStore) Close() error {
+	if err := s.DecisionLogger.Close(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// sqliteRecordStore 以SQLite表存储决策记录（每条记录保存完整JSON）
+type sqliteRecordStore struct {
+	db *sql.DB
+}
+
+func (s sqliteRecordStore) save(record *DecisionRecord, data []byte) error {
+	_, err := s.db.Exec(
+		"INSERT INTO decision_records (cycle_number, timestamp, date, data) VALUES (?, ?, ?, ?)",
+		record.CycleNumber, record.Timestamp.UnixNano(), record.Timestamp.Format("20060102"), string(data))
+	if err != nil {
+		return fmt.Errorf("写入决策记录失败: %w", err)
+	}
+	return nil
+}
+
+func (s sqliteRecordStore) latest(n int) ([]*DecisionRecord, error) {
+	records, err := s.query("SELECT data FROM decision_records ORDER BY id DESC LIMIT ?", n)
+	if err != nil {
+		return nil, err
+	}
+
+	// 反转数组，让时间从旧到新排列（与文件日志一致）
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+func (s sqliteRecordStore) byDate(date time.Time) ([]*DecisionRecord, error) {
+	return s.query("SELECT data FROM decision_records WHERE date = ? ORDER BY id", date.Format("20060102"))
+}
+
+func (s sqliteRecordStore) all() ([]*DecisionRecord, error) {
+	return s.query("SELECT data FROM decision_records ORDER BY id")
+}
+
+func (s sqliteRecordStore) deleteBefore(cutoff time.Time) (int, error) {
+	result, err := s.db.Exec("DELETE FROM decision_records WHERE timestamp < ?", cutoff.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+// query 执行查询并解析每行的JSON记录（与文件日志一致，无法解析的记录跳过）
+func (s sqliteRecordStore) query(query string, args ...interface{}) ([]*DecisionRecord, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询决策记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*DecisionRecord
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("读取决策记录失败: %w", err)
+		}
+		var record DecisionRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
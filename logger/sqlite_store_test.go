@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteDecisionStoreLatestRecords(t *testing.T) {
+	store, err := NewSQLiteDecisionStore(filepath.Join(t.TempDir(), "decisions.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteDecisionStore failed: %v", err)
+	}
+	defer store.Close()
+
+	var _ DecisionStore = store
+	var _ DecisionStore = NewDecisionLogger(t.TempDir())
+
+	for i := 0; i < 5; i++ {
+		record := &DecisionRecord{
+			AccountState: AccountSnapshot{TotalBalance: 1000 + float64(i)},
+			Success:      i != 2,
+		}
+		if err := store.LogDecision(record); err != nil {
+			t.Fatalf("LogDecision failed: %v", err)
+		}
+	}
+
+	records, err := store.GetLatestRecords(2)
+	if err != nil {
+		t.Fatalf("GetLatestRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, but got %d", len(records))
+	}
+	if records[0].CycleNumber != 4 || records[1].CycleNumber != 5 {
+		t.Errorf("Expected the two newest cycles in chronological order (4, 5), but got (%d, %d)",
+			records[0].CycleNumber, records[1].CycleNumber)
+	}
+	if records[1].AccountState.TotalBalance != 1004 {
+		t.Errorf("Expected the newest record to round-trip its account state, but got %.2f", records[1].AccountState.TotalBalance)
+	}
+
+	today, err := store.GetRecordByDate(time.Now())
+	if err != nil || len(today) != 5 {
+		t.Errorf("Expected 5 records for today, but got %d (err: %v)", len(today), err)
+	}
+
+	stats, err := store.GetStatistics()
+	if err != nil {
+		t.Fatalf("GetStatistics failed: %v", err)
+	}
+	if stats.TotalCycles != 5 || stats.SuccessfulCycles != 4 || stats.FailedCycles != 1 {
+		t.Errorf("Expected 5 cycles with 1 failure, but got %+v", stats)
+	}
+}
+
+func TestSQLiteDecisionStoreCompactDataAndClose(t *testing.T) {
+	store, err := NewSQLiteDecisionStore(filepath.Join(t.TempDir(), "decisions.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteDecisionStore failed: %v", err)
+	}
+
+	if err := store.LogDecision(&DecisionRecord{Success: true}); err != nil {
+		t.Fatalf("LogDecision failed: %v", err)
+	}
+
+	var data string
+	if err := store.db.QueryRow("SELECT data FROM decision_records").Scan(&data); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if strings.Contains(data, "\n") {
+		t.Errorf("Expected compact JSON in the data column, but got %q", data)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := store.GetLatestRecords(1); err == nil {
+		t.Errorf("Expected queries to fail after Close")
+	}
+}
@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// StopTargetPolicy 假设的止损止盈策略：以原止损/止盈距离的倍数表示（如StopMultiple=2表示止损放宽一倍）
+// 倍数<=0表示沿用原距离；原决策没有止损或止盈时该侧不模拟
+type StopTargetPolicy struct {
+	StopMultiple   float64 `json:"stop_multiple"`
+	TargetMultiple float64 `json:"target_multiple"`
+}
+
+// WhatIfResult 按假设策略重算历史交易的结果
+type WhatIfResult struct {
+	Trades          int     `json:"trades"`            // 参与模拟的交易数
+	WinningTrades   int     `json:"winning_trades"`    // 假设策略下的盈利交易数
+	WinRate         float64 `json:"win_rate"`          // 假设策略下的胜率（%）
+	TotalPnL        float64 `json:"total_pnl"`         // 假设策略下的总盈亏
+	OriginalWinRate float64 `json:"original_win_rate"` // 实际胜率（%，同一批交易）
+	OriginalPnL     float64 `json:"original_pnl"`      // 实际总盈亏（同一批交易）
+	Unresolved      int     `json:"unresolved"`        // 行情路径结束时仍未触发止损止盈的交易数（按最后价格估值）
+}
+
+// pricePoint 行情路径上的一个价格
+type pricePoint struct {
+	time  time.Time
+	price float64
+}
+
+// SimulateStopTarget 按假设的止损止盈策略重算最近交易的结果（what-if分析）
+// 每笔交易沿开仓后各周期的行情快照价格（含原平仓价）逐点检查是否触发新的止损/止盈，触发时按止损/止盈价成交；
+// 原平仓是主动平仓（非TP/SL）且未先触发新的止损止盈时，按原平仓价结束；原平仓由止损/止盈触发时继续沿后续行情模拟。
+// 需要记录中有中间行情快照，否则结果只能基于原平仓价
+func (l *DecisionLogger) SimulateStopTarget(lookbackCycles int, policy StopTargetPolicy) (*WhatIfResult, error) {
+	analysis, err := l.AnalyzePerformance(lookbackCycles)
+	if err != nil {
+		return nil, err
+	}
+	records, err := l.GetLatestRecords(lookbackCycles * 5)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %w", err)
+	}
+
+	result := &WhatIfResult{}
+	originalWins := 0
+	for _, trade := range analysis.RecentTrades {
+		var path []pricePoint
+		for _, record := range records {
+			if !record.Timestamp.After(trade.OpenTime) {
+				continue
+			}
+			if price := record.MarketData[trade.Symbol].CurrentPrice; price > 0 {
+				path = append(path, pricePoint{time: record.Timestamp, price: price})
+			}
+		}
+		path = append(path, pricePoint{time: trade.CloseTime, price: trade.ClosePrice})
+		sort.SliceStable(path, func(i, j int) bool { return path[i].time.Before(path[j].time) })
+
+		exit, resolved := simulateExit(trade, path, policy)
+		pnl := trade.Quantity * (exit - trade.OpenPrice)
+		if trade.Side == "short" {
+			pnl = -pnl
+		}
+
+		result.Trades++
+		result.TotalPnL += pnl
+		result.OriginalPnL += trade.PnL
+		if pnl > 0 {
+			result.WinningTrades++
+		}
+		if trade.PnL > 0 {
+			originalWins++
+		}
+		if !resolved {
+			result.Unresolved++
+		}
+	}
+
+	if result.Trades > 0 {
+		result.WinRate = float64(result.WinningTrades) / float64(result.Trades) * 100
+		result.OriginalWinRate = float64(originalWins) / float64(result.Trades) * 100
+	}
+	return result, nil
+}
+
+// simulateExit 沿行情路径返回假设策略下的平仓价；路径结束仍未平仓时返回最后价格和false
+func simulateExit(trade TradeOutcome, path []pricePoint, policy StopTargetPolicy) (float64, bool) {
+	stopMultiple, targetMultiple := policy.StopMultiple, policy.TargetMultiple
+	if stopMultiple <= 0 {
+		stopMultiple = 1
+	}
+	if targetMultiple <= 0 {
+		targetMultiple = 1
+	}
+
+	// direction: 做多为1，做空为-1；止损止盈价按原距离的倍数重新计算
+	direction := 1.0
+	if trade.Side == "short" {
+		direction = -1
+	}
+	var stop, target float64
+	if trade.StopLoss > 0 {
+		stop = trade.OpenPrice - direction*math.Abs(trade.OpenPrice-trade.StopLoss)*stopMultiple
+	}
+	if trade.TakeProfit > 0 {
+		target = trade.OpenPrice + direction*math.Abs(trade.TakeProfit-trade.OpenPrice)*targetMultiple
+	}
+	discretionary := trade.CloseReason != "SL" && trade.CloseReason != "TP"
+
+	last := trade.ClosePrice
+	for _, point := range path {
+		last = point.price
+		if stop > 0 && (point.price-stop)*direction <= 0 {
+			return stop, true
+		}
+		if target > 0 && (point.price-target)*direction >= 0 {
+			return target, true
+		}
+		if discretionary && !point.time.Before(trade.CloseTime) {
+			return trade.ClosePrice, true
+		}
+	}
+	return last, false
+}
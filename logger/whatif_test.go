@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSimulateStopTargetWiderStop(t *testing.T) {
+	base := time.Now().Add(-1 * time.Hour)
+	snapshot := func(offset time.Duration, price float64) DecisionRecord {
+		return DecisionRecord{
+			Timestamp:  base.Add(offset),
+			MarketData: map[string]MarketDataSnapshot{"BTCUSDT": {CurrentPrice: price}},
+		}
+	}
+
+	// Long at 100 with SL 95 / TP 110: stopped out at 95, then price dips to 93 and rallies to 111
+	records := []DecisionRecord{
+		{
+			Timestamp:    base,
+			DecisionJSON: `[{"symbol":"BTCUSDT","action":"open_long","stop_loss":95,"take_profit":110}]`,
+			Decisions: []DecisionAction{
+				{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 10, Price: 100, Timestamp: base, Success: true},
+			},
+			MarketData: map[string]MarketDataSnapshot{"BTCUSDT": {CurrentPrice: 100}},
+		},
+		snapshot(5*time.Minute, 97),
+		{
+			Timestamp: base.Add(10 * time.Minute),
+			Decisions: []DecisionAction{
+				{Action: "close_long", Symbol: "BTCUSDT", Quantity: 1, Price: 95, Timestamp: base.Add(10 * time.Minute), Success: true},
+			},
+		},
+		snapshot(15*time.Minute, 93),
+		snapshot(20*time.Minute, 100),
+		snapshot(25*time.Minute, 111),
+	}
+	l := newTestLogger(t, records)
+
+	// Original policy replays the actual stop-out
+	result, err := l.SimulateStopTarget(10, StopTargetPolicy{})
+	if err != nil {
+		t.Fatalf("SimulateStopTarget failed: %v", err)
+	}
+	if result.Trades != 1 || result.WinningTrades != 0 || math.Abs(result.TotalPnL+5) > 1e-9 {
+		t.Errorf("Expected the original policy to reproduce the -5 stop-out, but got %+v", result)
+	}
+
+	// Doubling the stop distance (SL 90) survives the dip to 93 and reaches TP 110
+	result, err = l.SimulateStopTarget(10, StopTargetPolicy{StopMultiple: 2})
+	if err != nil {
+		t.Fatalf("SimulateStopTarget failed: %v", err)
+	}
+	if result.Trades != 1 || result.WinningTrades != 1 || result.WinRate != 100 || result.Unresolved != 0 {
+		t.Errorf("Expected the wider stop to turn the trade into a resolved winner, but got %+v", result)
+	}
+	if math.Abs(result.TotalPnL-10) > 1e-9 {
+		t.Errorf("Expected a simulated PnL of 10, but got %.4f", result.TotalPnL)
+	}
+	if result.OriginalWinRate != 0 || math.Abs(result.OriginalPnL+5) > 1e-9 {
+		t.Errorf("Expected the original 0%% win rate and -5 PnL, but got %.2f%% and %.4f", result.OriginalWinRate, result.OriginalPnL)
+	}
+}
@@ -53,12 +53,87 @@ func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string,
 		CustomAPIKey:          cfg.CustomAPIKey,
 		CustomModelName:       cfg.CustomModelName,
 		ScanInterval:          cfg.GetScanInterval(),
+		MinCycleInterval:      time.Duration(cfg.MinCycleIntervalSeconds) * time.Second,
 		InitialBalance:        cfg.InitialBalance,
 		BTCETHLeverage:        leverage.BTCETHLeverage,  // 使用配置的杠杆倍数
 		AltcoinLeverage:       leverage.AltcoinLeverage, // 使用配置的杠杆倍数
 		MaxDailyLoss:          maxDailyLoss,
 		MaxDrawdown:           maxDrawdown,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
+
+		DefaultBTCETHLeverage:  leverage.DefaultBTCETHLeverage,
+		DefaultAltcoinLeverage: leverage.DefaultAltcoinLeverage,
+		AllowedLeverage:        leverage.AllowedLeverage,
+		MaxLeverageBySymbol:    leverage.MaxLeverageBySymbol,
+		DeRiskDrawdownPct:      leverage.DeRiskDrawdownPct,
+
+		IncludeLiquidationDistance: cfg.IncludeLiquidationDistance,
+		IncludeMarketDataAge:       cfg.IncludeMarketDataAge,
+		MaxPortfolioHeatPct:        cfg.MaxPortfolioHeatPct,
+		MaxSymbolConcentrationPct:  cfg.MaxSymbolConcentrationPct,
+		SymbolConcentrationPolicy:  cfg.SymbolConcentrationPolicy,
+		UnheldHoldPolicy:           cfg.UnheldHoldPolicy,
+		EmptyReasoningPolicy:       cfg.EmptyReasoningPolicy,
+		SizeRiskTolerancePct:       cfg.SizeRiskTolerancePct,
+		SizeRiskPolicy:             cfg.SizeRiskPolicy,
+		EnforceRiskUSD:             cfg.EnforceRiskUSD,
+		RiskUSDTolerancePct:        cfg.RiskUSDTolerancePct,
+		ValidationConcurrency:      cfg.ValidationConcurrency,
+		IncludeSymbolStats:         cfg.IncludeSymbolStats,
+		MaxFetchCandidates:         cfg.MaxFetchCandidates,
+		MaxPromptCandidates:        cfg.MaxPromptCandidates,
+		RequiredIndicators:         cfg.RequiredIndicators,
+		MaxMarginUsedPct:           cfg.MaxMarginUsedPct,
+		MaxDailyReentries:          cfg.MaxDailyReentries,
+		MinSharpeRatio:             cfg.MinSharpeRatio,
+		FeeRatePct:                 cfg.FeeRatePct,
+		MinTPFeeMultiple:           cfg.MinTPFeeMultiple,
+		MinRiskReward:              cfg.MinRiskReward,
+		MinRiskRewardBySymbol:      cfg.MinRiskRewardBySymbol,
+		MinRewardR:                 cfg.MinRewardR,
+		SymbolAliases:              cfg.SymbolAliases,
+		MaxPositions:               cfg.MaxPositions,
+		RequireMACDMomentum:        cfg.RequireMACDMomentum,
+		IncludeValidationRules:     cfg.IncludeValidationRules,
+
+		HardMaxNotionalUSD: cfg.HardMaxNotionalUSD,
+
+		PreserveDecisionOrder: cfg.PreserveDecisionOrder,
+
+		MinOITopDeltaPct: cfg.MinOITopDeltaPct,
+
+		PrimaryMaxRetries:       cfg.PrimaryMaxRetries,
+		PrimaryRetryBackoff:     time.Duration(cfg.PrimaryRetryBackoffSeconds) * time.Second,
+		RetryUnparseableOutput:  cfg.RetryUnparseableOutput,
+		ValidationMaxRetries:    cfg.ValidationMaxRetries,
+		ValidationRetryBackoff:  time.Duration(cfg.ValidationRetryBackoffSeconds) * time.Second,
+		ValidationFailurePolicy: cfg.ValidationFailurePolicy,
+		MaxConfidenceGap:        cfg.MaxConfidenceGap,
+
+		RequireValidationConfidence: cfg.RequireValidationConfidence,
+		ValidationConfidenceFloor:   cfg.ValidationConfidenceFloor,
+
+		ValidatorWeights: cfg.ValidatorWeights,
+		ValidationSuffix: cfg.ValidationSuffix,
+
+		SharpeResampleInterval: time.Duration(cfg.SharpeResampleMinutes) * time.Minute,
+		BaseCurrency:           cfg.BaseCurrency,
+		ScratchBandPct:         cfg.ScratchBandPct,
+		ScratchAsLoss:          cfg.ScratchAsLoss,
+		RoundDecimals:          cfg.RoundDecimals,
+		MarkToMarketEquity:     cfg.MarkToMarketEquity,
+		PeriodsPerYear:         cfg.PeriodsPerYear,
+		ClassifyCloseReasons:   cfg.ClassifyCloseReasons,
+		TimeStop:               time.Duration(cfg.TimeStopMinutes) * time.Minute,
+		RecordCandidateDetails: cfg.RecordCandidateDetails,
+		DecisionStore:          cfg.DecisionStore,
+
+		HoldStreakInsightCycles: cfg.HoldStreakInsightCycles,
+
+		DecisionWebhookURL: cfg.DecisionWebhookURL,
+
+		MaxCoTChars:   cfg.MaxCoTChars,
+		KeepFailedCoT: cfg.KeepFailedCoT,
 	}
 
 	// 创建trader实例
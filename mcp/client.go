@@ -3,8 +3,10 @@ package mcp
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"strings"
 	"time"
@@ -84,19 +86,74 @@ func (cfg *Client) SetClient(Client Client) {
 	cfg = &Client
 }
 
+// 默认重试配置
+const (
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = 2 * time.Second
+)
+
+// RetryPolicy AI调用的重试策略：最多尝试MaxAttempts次，第n次重试前等待 BaseDelay*2^(n-1)，
+// 并随机增加最多Jitter比例的等待时间（避免多个trader同时重试）
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	Jitter      float64
+}
+
+// DefaultRetryPolicy 默认重试策略（NewRetryPolicy未指定的项使用该值）
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: DefaultMaxRetries, BaseDelay: DefaultRetryBackoff, Jitter: 0.2}
+
+// NewRetryPolicy 按最大尝试次数和基础退避间隔创建重试策略，maxAttempts<=0 或 baseDelay<=0 时使用默认值
+func NewRetryPolicy(maxAttempts int, baseDelay time.Duration) RetryPolicy {
+	policy := DefaultRetryPolicy
+	if maxAttempts > 0 {
+		policy.MaxAttempts = maxAttempts
+	}
+	if baseDelay > 0 {
+		policy.BaseDelay = baseDelay
+	}
+	return policy
+}
+
+// delay 返回第retry次重试前的等待时间（指数退避加随机抖动）
+func (p RetryPolicy) delay(retry int) time.Duration {
+	wait := p.BaseDelay << (retry - 1)
+	if p.Jitter > 0 {
+		wait += time.Duration(rand.Float64() * p.Jitter * float64(wait))
+	}
+	return wait
+}
+
 // CallWithMessages 使用 system + user prompt 调用AI API（推荐）
 func (cfg *Client) CallWithMessages(systemPrompt, userPrompt string) (string, error) {
+	return cfg.CallWithRetries(systemPrompt, userPrompt, DefaultMaxRetries, DefaultRetryBackoff)
+}
+
+// CallWithRetries 按指定的最大尝试次数和基础退避间隔调用AI API（指数退避，见RetryPolicy）
+// maxRetries<=0 或 backoff<=0 时使用默认值
+func (cfg *Client) CallWithRetries(systemPrompt, userPrompt string, maxRetries int, backoff time.Duration) (string, error) {
+	result, _, err := cfg.CallWithPolicy(systemPrompt, userPrompt, NewRetryPolicy(maxRetries, backoff))
+	return result, err
+}
+
+// CallWithPolicy 按重试策略调用AI API，返回结果和实际重试次数
+// 只重试临时性错误（网络错误、429限流、5xx），其他错误（如4xx、响应解析失败）立即返回
+func (cfg *Client) CallWithPolicy(systemPrompt, userPrompt string, policy RetryPolicy) (string, int, error) {
 	if cfg.APIKey == "" {
-		return "", fmt.Errorf("AI API密钥未设置，请先调用 SetDeepSeekAPIKey() 或 SetQwenAPIKey()")
+		return "", 0, fmt.Errorf("AI API密钥未设置，请先调用 SetDeepSeekAPIKey() 或 SetQwenAPIKey()")
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultRetryPolicy.BaseDelay
 	}
 
-	// 重试配置
-	maxRetries := 3
 	var lastErr error
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
 		if attempt > 1 {
-			fmt.Printf("⚠️  AI API调用失败，正在重试 (%d/%d)...\n", attempt, maxRetries)
+			fmt.Printf("⚠️  AI API调用失败，正在重试 (%d/%d)...\n", attempt, policy.MaxAttempts)
 		}
 
 		result, err := cfg.callOnce(systemPrompt, userPrompt)
@@ -104,24 +161,34 @@ func (cfg *Client) CallWithMessages(systemPrompt, userPrompt string) (string, er
 			if attempt > 1 {
 				fmt.Printf("✓ AI API重试成功\n")
 			}
-			return result, nil
+			return result, attempt - 1, nil
 		}
 
 		lastErr = err
-		// 如果不是网络错误，不重试
+		// 如果不是临时性错误，不重试
 		if !isRetryableError(err) {
-			return "", err
+			return "", attempt - 1, err
 		}
 
 		// 重试前等待
-		if attempt < maxRetries {
-			waitTime := time.Duration(attempt) * 2 * time.Second
+		if attempt < policy.MaxAttempts {
+			waitTime := policy.delay(attempt)
 			fmt.Printf("⏳ 等待%v后重试...\n", waitTime)
 			time.Sleep(waitTime)
 		}
 	}
 
-	return "", fmt.Errorf("重试%d次后仍然失败: %w", maxRetries, lastErr)
+	return "", policy.MaxAttempts - 1, fmt.Errorf("重试%d次后仍然失败: %w", policy.MaxAttempts, lastErr)
+}
+
+// APIError API返回的非200响应
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API返回错误 (status %d): %s", e.StatusCode, e.Body)
 }
 
 // callOnce 单次调用AI API（内部使用）
@@ -202,7 +269,7 @@ func (cfg *Client) callOnce(systemPrompt, userPrompt string) (string, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API返回错误 (status %d): %s", resp.StatusCode, string(body))
+		return "", &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	// 解析响应
@@ -227,6 +294,12 @@ func (cfg *Client) callOnce(systemPrompt, userPrompt string) (string, error) {
 
 // isRetryableError 判断错误是否可重试
 func isRetryableError(err error) bool {
+	// 限流(429)和服务端错误(5xx)是临时性的
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+
 	errStr := err.Error()
 	// 网络错误、超时、EOF等可以重试
 	retryableErrors := []string{
@@ -2,6 +2,7 @@ package trader
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"nofx/decision"
@@ -52,6 +53,8 @@ type AutoTraderConfig struct {
 	// 扫描配置
 	ScanInterval time.Duration // 扫描间隔（建议3分钟）
 
+	MinCycleInterval time.Duration // 两次AI决策的最小间隔（0表示不限制）
+
 	// 账户配置
 	InitialBalance float64 // 初始金额（用于计算盈亏，需手动设置）
 
@@ -59,10 +62,90 @@ type AutoTraderConfig struct {
 	BTCETHLeverage  int // BTC和ETH的杠杆倍数
 	AltcoinLeverage int // 山寨币的杠杆倍数
 
+	// AI未给出杠杆时的默认值（0表示不补全）
+	DefaultBTCETHLeverage  int
+	DefaultAltcoinLeverage int
+
+	AllowedLeverage     map[string][]int // 各币种交易所允许的杠杆档位
+	MaxLeverageBySymbol map[string]int   // 按币种覆盖的杠杆上限（未配置的币种按BTC/ETH与山寨币两档）
+	DeRiskDrawdownPct   float64          // 回撤达到该值时杠杆上限减半（0表示不降杠杆）
+
 	// 风险控制（仅作为提示，AI可自主决定）
 	MaxDailyLoss    float64       // 最大日亏损百分比（提示）
 	MaxDrawdown     float64       // 最大回撤百分比（提示）
 	StopTradingTime time.Duration // 触发风控后暂停时长
+
+	// 决策引擎配置
+	IncludeLiquidationDistance bool     // 在prompt中展示持仓距强平百分比
+	IncludeMarketDataAge       bool     // 在prompt中展示各币种市场数据的获取时长（秒）
+	MaxPortfolioHeatPct        float64  // 组合热度上限（占净值百分比，0表示不限制）
+	MaxSymbolConcentrationPct  float64  // 单币种名义价值占全部持仓的上限（百分比，0表示不限制）
+	SymbolConcentrationPolicy  string   // 超过单币种集中度上限时: "block"(默认) 或 "warn"
+	UnheldHoldPolicy           string   // 未持仓币种的hold处理: "wait"(默认) 或 "drop"
+	EmptyReasoningPolicy       string   // 开仓缺少理由时: "allow"(默认)、"flag" 或 "reject"
+	SizeRiskTolerancePct       float64  // 仓位推算风险与risk_usd允许的偏差（%，0表示不检查）
+	SizeRiskPolicy             string   // 仓位与风险不一致时: "flag"(默认) 或 "reject"
+	EnforceRiskUSD             bool     // 要求止损触发时的实际风险不超过声明的risk_usd
+	RiskUSDTolerancePct        float64  // 实际风险允许超出risk_usd的百分比（默认0）
+	ValidationConcurrency      int      // 交叉验证最大并发数（默认3）
+	IncludeSymbolStats         bool     // 在prompt中展示各币种历史表现
+	MaxFetchCandidates         int      // 获取市场数据的候选币种上限（0表示全部）
+	MaxPromptCandidates        int      // prompt中展示的候选币种上限（0表示与获取数量相同）
+	RequiredIndicators         []string // 候选币种必须具备的指标（"vwap"/"rsi"/"macd"）
+	MaxMarginUsedPct           float64  // 保证金使用率上限（%），超过时禁止新开仓
+	MaxDailyReentries          int      // 同一币种每天最多开仓次数（0表示不限制）
+	MinSharpeRatio             float64  // 夏普比率下限（负数），低于时禁止新开仓
+	FeeRatePct                 float64  // 单边手续费率（%，如0.04）
+	MinTPFeeMultiple           float64  // 止盈幅度须超过往返手续费的倍数（默认1）
+	MinRiskReward              float64  // 开仓最低风险回报比（默认3.0）
+	RequireMACDMomentum        bool     // 开仓要求MACD动能方向一致（做多上行/做空下行）
+	IncludeValidationRules     bool     // 在主模型system prompt中附加验证模型的否决规则
+
+	MinRiskRewardBySymbol map[string]float64 // 按币种覆盖的最低风险回报比
+	MinRewardR            float64            // 以当前价入场，止盈距离须≥N倍止损距离（0表示不检查）
+	SymbolAliases         map[string]string  // 币种别名 -> 标准名（统一不同数据源的命名）
+	MaxPositions          int                // 最多同时持有的币种数量（默认3）
+
+	HardMaxNotionalUSD float64 // 单仓名义价值的绝对上限（USDT，0表示不限制）
+
+	PreserveDecisionOrder bool // 保留模型给出的决策顺序（默认平仓→hold/wait→开仓按信心度排序）
+
+	MinOITopDeltaPct float64 // OI Top持仓量1小时变化低于该百分比时，prompt中不标注OI_Top信号（0表示不过滤）
+
+	// AI调用重试配置（主模型与验证模型分开）
+	PrimaryMaxRetries       int           // 主模型最大尝试次数（默认3）
+	PrimaryRetryBackoff     time.Duration // 主模型重试退避间隔（默认2秒）
+	RetryUnparseableOutput  bool          // 主模型输出无法解析出决策JSON时，要求只返回JSON重试一次
+	ValidationMaxRetries    int           // 验证模型最大尝试次数（默认3）
+	ValidationRetryBackoff  time.Duration // 验证模型重试退避间隔（默认2秒）
+	ValidationFailurePolicy string        // 验证模型调用失败时: "reject"(默认) 或 "accept"
+	MaxConfidenceGap        int           // 验证模型评分与主模型信心度的最大差值（0表示不检查）
+
+	RequireValidationConfidence bool // 要求验证模型在AGREE/DISAGREE后给出0-100的信心度
+	ValidationConfidenceFloor   int  // AGREE的最低信心度（默认60）
+
+	ValidatorWeights map[string]float64 // 验证模型投票权重（未设置时按历史准确率）
+	ValidationSuffix string             // 验证通过后追加到决策理由的标注（默认" (Qwen验证通过)"）
+
+	// 历史表现分析配置
+	SharpeResampleInterval time.Duration // 夏普比率重采样窗口（0表示按周期计算）
+	BaseCurrency           string        // 账户计价货币（默认USDT）
+	ScratchBandPct         float64       // 打平区间（盈亏百分比，0表示关闭）
+	ScratchAsLoss          bool          // 盈亏比将打平交易按微小亏损计入
+	RoundDecimals          int           // 日志金额类数值保留的小数位（0表示不取整）
+	MarkToMarketEquity     bool          // 净值曲线按行情快照对持仓盯市
+	PeriodsPerYear         float64       // 每年的收益周期数（年化波动率用）
+	ClassifyCloseReasons   bool          // 将"Strategy"平仓细分为 vwap_reversal / time_stop / manual
+	TimeStop               time.Duration // 持仓达到该时长的平仓归为time_stop（0表示不判断）
+	RecordCandidateDetails bool          // 决策日志中记录候选币种的来源和评分（关闭时只记录币种名）
+	DecisionStore          string        // 决策日志存储: "file"(默认) 或 "sqlite"
+
+	HoldStreakInsightCycles int // 平仓前连续hold达到该周期数时生成复盘洞察（0表示不分析）
+
+	DecisionWebhookURL string // 每条决策记录保存后POST摘要到该URL（为空表示不通知）
+
+	MaxCoTChars   int  // 决策日志中思维链的最大字符数（超出时保留首尾摘录，0表示不截断）
+	KeepFailedCoT bool // 失败周期保留完整思维链
 }
 
 // AutoTrader 自动交易器
@@ -75,8 +158,9 @@ type AutoTraderConfig struct {
 	trader                Trader // 使用Trader接口（支持多平台）
 	primaryClient         *mcp.Client      // 主AI客户端
 	secondaryClient       *mcp.Client      // 辅AI客户端
-	decisionLogger        *logger.DecisionLogger // 决策日志记录器
+	decisionLogger        logger.DecisionStore // 决策日志记录器
 	initialBalance        float64
+	peakEquity            float64 // 运行期间的净值峰值（用于计算当前回撤，初始为初始金额）
 	dailyPnL              float64
 	lastResetTime         time.Time
 	stopUntil             time.Time
@@ -85,6 +169,7 @@ type AutoTraderConfig struct {
 	callCount             int              // AI调用次数
 	positionFirstSeenTime map[string]int64 // 持仓首次出现时间 (symbol_side -> timestamp毫秒)
 	activePositions       map[string]activePositionState // 仓位激活状态，包含止盈止损
+	cycleGuard            *decision.CycleGuard           // 决策周期最小间隔守卫
 }
 
 // activePositionState 存储每个活动仓位的止盈止损状态
@@ -160,7 +245,33 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 
 	// 初始化决策日志记录器（使用trader ID创建独立目录）
 	logDir := fmt.Sprintf("decision_logs/%s", config.ID)
-	decisionLogger := logger.NewDecisionLogger(logDir)
+	// decisionStore 供交易器使用（可互换的存储实现），decisionLogger 用于设置分析选项
+	var decisionLogger *logger.DecisionLogger
+	var decisionStore logger.DecisionStore
+	if config.DecisionStore == "sqlite" {
+		store, err := logger.NewSQLiteDecisionStore(logDir + ".db")
+		if err != nil {
+			return nil, fmt.Errorf("初始化SQLite决策存储失败: %w", err)
+		}
+		decisionLogger = store.DecisionLogger
+		decisionStore = store
+	} else {
+		decisionLogger = logger.NewDecisionLogger(logDir)
+		decisionStore = decisionLogger
+	}
+	decisionLogger.SetSharpeResampleInterval(config.SharpeResampleInterval)
+	decisionLogger.SetBaseCurrency(config.BaseCurrency)
+	decisionLogger.SetScratchBandPct(config.ScratchBandPct)
+	decisionLogger.SetScratchAsLoss(config.ScratchAsLoss)
+	decisionLogger.SetRoundDecimals(config.RoundDecimals)
+	decisionLogger.SetMarkToMarketEquity(config.MarkToMarketEquity)
+	decisionLogger.SetPeriodsPerYear(config.PeriodsPerYear)
+	decisionLogger.SetFeeRatePct(config.FeeRatePct)
+	decisionLogger.SetCloseClassification(config.ClassifyCloseReasons, config.TimeStop)
+	decisionLogger.SetMaxCoTChars(config.MaxCoTChars, config.KeepFailedCoT)
+	if config.DecisionWebhookURL != "" {
+		decisionLogger.SetNotifiers([]logger.DecisionNotifier{logger.NewWebhookNotifier(config.DecisionWebhookURL)})
+	}
 
 	return &AutoTrader{
 		id:                    config.ID,
@@ -171,14 +282,16 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 		trader:                trader,
 		primaryClient:         primaryClient,
 		secondaryClient:       secondaryClient,
-		decisionLogger:        decisionLogger,
+		decisionLogger:        decisionStore,
 		initialBalance:        config.InitialBalance,
+		peakEquity:            config.InitialBalance,
 		lastResetTime:         time.Now(),
 		startTime:             time.Now(),
 		callCount:             0,
 		isRunning:             false,
 		positionFirstSeenTime: make(map[string]int64),
 		activePositions:       make(map[string]activePositionState),
+		cycleGuard:            decision.NewCycleGuard(config.MinCycleInterval),
 	}, nil
 }
 
@@ -210,9 +323,18 @@ func (at *AutoTrader) Run() error {
 	return nil
 }
 
+// notificationFlushTimeout 停止时等待已排队决策通知发送完成的最长时间
+const notificationFlushTimeout = 10 * time.Second
+
 // Stop 停止自动交易
 func (at *AutoTrader) Stop() {
 	at.isRunning = false
+	if !at.decisionLogger.FlushNotifications(notificationFlushTimeout) {
+		log.Printf("⚠️  等待决策通知发送超时（%v），剩余通知在后台继续发送", notificationFlushTimeout)
+	}
+	if err := at.decisionLogger.Close(); err != nil {
+		log.Printf("⚠️  关闭决策日志失败: %v", err)
+	}
 	log.Println("⏹ 自动交易系统停止")
 }
 
@@ -220,9 +342,9 @@ func (at *AutoTrader) Stop() {
 func (at *AutoTrader) runCycle() error {
 	at.callCount++
 
-	log.Printf("\n" + strings.Repeat("=", 70))
+	log.Print("\n" + strings.Repeat("=", 70))
 	log.Printf("⏰ %s - AI决策周期 #%d", time.Now().Format("2006-01-02 15:04:05"), at.callCount)
-	log.Printf(strings.Repeat("=", 70))
+	log.Print(strings.Repeat("=", 70))
 
 	// 创建决策记录
 	record := &logger.DecisionRecord{
@@ -279,9 +401,14 @@ func (at *AutoTrader) runCycle() error {
 		})
 	}
 
-	// 保存候选币种列表
+	// 保存候选币种列表（按配置决定是否记录来源和评分）
 	for _, coin := range ctx.CandidateCoins {
-		record.CandidateCoins = append(record.CandidateCoins, coin.Symbol)
+		candidate := logger.CandidateRecord{Symbol: coin.Symbol}
+		if at.config.RecordCandidateDetails {
+			candidate.Sources = coin.Sources
+			candidate.Score = coin.Score
+		}
+		record.CandidateCoins = append(record.CandidateCoins, candidate)
 	}
 
 	// 保存市场数据快照
@@ -293,6 +420,7 @@ func (at *AutoTrader) runCycle() error {
 				CurrentVWAP:  data.CurrentVWAP,
 				CurrentRSI7:  data.CurrentRSI7,
 				CurrentMACD:  data.CurrentMACD,
+				FundingRate:  data.FundingRate,
 			}
 		}
 	}
@@ -302,16 +430,40 @@ func (at *AutoTrader) runCycle() error {
 
 	// 4. 调用双AI获取完整决策
 	log.Println("🤖 正在请求主模型(DeepSeek)分析并决策...")
-	decision, err := decision.GetFullDecision(ctx, at.primaryClient, at.secondaryClient)
+	validators := []decision.Validator{{Name: at.secondaryAIModel, Client: at.secondaryClient}}
+	decision, err := decision.GetFullDecisionWithValidators(ctx, at.primaryClient, validators)
+	if isCycleTooSoon(err) {
+		// 距上次决策过短只是跳过本周期，不算AI失败，不触发安全机制也不记录失败周期
+		log.Printf("⏭ 跳过本周期: %v", err)
+		return nil
+	}
 
 	// 即使有错误，也保存思维链、决策和输入prompt（用于debug）
 	if decision != nil {
 		record.InputPrompt = decision.UserPrompt
 		record.CoTTrace = decision.CoTTrace
+		record.MarketRegime = decision.MarketRegime
 		if len(decision.Decisions) > 0 {
 			decisionJSON, _ := json.MarshalIndent(decision.Decisions, "", "  ")
 			record.DecisionJSON = string(decisionJSON)
 		}
+		for _, rejected := range decision.Rejected {
+			record.RejectedDecisions = append(record.RejectedDecisions, logger.RejectedDecision{
+				Symbol: rejected.Decision.Symbol,
+				Action: rejected.Decision.Action,
+				Stage:  rejected.Stage,
+				Reason: rejected.Reason,
+				Detail: rejected.Detail,
+			})
+		}
+		for _, vote := range decision.ValidatorVotes {
+			record.ValidatorVotes = append(record.ValidatorVotes, logger.ValidatorVote{
+				Validator: vote.Validator,
+				Symbol:    vote.Symbol,
+				Action:    vote.Action,
+				Agree:     vote.Agree,
+			})
+		}
 	}
 
 	if err != nil {
@@ -351,11 +503,11 @@ func (at *AutoTrader) runCycle() error {
 	}
 
 	// 5. 打印AI思维链
-	log.Printf("\n" + strings.Repeat("-", 70))
+	log.Print("\n" + strings.Repeat("-", 70))
 	log.Println("💭 AI思维链分析:")
 	log.Println(strings.Repeat("-", 70))
 	log.Println(decision.CoTTrace)
-	log.Printf(strings.Repeat("-", 70) + "\n")
+	log.Print(strings.Repeat("-", 70) + "\n")
 
 	// 6. 打印AI决策
 	log.Printf("📋 AI决策列表 (%d 个):\n", len(decision.Decisions))
@@ -379,15 +531,7 @@ func (at *AutoTrader) runCycle() error {
 
 	// 执行决策并记录结果
 	for _, d := range sortedDecisions {
-		actionRecord := logger.DecisionAction{
-			Action:    d.Action,
-			Symbol:    d.Symbol,
-			Quantity:  0,
-			Leverage:  d.Leverage,
-			Price:     0,
-			Timestamp: time.Now(),
-			Success:   false,
-		}
+		actionRecord := newDecisionAction(&d, ctx.MarketDataMap)
 
 		if err := at.executeDecisionWithRecord(&d, &actionRecord); err != nil {
 			log.Printf("❌ 执行决策失败 (%s %s): %v", d.Symbol, d.Action, err)
@@ -498,6 +642,7 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			LiquidationPrice: liquidationPrice,
 			MarginUsed:       marginUsed,
 			UpdateTime:       updateTime,
+			StopLoss:         at.activePositions[posKey].StopLoss,
 		})
 	}
 
@@ -519,13 +664,18 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		return nil, fmt.Errorf("获取合并币种池失败: %w", err)
 	}
 
-	// 构建候选币种列表（包含来源信息）
-	var candidateCoins []decision.CandidateCoin
+	// 构建候选币种列表（包含来源和评分信息）
+	ai500Scores := make(map[string]float64)
+	for _, coin := range mergedPool.AI500Coins {
+		ai500Scores[coin.Pair] = coin.Score
+	}
+	candidateCoins := make([]decision.CandidateCoin, 0, len(mergedPool.AllSymbols))
 	for _, symbol := range mergedPool.AllSymbols {
 		sources := mergedPool.SymbolSources[symbol]
 		candidateCoins = append(candidateCoins, decision.CandidateCoin{
 			Symbol:  symbol,
 			Sources: sources, // "ai500" 和/或 "oi_top"
+			Score:   ai500Scores[symbol],
 		})
 	}
 
@@ -544,6 +694,15 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		marginUsedPct = (totalMarginUsed / totalEquity) * 100
 	}
 
+	// 当前回撤（相对运行期间净值峰值）
+	if totalEquity > at.peakEquity {
+		at.peakEquity = totalEquity
+	}
+	currentDrawdownPct := 0.0
+	if at.peakEquity > 0 {
+		currentDrawdownPct = (at.peakEquity - totalEquity) / at.peakEquity * 100
+	}
+
 	// 5. 分析历史表现（最近100个周期，避免长期持仓的交易记录丢失）
 	// 假设每3分钟一个周期，100个周期 = 5小时，足够覆盖大部分交易
 	performance, err := at.decisionLogger.AnalyzePerformance(100)
@@ -552,8 +711,24 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		performance = nil
 	}
 
+	// 今日各币种开仓次数（用于同币种重复开仓上限）
+	var opensToday map[string]int
+	if at.config.MaxDailyReentries > 0 {
+		opensToday, err = at.decisionLogger.GetOpenCountsByDate(time.Now())
+		if err != nil {
+			log.Printf("⚠️  统计今日开仓次数失败: %v", err)
+		}
+	}
+
+	// 验证模型历史准确率（用作交叉验证投票权重）
+	validatorAccuracy, err := at.decisionLogger.GetValidatorAccuracy(100)
+	if err != nil {
+		log.Printf("⚠️  统计验证模型准确率失败: %v", err)
+		validatorAccuracy = nil
+	}
+
 	// 6. 生成交易洞察
-	insights := logger.GenerateTradingInsights(performance)
+	insights := logger.GenerateTradingInsightsWithHoldStreak(performance, at.config.HoldStreakInsightCycles)
 
 	// 7. 构建上下文
 	ctx := &decision.Context{
@@ -562,6 +737,14 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		CallCount:       at.callCount,
 		BTCETHLeverage:  at.config.BTCETHLeverage,  // 使用配置的杠杆倍数
 		AltcoinLeverage: at.config.AltcoinLeverage, // 使用配置的杠杆倍数
+
+		DefaultBTCETHLeverage:  at.config.DefaultBTCETHLeverage,
+		DefaultAltcoinLeverage: at.config.DefaultAltcoinLeverage,
+		AllowedLeverage:        at.config.AllowedLeverage,
+		MaxLeverageBySymbol:    at.config.MaxLeverageBySymbol,
+		DeRiskDrawdownPct:      at.config.DeRiskDrawdownPct,
+		CurrentDrawdownPct:     currentDrawdownPct,
+		CycleGuard:             at.cycleGuard,
 		Account: decision.AccountInfo{
 			TotalEquity:      totalEquity,
 			AvailableBalance: availableBalance,
@@ -575,11 +758,89 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		CandidateCoins: candidateCoins,
 		Performance:    performance, // 添加历史表现分析
 		TradingInsights: insights,      // 添加交易复盘洞察
+
+		IncludeLiquidationDistance: at.config.IncludeLiquidationDistance,
+		IncludeMarketDataAge:       at.config.IncludeMarketDataAge,
+		MaxPortfolioHeatPct:        at.config.MaxPortfolioHeatPct,
+		MaxSymbolConcentrationPct:  at.config.MaxSymbolConcentrationPct,
+		SymbolConcentrationPolicy:  at.config.SymbolConcentrationPolicy,
+		UnheldHoldPolicy:           at.config.UnheldHoldPolicy,
+		EmptyReasoningPolicy:       at.config.EmptyReasoningPolicy,
+		SizeRiskTolerancePct:       at.config.SizeRiskTolerancePct,
+		SizeRiskPolicy:             at.config.SizeRiskPolicy,
+		EnforceRiskUSD:             at.config.EnforceRiskUSD,
+		RiskUSDTolerancePct:        at.config.RiskUSDTolerancePct,
+		ValidationConcurrency:      at.config.ValidationConcurrency,
+		IncludeSymbolStats:         at.config.IncludeSymbolStats,
+		MaxFetchCandidates:         at.config.MaxFetchCandidates,
+		MaxPromptCandidates:        at.config.MaxPromptCandidates,
+		RequiredIndicators:         at.config.RequiredIndicators,
+		MaxMarginUsedPct:           at.config.MaxMarginUsedPct,
+		MaxDailyReentries:          at.config.MaxDailyReentries,
+		MinSharpeRatio:             at.config.MinSharpeRatio,
+		OpensToday:                 opensToday,
+		FeeRatePct:                 at.config.FeeRatePct,
+		MinTPFeeMultiple:           at.config.MinTPFeeMultiple,
+		MinRiskReward:              at.config.MinRiskReward,
+		MinRiskRewardBySymbol:      at.config.MinRiskRewardBySymbol,
+		MinRewardR:                 at.config.MinRewardR,
+		SymbolAliases:              at.config.SymbolAliases,
+		MaxPositions:               at.config.MaxPositions,
+		RequireMACDMomentum:        at.config.RequireMACDMomentum,
+		IncludeValidationRules:     at.config.IncludeValidationRules,
+
+		HardMaxNotionalUSD: at.config.HardMaxNotionalUSD,
+
+		PreserveDecisionOrder: at.config.PreserveDecisionOrder,
+
+		MinOITopDeltaPct: at.config.MinOITopDeltaPct,
+
+		PrimaryMaxRetries:       at.config.PrimaryMaxRetries,
+		PrimaryRetryBackoff:     at.config.PrimaryRetryBackoff,
+		RetryUnparseableOutput:  at.config.RetryUnparseableOutput,
+		ValidationMaxRetries:    at.config.ValidationMaxRetries,
+		ValidationRetryBackoff:  at.config.ValidationRetryBackoff,
+		ValidationFailurePolicy: at.config.ValidationFailurePolicy,
+		MaxConfidenceGap:        at.config.MaxConfidenceGap,
+
+		RequireValidationConfidence: at.config.RequireValidationConfidence,
+		ValidationConfidenceFloor:   at.config.ValidationConfidenceFloor,
+
+		ValidatorWeights:  at.config.ValidatorWeights,
+		ValidatorAccuracy: validatorAccuracy,
+		ValidationSuffix:  at.config.ValidationSuffix,
 	}
 
 	return ctx, nil
 }
 
+// fetchMarketData 获取单个币种的市场数据（测试中可替换）
+var fetchMarketData = market.Get
+
+// newDecisionAction 创建决策执行记录，开仓时按决策时价格记录计划数量
+func newDecisionAction(d *decision.Decision, marketDataMap map[string]*market.Data) logger.DecisionAction {
+	actionRecord := logger.DecisionAction{
+		Action:    d.Action,
+		Symbol:    d.Symbol,
+		Quantity:  0,
+		Leverage:  d.Leverage,
+		Price:     0,
+		Timestamp: time.Now(),
+		Success:   false,
+	}
+
+	if d.Action == "open_long" || d.Action == "open_short" {
+		if data, ok := marketDataMap[d.Symbol]; ok && data != nil && data.CurrentPrice > 0 {
+			actionRecord.IntendedQuantity = d.PositionSizeUSD / data.CurrentPrice
+		}
+	}
+	if d.ClosePercent > 0 && d.ClosePercent < 100 {
+		actionRecord.ClosePercent = d.ClosePercent
+	}
+
+	return actionRecord
+}
+
 // executeDecisionWithRecord 执行AI决策并记录详细信息
 func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	switch decision.Action {
@@ -614,7 +875,7 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	}
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := fetchMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -673,7 +934,7 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	}
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := fetchMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -722,17 +983,22 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 	log.Printf("  🔄 平多仓: %s", decision.Symbol)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := fetchMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 平仓
-	order, err := at.trader.CloseLong(decision.Symbol, 0) // 0 = 全部平仓
+	// 平仓（部分平仓时按持仓数量的比例计算平仓数量）
+	quantity, err := at.closeQuantity(decision, "long")
+	if err != nil {
+		return err
+	}
+	order, err := at.trader.CloseLong(decision.Symbol, quantity) // 0 = 全部平仓
 	if err != nil {
 		return err
 	}
+	actionRecord.Quantity = quantity
 
 	// 记录订单ID
 	if orderID, ok := order["orderId"].(int64); ok {
@@ -741,9 +1007,11 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 
 	log.Printf("  ✓ 平仓成功")
 
-	// 清理止盈止损状态
-	posKey := decision.Symbol + "_long"
-	delete(at.activePositions, posKey)
+	// 清理止盈止损状态（部分平仓时剩余仓位保留）
+	if quantity == 0 {
+		posKey := decision.Symbol + "_long"
+		delete(at.activePositions, posKey)
+	}
 
 	return nil
 }
@@ -753,17 +1021,22 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	log.Printf("  🔄 平空仓: %s", decision.Symbol)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := fetchMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 平仓
-	order, err := at.trader.CloseShort(decision.Symbol, 0) // 0 = 全部平仓
+	// 平仓（部分平仓时按持仓数量的比例计算平仓数量）
+	quantity, err := at.closeQuantity(decision, "short")
 	if err != nil {
 		return err
 	}
+	order, err := at.trader.CloseShort(decision.Symbol, quantity) // 0 = 全部平仓
+	if err != nil {
+		return err
+	}
+	actionRecord.Quantity = quantity
 
 	// 记录订单ID
 	if orderID, ok := order["orderId"].(int64); ok {
@@ -772,13 +1045,42 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 
 	log.Printf("  ✓ 平仓成功")
 
-	// 清理止盈止损状态
-	posKey := decision.Symbol + "_short"
-	delete(at.activePositions, posKey)
+	// 清理止盈止损状态（部分平仓时剩余仓位保留）
+	if quantity == 0 {
+		posKey := decision.Symbol + "_short"
+		delete(at.activePositions, posKey)
+	}
 
 	return nil
 }
 
+// closeQuantity 返回平仓数量：全部平仓时返回0，部分平仓时按当前持仓数量 × close_percent% 计算
+func (at *AutoTrader) closeQuantity(d *decision.Decision, side string) (float64, error) {
+	if d.ClosePercent <= 0 || d.ClosePercent >= 100 {
+		return 0, nil
+	}
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return 0, fmt.Errorf("获取持仓失败: %w", err)
+	}
+	for _, pos := range positions {
+		if pos["symbol"] == d.Symbol && pos["side"] == side {
+			quantity := pos["positionAmt"].(float64)
+			if quantity < 0 {
+				quantity = -quantity
+			}
+			return quantity * d.ClosePercent / 100, nil
+		}
+	}
+	return 0, fmt.Errorf("没有找到 %s 的%s持仓", d.Symbol, side)
+}
+
+// isCycleTooSoon 判断错误是否为决策周期间隔过短（decision变量会遮蔽包名，单独封装）
+func isCycleTooSoon(err error) bool {
+	return errors.Is(err, decision.ErrCycleTooSoon)
+}
+
 // runFailsafeCycle 在AI决策失败时运行的应急周期
 func (at *AutoTrader) runFailsafeCycle(ctx *decision.Context) error {
 	log.Println("🛡️ Failsafe: Checking positions against local SL/TP.")
@@ -865,7 +1167,7 @@ func (at *AutoTrader) GetAIModel() string {
 }
 
 // GetDecisionLogger 获取决策日志记录器
-func (at *AutoTrader) GetDecisionLogger() *logger.DecisionLogger {
+func (at *AutoTrader) GetDecisionLogger() logger.DecisionStore {
 	return at.decisionLogger
 }
 
@@ -0,0 +1,76 @@
+package trader
+
+import (
+	"nofx/decision"
+	"nofx/market"
+	"testing"
+)
+
+// fakeTrader is a no-op exchange that accepts every order.
+type fakeTrader struct{}
+
+func (fakeTrader) GetBalance() (map[string]interface{}, error)          { return map[string]interface{}{}, nil }
+func (fakeTrader) GetPositions() ([]map[string]interface{}, error)      { return nil, nil }
+func (fakeTrader) SetLeverage(symbol string, leverage int) error        { return nil }
+func (fakeTrader) GetMarketPrice(symbol string) (float64, error)        { return 0, nil }
+func (fakeTrader) CancelAllOrders(symbol string) error                  { return nil }
+func (fakeTrader) FormatQuantity(string, float64) (string, error)       { return "", nil }
+func (fakeTrader) SetStopLoss(string, string, float64, float64) error   { return nil }
+func (fakeTrader) SetTakeProfit(string, string, float64, float64) error { return nil }
+func (fakeTrader) OpenLong(string, float64, int) (map[string]interface{}, error) {
+	return map[string]interface{}{"orderId": int64(1)}, nil
+}
+func (fakeTrader) OpenShort(string, float64, int) (map[string]interface{}, error) {
+	return map[string]interface{}{"orderId": int64(2)}, nil
+}
+func (fakeTrader) CloseLong(string, float64) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+func (fakeTrader) CloseShort(string, float64) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+// stubMarketData replaces the market data fetcher for the duration of the test.
+func stubMarketData(t *testing.T, fetch func(symbol string) (*market.Data, error)) {
+	t.Helper()
+	original := fetchMarketData
+	fetchMarketData = fetch
+	t.Cleanup(func() { fetchMarketData = original })
+}
+
+func newTestAutoTrader() *AutoTrader {
+	return &AutoTrader{
+		trader:                fakeTrader{},
+		positionFirstSeenTime: make(map[string]int64),
+		activePositions:       make(map[string]activePositionState),
+	}
+}
+
+func TestIntendedQuantityRecorded(t *testing.T) {
+	// Price at decision time is 100, but it has moved to 125 by execution
+	decisionTimeData := map[string]*market.Data{
+		"SOLUSDT": {Symbol: "SOLUSDT", CurrentPrice: 100},
+	}
+	stubMarketData(t, func(symbol string) (*market.Data, error) {
+		return &market.Data{Symbol: symbol, CurrentPrice: 125}, nil
+	})
+
+	d := &decision.Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 1000, StopLoss: 90, TakeProfit: 150}
+	actionRecord := newDecisionAction(d, decisionTimeData)
+
+	if actionRecord.IntendedQuantity != 10 {
+		t.Errorf("Expected intended quantity to be 10, but got %.4f", actionRecord.IntendedQuantity)
+	}
+
+	at := newTestAutoTrader()
+	if err := at.executeDecisionWithRecord(d, &actionRecord); err != nil {
+		t.Fatalf("Expected the open to succeed, but got %v", err)
+	}
+
+	if actionRecord.Quantity != 8 {
+		t.Errorf("Expected executed quantity to be 8, but got %.4f", actionRecord.Quantity)
+	}
+	if actionRecord.IntendedQuantity != 10 {
+		t.Errorf("Expected intended quantity to stay 10 after execution, but got %.4f", actionRecord.IntendedQuantity)
+	}
+}
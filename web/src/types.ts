@@ -70,7 +70,7 @@ export interface DecisionRecord {
   decision_json: string;
   account_state: AccountSnapshot;
   positions: any[];
-  candidate_coins: string[];
+  candidate_coins: Array<string | { symbol: string; sources?: string[]; score?: number }>; // 旧日志为字符串
   decisions: DecisionAction[];
   execution_log: string[];
   success: boolean;
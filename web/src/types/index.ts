@@ -76,7 +76,7 @@ export interface DecisionRecord {
     leverage: number;
     liquidation_price: number;
   }>;
-  candidate_coins: string[];
+  candidate_coins: Array<string | { symbol: string; sources?: string[]; score?: number }>; // 旧日志为字符串
   decisions: DecisionAction[];
   execution_log: string[];
   success: boolean;